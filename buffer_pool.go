@@ -8,8 +8,11 @@
 package dox2go
 
 import (
+	"bufio"
 	"bytes"
 	"io"
+	"io/ioutil"
+	"os"
 )
 
 // Buffer us a reusable block of memory used as a temporary
@@ -18,28 +21,118 @@ import (
 // Write writes a slice of bytes to the buffer.
 //
 // WriteTo writes the contents of the buffer to the supplied
-// io.Writer.
+// io.Writer. The contents are consumed as they are written.
+//
+// The buffers of a BufferPool also have a Len method that
+// returns the number of bytes they hold.
 type Buffer interface {
 	Write(p []byte) (n int, err error)
 	WriteTo(w io.Writer) (n int64, err error)
 }
 
+// spill describes where buffers are moved to once they
+// grow beyond a threshold.
+type spill struct {
+	dir       string
+	threshold int
+}
+
 type buffer struct {
 	reserved bool
 	buf      *bytes.Buffer
+	spill    *spill
+	file     *os.File
+	fw       *bufio.Writer
+	fileLen  int
 }
 
 func (b *buffer) Write(p []byte) (n int, err error) {
+
+	if b.file == nil && b.spill != nil && b.buf.Len()+len(p) > b.spill.threshold {
+		err = b.spillToFile()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if b.file != nil {
+		n, err = b.fw.Write(p)
+		b.fileLen += n
+		return n, err
+	}
+
 	return b.buf.Write(p)
 }
 
 func (b *buffer) WriteTo(w io.Writer) (n int64, err error) {
-	return b.buf.WriteTo(w)
+
+	if b.file == nil {
+		return b.buf.WriteTo(w)
+	}
+
+	err = b.fw.Flush()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = b.file.Seek(0, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err = io.Copy(w, b.file)
+	if err != nil {
+		return n, err
+	}
+
+	return n, b.release()
+}
+
+// Len returns the number of bytes in the buffer.
+func (b *buffer) Len() int {
+	return b.buf.Len() + b.fileLen
+}
+
+// spillToFile moves the contents of the buffer to a temporary
+// file which receives everything written to the buffer after.
+func (b *buffer) spillToFile() error {
+
+	f, err := ioutil.TempFile(b.spill.dir, "dox2go")
+	if err != nil {
+		return err
+	}
+
+	b.file = f
+	b.fw = bufio.NewWriter(f)
+
+	n, err := b.buf.WriteTo(b.fw)
+	b.fileLen = int(n)
+	return err
+}
+
+// release removes the temporary file of a buffer.
+func (b *buffer) release() error {
+
+	if b.file == nil {
+		return nil
+	}
+
+	f := b.file
+	b.file = nil
+	b.fw = nil
+	b.fileLen = 0
+
+	err := f.Close()
+	if rerr := os.Remove(f.Name()); err == nil {
+		err = rerr
+	}
+	return err
 }
 
 type pool struct {
 	minSize int
 	buffers []*buffer
+	spill   *spill
 }
 
 func (p *pool) getBuffer() Buffer {
@@ -48,11 +141,12 @@ func (p *pool) getBuffer() Buffer {
 		if !b.reserved {
 			b.reserved = true
 			b.buf.Reset()
+			b.release()
 			return b
 		}
 	}
 
-	b := &buffer{true, bytes.NewBuffer(make([]byte, 0, p.minSize))}
+	b := &buffer{true, bytes.NewBuffer(make([]byte, 0, p.minSize)), p.spill, nil, nil, 0}
 
 	p.buffers = append(p.buffers, b)
 
@@ -65,11 +159,12 @@ func (p *pool) getBuffer() Buffer {
 // return it to the pool once they are done with it.
 type BufferPool struct {
 	pools map[int]*pool
+	spill *spill
 }
 
 // CreateCategory adds a category of buffer such as "small" or "large".
 func (bp *BufferPool) CreateCategory(category int, minBufferSize int) {
-	bp.pools[category] = &pool{minBufferSize, make([]*buffer, 0, 1)}
+	bp.pools[category] = &pool{minBufferSize, make([]*buffer, 0, 1), bp.spill}
 }
 
 // GetBuffer returns a buffer of the requested category. If no free
@@ -81,11 +176,13 @@ func (bp *BufferPool) GetBuffer(category int) Buffer {
 }
 
 // FreeBuffer returns a buffer to the pool, allowing other callers to use it.
+// The temporary file of a buffer that has been spilled to disk is removed.
 func (bp *BufferPool) FreeBuffer(w Buffer) {
 
 	if b, ok := w.(*buffer); ok {
 
 		b.reserved = false
+		b.release()
 
 	} else {
 
@@ -93,7 +190,30 @@ func (bp *BufferPool) FreeBuffer(w Buffer) {
 	}
 }
 
+// Close removes the temporary files of all buffers in the pool,
+// whether or not they have been freed.
+func (bp *BufferPool) Close() (err error) {
+
+	for _, p := range bp.pools {
+		for _, b := range p.buffers {
+			if rerr := b.release(); err == nil {
+				err = rerr
+			}
+		}
+	}
+	return err
+}
+
 // NewBufferPool constructs a new buffer pool.
 func NewBufferPool() *BufferPool {
-	return &BufferPool{make(map[int]*pool)}
+	return &BufferPool{make(map[int]*pool), nil}
+}
+
+// NewSpillingBufferPool constructs a buffer pool whose buffers
+// move their contents to a temporary file in dir once they grow
+// beyond threshold bytes. If dir is empty the default directory
+// for temporary files is used. Close must be called to remove
+// the files.
+func NewSpillingBufferPool(dir string, threshold int) *BufferPool {
+	return &BufferPool{make(map[int]*pool), &spill{dir, threshold}}
 }
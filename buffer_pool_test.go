@@ -0,0 +1,97 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package dox2go
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func countFiles(t *testing.T, dir string) int {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(files)
+}
+
+func TestSpillingBufferPool(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "dox2go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bp := NewSpillingBufferPool(dir, 8)
+	bp.CreateCategory(0, 4)
+
+	small := bp.GetBuffer(0)
+	small.Write([]byte("1234"))
+
+	large := bp.GetBuffer(0)
+	large.Write([]byte("12345"))
+	large.Write([]byte("67890"))
+
+	if n := countFiles(t, dir); n != 1 {
+		t.Errorf("Expected 1 spilled buffer. Was %d", n)
+	}
+
+	if large.(*buffer).Len() != 10 {
+		t.Errorf("Expected 10 bytes. Was %d", large.(*buffer).Len())
+	}
+
+	var b bytes.Buffer
+	large.WriteTo(&b)
+	if b.String() != "1234567890" {
+		t.Errorf("Expected 1234567890. Was %s", b.String())
+	}
+
+	if large.(*buffer).Len() != 0 {
+		t.Errorf("Expected the buffer to be empty after writing. Was %d bytes", large.(*buffer).Len())
+	}
+
+	large.Write([]byte("1234567890"))
+	bp.FreeBuffer(large)
+	if n := countFiles(t, dir); n != 0 {
+		t.Errorf("Expected freed buffers to be removed. Was %d files", n)
+	}
+
+	small.Write([]byte("567890"))
+	if n := countFiles(t, dir); n != 1 {
+		t.Errorf("Expected 1 spilled buffer. Was %d", n)
+	}
+
+	if err := bp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countFiles(t, dir); n != 0 {
+		t.Errorf("Expected Close to remove all files. Was %d", n)
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+
+	bp := NewBufferPool()
+	bp.CreateCategory(0, 4)
+
+	buf := bp.GetBuffer(0)
+	buf.Write(make([]byte, 100))
+	if buf.(*buffer).Len() != 100 {
+		t.Errorf("Expected 100 bytes. Was %d", buf.(*buffer).Len())
+	}
+
+	bp.FreeBuffer(buf)
+	if bp.GetBuffer(0) != buf {
+		t.Errorf("Expected the freed buffer to be reused")
+	}
+	if buf.(*buffer).Len() != 0 {
+		t.Errorf("Expected a reused buffer to be empty. Was %d bytes", buf.(*buffer).Len())
+	}
+}
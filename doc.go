@@ -9,7 +9,10 @@
 package dox2go
 
 import (
+	"crypto"
+	"crypto/x509"
 	"image"
+	"time"
 )
 
 // PageSize defines one of the standard page sizes defined below.
@@ -72,10 +75,33 @@ func StandardSize(ps PageSize, unit PageUnit) (float64, float64) {
 // oriented in portrait or landscape.
 type PageOrientation int32
 
-// These are the available page orientations.
+// These are the available page orientations. PO_Landscape
+// swaps the width and height so the media itself is landscape.
+// The rotated orientations keep the media at width by height
+// and ask viewers to rotate the page clockwise by 90, 180 or
+// 270 degrees. The Surface of a rotated page has its origin at
+// the bottom left of the page as it is displayed.
 const (
 	PO_Landscape PageOrientation = iota
 	PO_Portrait
+	PO_Rotate90
+	PO_Rotate180
+	PO_Rotate270
+)
+
+// PageBox identifies the boundaries of a page used when it
+// is produced.
+type PageBox int32
+
+// These are the available page boxes. PB_Crop is the region
+// shown by viewers and printed, PB_Bleed the region to clip to in
+// production, PB_Trim the intended size of the finished page and
+// PB_Art the extent of its meaningful content.
+const (
+	PB_Crop PageBox = iota
+	PB_Bleed
+	PB_Trim
+	PB_Art
 )
 
 // Document is the core interface of dox2go. It is responsible 
@@ -93,8 +119,64 @@ const (
 // a bitmap on a document. The returned Image can be used
 // any number of times.
 //
+// CreateStencil returns an Image that is drawn as a
+// stencil. The dark, opaque pixels of the source are
+// painted with the current Bg color and all other pixels
+// are left unpainted. This suits monochrome icons and
+// signatures.
+//
+// AddBookmark adds an entry to the top level of the
+// document's outline. Selecting the bookmark shows the
+// supplied page with the position x, y, in the page's unit,
+// at the top left of the window.
+//
+// AddDestination defines a named destination that shows the
+// supplied page with the position x, y, in the page's unit, at
+// the top left of the window. Links can refer to the destination
+// by name.
+//
+// AddPageLabels starts a range of page labels at the supplied
+// page. The range continues until the next range or the end of the
+// document. Pages are numbered from start in the given style and
+// their labels begin with prefix. Pages before the first range are
+// numbered 1, 2, 3 and so on.
+//
+// CreateLayer returns a layer that viewers list in their
+// layers panel and can show or hide. Visible sets whether the
+// layer is shown when the document is opened and printed whether
+// it is printed.
+//
+// AttachFile embeds a file in the document. Viewers list it
+// with the document's attachments.
+//
+// SetMetadata sets the descriptive information written
+// with the document.
+//
+// SetPageLayout sets how pages are arranged when the document
+// is opened.
+//
+// SetPageMode sets which panel, if any, is shown when the
+// document is opened.
+//
+// SetOpenAction shows the supplied page when the document is
+// opened, with the position x, y, in the page's unit, at the top
+// left of the window. Zoom is the magnification, where 1 is 100%;
+// zero keeps the viewer's current magnification.
+//
+// SetViewerPreferences controls the viewer's window and
+// printing.
+//
+// Sign adds a signature field to the supplied page and signs
+// the document when it is closed. The rectangle of the field is
+// in the page's unit and is transformed by the current
+// transformation of the page's Surface. The returned Surface draws
+// the visible appearance of the signature; its origin is the
+// bottom left of the field. A document can only be signed once;
+// later signatures are not added and Close returns an error.
+//
 // Close is called when the document is complete and is
-// ready to be written to an output target.
+// ready to be written to an output target. A document is
+// written once; closing it again returns an error.
 type Document interface {
 	CreatePage(pu PageUnit, width, height float64, po PageOrientation) Page
 
@@ -102,14 +184,435 @@ type Document interface {
 
 	CreateImage(src image.Image) Image
 
+	CreateStencil(src image.Image) Image
+
+	AddBookmark(title string, p Page, x, y float64) Bookmark
+
+	AddDestination(name string, p Page, x, y float64)
+
+	AddPageLabels(p Page, style PageLabelStyle, prefix string, start int)
+
+	CreateLayer(name string, visible, printed bool) Layer
+
+	AttachFile(f EmbeddedFile)
+
+	SetMetadata(m Metadata)
+
+	SetPageLayout(pl PageLayout)
+
+	SetPageMode(pm PageMode)
+
+	SetOpenAction(p Page, x, y, zoom float64)
+
+	SetViewerPreferences(vp ViewerPreferences)
+
+	Sign(p Page, x, y, w, h float64, s Signature) Surface
+
 	Close() error
 }
 
+// PageLabelStyle is the numbering style of a range of page
+// labels.
+type PageLabelStyle int32
+
+// These are the available page label styles. LS_None labels
+// pages with the prefix alone. The roman styles number pages i, ii,
+// iii and the letter styles a to z, then aa to zz and so on.
+const (
+	LS_None PageLabelStyle = iota
+	LS_Decimal
+	LS_UpperRoman
+	LS_LowerRoman
+	LS_UpperLetters
+	LS_LowerLetters
+)
+
+// FileRelationship describes how an embedded file relates
+// to the document.
+type FileRelationship int32
+
+// These are the available relationships. FR_Source is the
+// original the document was created from, FR_Data the data
+// behind its content, FR_Alternative an alternative
+// representation such as the XML of an electronic invoice and
+// FR_Supplement additional information.
+const (
+	FR_Unspecified FileRelationship = iota
+	FR_Source
+	FR_Data
+	FR_Alternative
+	FR_Supplement
+)
+
+// EmbeddedFile is a file stored within a document.
+//
+// Name is the file name shown by viewers and used when the
+// file is saved.
+//
+// MimeType is the MIME type of the file, such as text/xml. When
+// empty application/octet-stream is used.
+//
+// Modified is the time the file was last changed. When zero
+// the time the file is attached is used.
+type EmbeddedFile struct {
+	Name         string
+	MimeType     string
+	Description  string
+	Modified     time.Time
+	Data         []byte
+	Relationship FileRelationship
+}
+
+// PageLayout describes how pages are arranged in the viewer.
+type PageLayout int32
+
+// These are the available page layouts. The two column layouts
+// scroll continuously while the two page layouts show one pair of
+// pages at a time. Left and right are the sides the odd pages are
+// shown on.
+const (
+	PL_SinglePage PageLayout = iota
+	PL_OneColumn
+	PL_TwoColumnLeft
+	PL_TwoColumnRight
+	PL_TwoPageLeft
+	PL_TwoPageRight
+)
+
+// PageMode describes the panel shown beside the pages
+// when a document is opened.
+type PageMode int32
+
+// These are the available page modes. PM_UseOutlines shows the
+// bookmarks, PM_UseThumbs page thumbnails, PM_UseOC the layers and
+// PM_UseAttachments the embedded files. PM_FullScreen hides the
+// viewer's window decorations.
+const (
+	PM_UseNone PageMode = iota
+	PM_UseOutlines
+	PM_UseThumbs
+	PM_FullScreen
+	PM_UseOC
+	PM_UseAttachments
+)
+
+// Duplex is the paper handling used when printing.
+type Duplex int32
+
+// These are the available duplex modes. DX_None leaves the
+// choice to the user.
+const (
+	DX_None Duplex = iota
+	DX_Simplex
+	DX_FlipShortEdge
+	DX_FlipLongEdge
+)
+
+// ViewerPreferences control how a document is presented by
+// viewers.
+//
+// HideToolbar, HideMenubar hide parts of the viewer's window.
+//
+// FitWindow resizes the window to fit the first page and
+// CenterWindow places it in the center of the screen.
+//
+// DisplayDocTitle shows the title from the document's metadata
+// in the window's title bar instead of the file name.
+//
+// NoPrintScaling prints pages at their actual size rather than
+// scaling them to the paper.
+//
+// Duplex is the default paper handling when printing.
+type ViewerPreferences struct {
+	HideToolbar     bool
+	HideMenubar     bool
+	FitWindow       bool
+	CenterWindow    bool
+	DisplayDocTitle bool
+	NoPrintScaling  bool
+	Duplex          Duplex
+}
+
+// Metadata describes a document for indexing and display
+// by document management systems and viewers.
+//
+// Title, Author, Subject and Keywords describe the content
+// of the document.
+//
+// Creator is the name of the application that created the
+// original content. Producer is the name of the application
+// that wrote the document. When empty it defaults to dox2go.
+//
+// Created and Modified are the times the document was created
+// and last changed. When Created is zero the time the document
+// is closed is used. When Modified is zero it is the same as
+// Created.
+//
+// Language is the natural language of the text of the document
+// as a language tag such as en-AU. Screen readers use it to
+// choose how the text is pronounced.
+type Metadata struct {
+	Title    string
+	Author   string
+	Subject  string
+	Keywords []string
+	Creator  string
+	Producer string
+	Created  time.Time
+	Modified time.Time
+	Language string
+}
+
+// Signature describes a digital signature.
+//
+// Signer signs the document with the private key of the first
+// certificate of Chain. Chain lists the signing certificate
+// followed by the certificates that issued it. RSA and ECDSA keys
+// are supported.
+//
+// Name, Reason, Location and ContactInfo describe the signer and
+// the purpose of the signature.
+//
+// Time is the time of signing. When zero the time the document is
+// closed is used.
+type Signature struct {
+	Signer      crypto.Signer
+	Chain       []*x509.Certificate
+	Name        string
+	Reason      string
+	Location    string
+	ContactInfo string
+	Time        time.Time
+}
+
+// Bookmark is an entry in the outline of a Document. Bookmarks
+// may be nested to any depth.
+//
+// AddBookmark adds a child entry to the bookmark.
+//
+// SetOpen determines whether the children of the bookmark are
+// shown when the document is opened. Bookmarks are open by default.
+//
+// SetColor sets the color of the bookmark's title.
+//
+// SetStyle sets whether the bookmark's title is shown in bold
+// or italic.
+type Bookmark interface {
+	AddBookmark(title string, p Page, x, y float64) Bookmark
+	SetOpen(open bool)
+	SetColor(c Color)
+	SetStyle(fs FontStyle)
+}
+
+// Layer is an optional group of content that viewers can
+// show or hide. Content is placed on a layer with
+// Surface.BeginLayer.
+type Layer interface {
+	Id() int
+	Name() string
+}
+
+// PageFit describes how a page is shown when the target of
+// a link.
+type PageFit int32
+
+// These are the available page fits.
+//
+// PF_Fit shows the whole page.
+//
+// PF_FitWidth fits the width of the page to the window.
+//
+// PF_FitHeight fits the height of the page to the window.
+//
+// PF_FitContent fits the area of the page that has been
+// drawn on to the window.
+const (
+	PF_Fit PageFit = iota
+	PF_FitWidth
+	PF_FitHeight
+	PF_FitContent
+)
+
 // Page is an interface that describes a page of a Document.
 //
 // Surface returns the drawing surface of the page.
 // Surface defines operations for drawing graphics and
 // text on the page.
+//
+// The Link methods make a rectangle of the page clickable.
+// The rectangle is in the page's unit and is transformed by
+// the current transformation of the page's Surface.
+//
+// LinkURI adds a link that opens a URI.
+//
+// LinkPage adds a link that shows another page of the document.
+//
+// LinkDestination adds a link that shows the named destination
+// defined with Document.AddDestination.
+//
+// AddField adds an interactive form field to the page. Like
+// links, the rectangle of the field is in the page's unit and is
+// transformed by the current transformation of the Surface.
+//
+// AttachFile embeds a file and shows it as an icon in the
+// rectangle. Like links, the rectangle is in the page's unit and
+// is transformed by the current transformation of the Surface.
+//
+// Annotate adds a markup annotation, such as a note, highlight
+// or stamp, to the rectangle. Like links, the rectangle is in the
+// page's unit and is transformed by the current transformation of
+// the Surface. A default appearance is drawn for the annotation
+// and the returned Surface draws over it; its origin is the bottom
+// left of the annotation's bounds.
+//
+// SetBox sets one of the page's boxes. The rectangle is in the
+// page's unit with its origin at the bottom left of the page as
+// displayed and is not affected by the transformation of the
+// Surface.
 type Page interface {
 	Surface() Surface
+
+	SetBox(b PageBox, x, y, w, h float64)
+
+	LinkURI(x, y, w, h float64, uri string)
+	LinkPage(x, y, w, h float64, target Page, fit PageFit)
+	LinkDestination(x, y, w, h float64, name string)
+
+	AddField(x, y, w, h float64, f FormField)
+
+	AttachFile(x, y, w, h float64, f EmbeddedFile)
+
+	Annotate(x, y, w, h float64, a Annotation) Surface
+}
+
+// AnnotationType describes the kinds of markup annotations.
+type AnnotationType int32
+
+// These are the available annotation types.
+//
+// AT_Text is a note shown as an icon.
+//
+// AT_Highlight, AT_Underline, AT_StrikeOut and AT_Squiggly mark
+// up the text within the rectangle.
+//
+// AT_Stamp shows its name like a rubber stamp.
+//
+// AT_FreeText shows its contents directly on the page.
+//
+// AT_Square and AT_Circle draw a rectangle or ellipse within
+// the rectangle.
+//
+// AT_Line, AT_Polygon and AT_PolyLine join the annotation's
+// points and AT_Ink draws its ink strokes.
+const (
+	AT_Text AnnotationType = iota
+	AT_Highlight
+	AT_Underline
+	AT_StrikeOut
+	AT_Squiggly
+	AT_Stamp
+	AT_FreeText
+	AT_Square
+	AT_Circle
+	AT_Line
+	AT_Polygon
+	AT_PolyLine
+	AT_Ink
+)
+
+// Annotation describes a markup annotation.
+//
+// Author and Date identify who made the annotation and when.
+// When Date is zero the time the annotation is added is used.
+//
+// Contents is the text of the annotation, shown in its popup
+// window. Open shows the popup when the document is opened.
+//
+// Color is the color of the annotation and its alpha component
+// the annotation's opacity. When the zero Color is supplied
+// yellow is used.
+//
+// Name is the icon of notes, such as Comment, Help or Note, and
+// the text of stamps, such as Approved or Draft.
+//
+// Font is used to draw the text of free text annotations and
+// stamps. When nil a Helvetica font is used.
+//
+// Points are the x, y pairs, in the page's unit, joined by
+// lines, polygons and polylines. Ink is a list of strokes, each
+// a list of x, y pairs. Like the rectangle they are transformed
+// by the current transformation of the Surface. When the
+// rectangle passed to Page.Annotate is empty the annotation's
+// bounds are those of its points.
+type Annotation struct {
+	Type     AnnotationType
+	Author   string
+	Date     time.Time
+	Contents string
+	Open     bool
+	Color    Color
+	Name     string
+	Font     Font
+	Points   []float64
+	Ink      [][]float64
+}
+
+// FieldType describes the kinds of interactive form fields.
+type FieldType int32
+
+// These are the available field types.
+const (
+	FT_Text FieldType = iota
+	FT_CheckBox
+	FT_Radio
+	FT_ComboBox
+	FT_ListBox
+	FT_PushButton
+)
+
+// FieldFlags control the behaviour of form fields.
+type FieldFlags int32
+
+// These are the available field flags. FF_Multiline only
+// applies to text fields.
+const (
+	FF_ReadOnly FieldFlags = 1 << iota
+	FF_Required
+	FF_Multiline
+)
+
+// FormField describes an interactive form field.
+//
+// Type is the kind of field.
+//
+// Name identifies the field. Radio buttons with the same
+// name form a group of which only one can be selected.
+//
+// Font is used to draw the text of the field. When nil a
+// 12 point Helvetica font is used.
+//
+// Value is the default text of text fields, the selected
+// option of combo and list boxes, the value a radio button
+// gives its group when selected and the caption of push buttons.
+// Radio buttons without a value are named by their position in
+// the group, starting from Choice1.
+//
+// Checked is the default state of check boxes and radio buttons.
+//
+// Options lists the choices of combo and list boxes.
+//
+// MaxLen limits the length of the text of text fields when
+// greater than zero.
+//
+// URI is opened when a push button is clicked.
+type FormField struct {
+	Type    FieldType
+	Name    string
+	Font    Font
+	Value   string
+	Checked bool
+	Options []string
+	MaxLen  int
+	Flags   FieldFlags
+	URI     string
 }
@@ -90,15 +90,36 @@ type Font interface {
 // can be drawn on a page.
 //
 // Id returns am identifier assigned by the document
-// to this image.
+// to this image. Small images that a document draws
+// within the content of a page rather than as separate
+// objects may all have the identifier 0.
 //
 // Width returns the width of the image in pixels.
 //
 // Height returns the height of the image in pixels.
+//
+// Dpi returns the horizontal and vertical resolution of
+// the image in dots per inch.
+//
+// SetDpi sets the resolution of the image. This determines
+// the size of the image when drawn with IP_Natural.
 type Image interface {
 	Id() int
 	Width() int
 	Height() int
+	Dpi() (x, y float64)
+	SetDpi(x, y float64)
+}
+
+// ColorKeyed is implemented by bitmap images that can be made
+// partly transparent with a color key.
+//
+// SetColorKey marks pixels with colors between min and max,
+// inclusive, as transparent. The alpha components of min and
+// max are ignored. A color key replaces the transparency
+// of the source image.
+type ColorKeyed interface {
+	SetColorKey(min, max Color)
 }
 
 // PathCmdType describes the types of drawing operations
@@ -309,12 +330,34 @@ func (p *pathReader) Dump() {
 //
 // Text draws a text string on the Surface.
 //
-// Image draws a bitmap image on the Surface.
+// Image draws a bitmap image on the Surface, stretching
+// it to fill the box at x, y with size w, h. The position
+// and the size of the box are both in page units.
+//
+// PlaceImage draws a bitmap image within the box at x, y
+// with size w, h. The placement determines how the image
+// is sized and the anchor determines where it is aligned
+// within the box.
 //
 // Stroke strokes a path in the Fg color using the current 
 // line width, joins and caps.
 //
 // Fill fills the area of a path with the current Bg color.
+//
+// BeginElement opens a structure element describing the
+// role of the content drawn until the matching EndElement.
+// Elements may be nested and may span several pages. Alt is
+// the alternate text of figures and may be empty for other
+// elements.
+//
+// BeginArtifact marks the content drawn until the matching
+// EndArtifact as decorative, such as rules, page numbers and
+// backgrounds, so that assistive technology ignores it.
+//
+// BeginLayer places the content drawn until the matching
+// EndLayer on a layer created with Document.CreateLayer. Layers
+// may be nested; nested content is only shown when all of its
+// layers are.
 type Surface interface {
 	PushState()
 	PopState()
@@ -334,8 +377,18 @@ type Surface interface {
 	Text(f Font, x, y float64, text string)
 
 	Image(i Image, x, y, w, h float64)
+	PlaceImage(i Image, x, y, w, h float64, ip ImagePlacement, a Anchor)
 
 	Stroke(path *Path)
 
 	Fill(path *Path)
+
+	BeginElement(st StructType, alt string)
+	EndElement()
+
+	BeginArtifact()
+	EndArtifact()
+
+	BeginLayer(l Layer)
+	EndLayer()
 }
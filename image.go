@@ -0,0 +1,241 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package dox2go
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// DefaultDpi is the resolution assumed for images that
+// have not been assigned one. At 72 dpi one pixel is
+// one point.
+const DefaultDpi float64 = 72.0
+
+// ImagePlacement describes how an image is sized to fit
+// the box it is drawn in.
+type ImagePlacement int32
+
+// These are the available image placements.
+//
+// IP_Stretch scales the image to exactly fill the box,
+// ignoring its aspect ratio.
+//
+// IP_Fit scales the image to the largest size that fits
+// entirely within the box while keeping its aspect ratio.
+//
+// IP_Fill scales the image to the smallest size that covers
+// the whole box while keeping its aspect ratio. The parts
+// of the image outside the box are clipped.
+//
+// IP_Natural draws the image at the size given by its
+// pixel dimensions and resolution.
+const (
+	IP_Stretch ImagePlacement = iota
+	IP_Fit
+	IP_Fill
+	IP_Natural
+)
+
+// Anchor describes where an image is aligned within its
+// box when it does not fill the box exactly.
+type Anchor int32
+
+// These are the available anchors.
+const (
+	AN_Center Anchor = iota
+	AN_Top
+	AN_TopRight
+	AN_Right
+	AN_BottomRight
+	AN_Bottom
+	AN_BottomLeft
+	AN_Left
+	AN_TopLeft
+)
+
+// ImageRect calculates the position and size of an image drawn
+// in the box at x, y with size w, h using the supplied placement
+// and anchor. The box and the result are in the unit pu.
+//
+// The result may extend beyond the box for IP_Fill and
+// IP_Natural placements.
+func ImageRect(i Image, pu PageUnit, x, y, w, h float64, ip ImagePlacement, a Anchor) (ix, iy, iw, ih float64) {
+
+	iw, ih = w, h
+
+	switch ip {
+	case IP_Stretch:
+		return x, y, w, h
+
+	case IP_Fit, IP_Fill:
+		if i.Width() == 0 || i.Height() == 0 {
+			return x, y, w, h
+		}
+		sx := w / float64(i.Width())
+		sy := h / float64(i.Height())
+		var s float64
+		if ip == IP_Fit {
+			s = math.Min(sx, sy)
+		} else {
+			s = math.Max(sx, sy)
+		}
+		iw = float64(i.Width()) * s
+		ih = float64(i.Height()) * s
+
+	case IP_Natural:
+		iw, ih = NaturalSize(i, pu)
+	}
+
+	switch a {
+	case AN_TopLeft, AN_Left, AN_BottomLeft:
+		ix = x
+	case AN_TopRight, AN_Right, AN_BottomRight:
+		ix = x + w - iw
+	default:
+		ix = x + (w-iw)/2
+	}
+
+	switch a {
+	case AN_BottomLeft, AN_Bottom, AN_BottomRight:
+		iy = y
+	case AN_TopLeft, AN_Top, AN_TopRight:
+		iy = y + h - ih
+	default:
+		iy = y + (h-ih)/2
+	}
+
+	return
+}
+
+// NaturalSize returns the size of an image in the unit pu
+// based on its pixel dimensions and resolution.
+func NaturalSize(i Image, pu PageUnit) (w, h float64) {
+	dx, dy := i.Dpi()
+	if dx <= 0 {
+		dx = DefaultDpi
+	}
+	if dy <= 0 {
+		dy = DefaultDpi
+	}
+
+	return ConvertUnit(float64(i.Width())/dx, U_IN, pu),
+		ConvertUnit(float64(i.Height())/dy, U_IN, pu)
+}
+
+// ErrNoDpi is returned by ImageDpi when the image data does not
+// contain any resolution information.
+var ErrNoDpi = errors.New("Image has no resolution information")
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}
+
+// ImageDpi reads the resolution stored in the metadata of a PNG
+// (pHYs chunk) or JPEG (JFIF header) image. The result can be
+// passed to Image.SetDpi.
+func ImageDpi(r io.Reader) (xDpi, yDpi float64, err error) {
+
+	br := bufio.NewReader(r)
+	sig, err := br.Peek(8)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if string(sig) == string(pngSignature) {
+		br.Discard(8)
+		return pngDpi(br)
+	}
+
+	if sig[0] == 0xFF && sig[1] == 0xD8 {
+		br.Discard(2)
+		return jpegDpi(br)
+	}
+
+	return 0, 0, ErrNoDpi
+}
+
+func pngDpi(r *bufio.Reader) (xDpi, yDpi float64, err error) {
+
+	var hdr [8]byte
+	for {
+		if _, err = io.ReadFull(r, hdr[:]); err != nil {
+			return 0, 0, err
+		}
+		length := binary.BigEndian.Uint32(hdr[:4])
+		chunk := string(hdr[4:])
+
+		if chunk == "IDAT" || chunk == "IEND" {
+			return 0, 0, ErrNoDpi
+		}
+
+		if chunk == "pHYs" && length == 9 {
+			var phys [9]byte
+			if _, err = io.ReadFull(r, phys[:]); err != nil {
+				return 0, 0, err
+			}
+			if phys[8] != 1 {
+				// Only the aspect ratio is known.
+				return 0, 0, ErrNoDpi
+			}
+			const inchesPerMetre = 0.0254
+			return float64(binary.BigEndian.Uint32(phys[0:4])) * inchesPerMetre,
+				float64(binary.BigEndian.Uint32(phys[4:8])) * inchesPerMetre,
+				nil
+		}
+
+		// Skip the chunk data and its CRC.
+		if _, err = r.Discard(int(length) + 4); err != nil {
+			return 0, 0, err
+		}
+	}
+}
+
+func jpegDpi(r *bufio.Reader) (xDpi, yDpi float64, err error) {
+
+	var hdr [4]byte
+	for {
+		if _, err = io.ReadFull(r, hdr[:]); err != nil {
+			return 0, 0, err
+		}
+		if hdr[0] != 0xFF {
+			return 0, 0, ErrNoDpi
+		}
+		marker := hdr[1]
+		length := int(binary.BigEndian.Uint16(hdr[2:])) - 2
+
+		// Start of scan; no more headers follow.
+		if marker == 0xDA || length < 0 {
+			return 0, 0, ErrNoDpi
+		}
+
+		if marker == 0xE0 && length >= 12 {
+			app0 := make([]byte, length)
+			if _, err = io.ReadFull(r, app0); err != nil {
+				return 0, 0, err
+			}
+			if string(app0[:5]) != "JFIF\x00" {
+				continue
+			}
+			x := float64(binary.BigEndian.Uint16(app0[8:10]))
+			y := float64(binary.BigEndian.Uint16(app0[10:12]))
+			switch app0[7] {
+			case 1:
+				return x, y, nil
+			case 2:
+				return x * 2.54, y * 2.54, nil
+			}
+			return 0, 0, ErrNoDpi
+		}
+
+		if _, err = r.Discard(length); err != nil {
+			return 0, 0, err
+		}
+	}
+}
@@ -0,0 +1,68 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package dox2go
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+type testImage struct {
+	w, h       int
+	dpiX, dpiY float64
+}
+
+func (i *testImage) Id() int             { return 1 }
+func (i *testImage) Width() int          { return i.w }
+func (i *testImage) Height() int         { return i.h }
+func (i *testImage) Dpi() (x, y float64) { return i.dpiX, i.dpiY }
+func (i *testImage) SetDpi(x, y float64) { i.dpiX, i.dpiY = x, y }
+
+func checkRect(t *testing.T, ip ImagePlacement, a Anchor, ex, ey, ew, eh float64) {
+	i := &testImage{200, 100, 72, 72}
+	x, y, w, h := ImageRect(i, U_PT, 10, 20, 100, 100, ip, a)
+	if x != ex || y != ey || w != ew || h != eh {
+		t.Errorf("Expected %f %f %f %f. Was %f %f %f %f", ex, ey, ew, eh, x, y, w, h)
+	}
+}
+
+func TestImageRect(t *testing.T) {
+
+	checkRect(t, IP_Stretch, AN_TopLeft, 10, 20, 100, 100)
+
+	checkRect(t, IP_Fit, AN_Center, 10, 45, 100, 50)
+	checkRect(t, IP_Fit, AN_Top, 10, 70, 100, 50)
+	checkRect(t, IP_Fit, AN_Bottom, 10, 20, 100, 50)
+
+	checkRect(t, IP_Fill, AN_Center, -40, 20, 200, 100)
+	checkRect(t, IP_Fill, AN_Left, 10, 20, 200, 100)
+	checkRect(t, IP_Fill, AN_Right, -90, 20, 200, 100)
+
+	checkRect(t, IP_Natural, AN_BottomLeft, 10, 20, 200, 100)
+}
+
+func TestImageDpi(t *testing.T) {
+
+	var b bytes.Buffer
+	png.Encode(&b, image.NewGray(image.Rect(0, 0, 1, 1)))
+
+	if _, _, err := ImageDpi(bytes.NewReader(b.Bytes())); err != ErrNoDpi {
+		t.Errorf("Expected ErrNoDpi. Was %v", err)
+	}
+
+	// SOI followed by a JFIF APP0 segment at 300 dpi.
+	jpeg := []byte{0xFF, 0xD8,
+		0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00, 0x01, 0x02,
+		0x01, 0x01, 0x2C, 0x01, 0x2C, 0x00, 0x00}
+
+	x, y, err := ImageDpi(bytes.NewReader(jpeg))
+	if err != nil || x != 300 || y != 300 {
+		t.Errorf("Expected 300 dpi. Was %f %f %v", x, y, err)
+	}
+}
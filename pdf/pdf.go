@@ -9,17 +9,22 @@
 package pdf
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"strings"
+	"unicode/utf16"
 )
 
 const (
 	smallBuf int = iota
 	largeBuf
+	contentBuf
 )
 
 const smallBufSize int = 0x2000
 const largeBufSize int = 0x8000
+const contentBufSize int = 0x1000
 
 ///////////////////////////////////////////////////////////
 
@@ -31,6 +36,12 @@ type pdfObj interface {
 	Type() string
 }
 
+// pdfStreamObj is implemented by objects that may contain a
+// stream.
+type pdfStreamObj interface {
+	hasStream() bool
+}
+
 func startObj(o pdfObj, w io.Writer) (n int64, err error) {
 	n2, err := fmt.Fprintf(w, "%d 0 obj\r\n", o.Id())
 	return int64(n2), err
@@ -43,12 +54,30 @@ func endObj(o pdfObj, w io.Writer) (n int64, err error) {
 
 func startStream(w io.Writer) (n int64, err error) {
 	n2, err := fmt.Fprint(w, "stream\r\n")
+
+	// The data of encrypted streams is collected so that it
+	// can be encrypted once the stream ends.
+	if ow := encryptingWriter(w); ow != nil {
+		ow.stream = new(bytes.Buffer)
+	}
 	return int64(n2), err
 }
 
 func endStream(w io.Writer) (n int64, err error) {
+	if ow := encryptingWriter(w); ow != nil && ow.stream != nil {
+		data, err := encryptData(ow.key, ow.stream.Bytes())
+		ow.stream = nil
+		if err != nil {
+			return 0, err
+		}
+		n2, err := w.Write(data)
+		n = int64(n2)
+		if err != nil {
+			return n, err
+		}
+	}
 	n2, err := fmt.Fprint(w, "\r\nendstream\r\n")
-	return int64(n2), err
+	return n + int64(n2), err
 }
 
 type pdfStructure interface {
@@ -59,6 +88,7 @@ type pdfStructure interface {
 
 	Name(name string)
 	Value(val interface{})
+	String(s string)
 	Ref(o pdfObj)
 	Start()
 	End()
@@ -66,11 +96,26 @@ type pdfStructure interface {
 
 func psName(ps pdfStructure, name string) {
 	if ps.Error() == nil {
-		n, err := fmt.Fprintf(ps.Writer(), " /%s ", name)
+		n, err := fmt.Fprintf(ps.Writer(), " /%s ", escapeName(name))
 		ps.HandleResult(int64(n), err)
 	}
 }
 
+// escapeName replaces the characters of a name that are not
+// allowed in a PDF name with a # and their hexadecimal code.
+func escapeName(name string) string {
+	var b bytes.Buffer
+	for ix := 0; ix < len(name); ix++ {
+		c := name[ix]
+		if c < 0x21 || c > 0x7E || strings.IndexByte("#()<>[]{}/%", c) >= 0 {
+			fmt.Fprintf(&b, "#%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
 func psValue(ps pdfStructure, val interface{}) {
 	if ps.Error() == nil {
 		n, err := fmt.Fprint(ps.Writer(), val)
@@ -78,6 +123,89 @@ func psValue(ps pdfStructure, val interface{}) {
 	}
 }
 
+func psString(ps pdfStructure, s string) {
+	if ps.Error() == nil {
+		if encryptingWriter(ps.Writer()) != nil {
+			psBytes(ps, stringBytes(s))
+			return
+		}
+		n, err := ps.Writer().Write(textString(s))
+		ps.HandleResult(int64(n), err)
+	}
+}
+
+// psBytes writes a string of arbitrary bytes in hexadecimal.
+func psBytes(ps pdfStructure, b []byte) {
+	if ps.Error() == nil {
+		if ow := encryptingWriter(ps.Writer()); ow != nil {
+			data, err := encryptData(ow.key, b)
+			if err != nil {
+				ps.HandleResult(0, err)
+				return
+			}
+			b = data
+		}
+		n, err := fmt.Fprintf(ps.Writer(), " <%X> ", b)
+		ps.HandleResult(int64(n), err)
+	}
+}
+
+func isASCII(s string) bool {
+	for _, c := range s {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// stringBytes returns the bytes of s as a PDF text string
+// before it is escaped; ASCII or UTF-16BE with a byte order mark.
+func stringBytes(s string) []byte {
+	if isASCII(s) {
+		return []byte(s)
+	}
+	b := []byte{0xFE, 0xFF}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	return b
+}
+
+// textString encodes s as a PDF text string. Strings that only
+// contain ASCII characters are written as literal strings, all
+// others as hexadecimal UTF-16BE strings.
+func textString(s string) []byte {
+
+	b := new(bytes.Buffer)
+
+	if isASCII(s) {
+		b.WriteString(" (")
+		for _, c := range s {
+			escaped := false
+			for eIx, ec := range charsToEscape {
+				if c == ec {
+					b.WriteByte(escapeChar)
+					b.WriteByte(escapedChars[eIx])
+					escaped = true
+				}
+			}
+			if !escaped {
+				b.WriteRune(c)
+			}
+		}
+		b.WriteString(") ")
+		return b.Bytes()
+	}
+
+	b.WriteString(" <FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(b, "%04X", u)
+	}
+	b.WriteString("> ")
+	return b.Bytes()
+}
+
 func psRef(ps pdfStructure, o pdfObj) {
 	if ps.Error() == nil {
 		n, err := fmt.Fprintf(ps.Writer(), " %d 0 R", o.Id())
@@ -118,6 +246,14 @@ func (self *dictionaryWriter) Value(val interface{}) {
 	psValue(self, val)
 }
 
+func (self *dictionaryWriter) String(s string) {
+	psString(self, s)
+}
+
+func (self *dictionaryWriter) Bytes(b []byte) {
+	psBytes(self, b)
+}
+
 func (self *dictionaryWriter) Ref(o pdfObj) {
 	psRef(self, o)
 }
@@ -163,6 +299,14 @@ func (self *arrayWriter) Value(val interface{}) {
 	psValue(self, val)
 }
 
+func (self *arrayWriter) String(s string) {
+	psString(self, s)
+}
+
+func (self *arrayWriter) Bytes(b []byte) {
+	psBytes(self, b)
+}
+
 func (self *arrayWriter) Ref(o pdfObj) {
 	psRef(self, o)
 }
@@ -0,0 +1,597 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/adkennan/dox2go"
+)
+
+// Field flags as written to the Ff entry of a field.
+const (
+	ffReadOnly      = 1 << 0
+	ffRequired      = 1 << 1
+	ffMultiline     = 1 << 12
+	ffNoToggleToOff = 1 << 14
+	ffRadio         = 1 << 15
+	ffPushButton    = 1 << 16
+	ffCombo         = 1 << 17
+)
+
+// The name of the on state of check boxes.
+const checkBoxOn = "Yes"
+
+// pdfAcroForm is the interactive form dictionary of the
+// document. It is only added to the catalog once a field
+// has been added to a page.
+type pdfAcroForm struct {
+	id              int
+	fields          []pdfObj
+	radios          map[string]*pdfField
+	fonts           []*pdfTypeFace
+	needAppearances bool
+	sigFlags        int
+
+	// The fonts of the forms of appended documents.
+	imported Dict
+}
+
+// acroForm returns the interactive form dictionary of the
+// document, adding it to the catalog if necessary.
+func (doc *pdfDoc) acroForm() *pdfAcroForm {
+	if doc.form == nil {
+		doc.form = &pdfAcroForm{
+			len(doc.objs) + 1,
+			make([]pdfObj, 0, 4),
+			make(map[string]*pdfField),
+			make([]*pdfTypeFace, 0, 2),
+			false,
+			0,
+			make(Dict),
+		}
+		doc.objs = append(doc.objs, doc.form)
+		doc.catalog.objs = append(doc.catalog.objs, doc.form)
+	}
+	return doc.form
+}
+
+func (af *pdfAcroForm) Id() int {
+	return af.id
+}
+
+func (af *pdfAcroForm) Type() string {
+	return "AcroForm"
+}
+
+func (af *pdfAcroForm) addFont(tf *pdfTypeFace) {
+	for _, f := range af.fonts {
+		if f == tf {
+			return
+		}
+	}
+	af.fonts = append(af.fonts, tf)
+}
+
+// hasField reports whether the form has a field with the
+// given name.
+func (af *pdfAcroForm) hasField(name string) bool {
+	for _, f := range af.fields {
+		switch v := f.(type) {
+		case *pdfField:
+			if v.f.Name == name {
+				return true
+			}
+		case *pdfImportedObj:
+			d, _ := v.obj.(Dict)
+			if t, ok := d["T"].(String); ok && decodeText(t) == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (af *pdfAcroForm) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(af, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	aw := arrayWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Fields")
+	aw.Start()
+	for _, f := range af.fields {
+		aw.Ref(f)
+	}
+	aw.End()
+	dw.Name("DR")
+	dw.Start()
+	dw.Name("Font")
+	dw.Start()
+	for _, f := range af.fonts {
+		dw.Value("/F")
+		dw.Value(f.Id())
+		dw.Value(" ")
+		dw.Ref(f)
+	}
+	// Imported fonts are never given the names of the fonts
+	// created in the document.
+	keys := make([]string, 0, len(af.imported))
+	for k := range af.imported {
+		keys = append(keys, string(k))
+	}
+	sortNames(keys)
+	for _, k := range keys {
+		psName(&dw, k)
+		psObject(&dw, af.imported[Name(k)])
+	}
+	dw.End()
+	dw.End()
+
+	// Ask viewers to regenerate appearances that could not be
+	// drawn accurately.
+	if af.needAppearances {
+		dw.Name("NeedAppearances")
+		dw.Value("true")
+	}
+	if af.sigFlags != 0 {
+		dw.Name("SigFlags")
+		dw.Value(af.sigFlags)
+	}
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	if aw.err != nil {
+		return n, aw.err
+	}
+	n += dw.n + aw.n
+
+	n2, err := endObj(af, w)
+	n += int64(n2)
+	return n, err
+}
+
+func (p *pdfPage) AddField(x, y, w, h float64, f dox2go.FormField) {
+
+	doc := p.doc
+	af := doc.acroForm()
+
+	font, ok := f.Font.(*pdfFont)
+	if !ok {
+		font = doc.CreateFont(FONT_Helvetica, dox2go.FS_Regular,
+			dox2go.ConvertUnit(12, dox2go.U_PT, p.pu)).(*pdfFont)
+	}
+	if f.Type == dox2go.FT_CheckBox || f.Type == dox2go.FT_Radio {
+		font = doc.CreateFont(FONT_ZapfDingbats, dox2go.FS_Regular, 0).(*pdfFont)
+	}
+	af.addFont(font.face)
+
+	if !isASCII(f.Value) || !isASCII(strings.Join(f.Options, "")) {
+		af.needAppearances = true
+	}
+
+	fld := &pdfField{
+		len(doc.objs) + 1,
+		p,
+		nil,
+		nil,
+		f,
+		font,
+		p.pageQuad(x, y, w, h).bounds(),
+		nil,
+		nil,
+		"",
+	}
+
+	switch f.Type {
+	case dox2go.FT_CheckBox:
+		fld.state = checkBoxOn
+
+	case dox2go.FT_Radio:
+		group := af.radios[f.Name]
+		if group == nil {
+			group = &pdfField{
+				len(doc.objs) + 1,
+				nil,
+				nil,
+				make([]*pdfField, 0, 2),
+				dox2go.FormField{Type: dox2go.FT_Radio, Name: f.Name, Flags: f.Flags},
+				nil,
+				rect{},
+				nil,
+				nil,
+				"",
+			}
+			doc.objs = append(doc.objs, group)
+			af.radios[f.Name] = group
+			af.fields = append(af.fields, group)
+			fld.id++
+		}
+
+		// The appearance of a button is named by its value,
+		// or by its position in the group when it has none.
+		fld.state = f.Value
+		if fld.state == "" {
+			fld.state = fmt.Sprintf("Choice%d", len(group.kids)+1)
+		}
+		if f.Checked {
+			group.f.Value = fld.state
+		}
+		fld.parent = group
+		group.kids = append(group.kids, fld)
+	}
+
+	if fld.parent == nil {
+		af.fields = append(af.fields, fld)
+	}
+	p.addAnnot(fld)
+
+	fld.drawAppearances()
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfField is an interactive form field. Apart from radio
+// button groups, whose buttons are the group's kids, each
+// field is combined with the widget annotation that shows it
+// on the page.
+type pdfField struct {
+	id     int
+	page   *pdfPage
+	parent *pdfField
+	kids   []*pdfField
+	f      dox2go.FormField
+	font   *pdfFont
+	r      rect
+	on     *pdfFormXObj
+	off    *pdfFormXObj
+	state  string
+}
+
+func (fld *pdfField) Id() int {
+	return fld.id
+}
+
+func (fld *pdfField) Type() string {
+	return "Annot"
+}
+
+// da returns the default appearance string used by viewers
+// to draw the field's text.
+func (fld *pdfField) da() string {
+	size := dox2go.ConvertUnit(fld.font.size, fld.page.pu, dox2go.U_PT)
+	return fmt.Sprintf("/F%d %f Tf 0 g", fld.font.face.id, size)
+}
+
+func (fld *pdfField) flags() int {
+	ff := 0
+	if fld.f.Flags&dox2go.FF_ReadOnly != 0 {
+		ff |= ffReadOnly
+	}
+	if fld.f.Flags&dox2go.FF_Required != 0 {
+		ff |= ffRequired
+	}
+	switch fld.f.Type {
+	case dox2go.FT_Text:
+		if fld.f.Flags&dox2go.FF_Multiline != 0 {
+			ff |= ffMultiline
+		}
+	case dox2go.FT_Radio:
+		ff |= ffRadio | ffNoToggleToOff
+	case dox2go.FT_ComboBox:
+		ff |= ffCombo
+	case dox2go.FT_PushButton:
+		ff |= ffPushButton
+	}
+	return ff
+}
+
+func fieldType(ft dox2go.FieldType) string {
+	switch ft {
+	case dox2go.FT_Text:
+		return "Tx"
+	case dox2go.FT_ComboBox, dox2go.FT_ListBox:
+		return "Ch"
+	}
+	return "Btn"
+}
+
+func (fld *pdfField) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(fld, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	aw := arrayWriter{w, 0, nil}
+	dw.Start()
+
+	if fld.page != nil {
+		dw.Name("Type")
+		dw.Name(fld.Type())
+		dw.Name("Subtype")
+		dw.Name("Widget")
+		dw.Name("Rect")
+		fld.r.write(&dw)
+		dw.Name("P")
+		dw.Ref(fld.page)
+		dw.Name("F")
+		dw.Value(4)
+		dw.Name("DA")
+		dw.String(fld.da())
+		fld.writeMK(&dw)
+		fld.writeAP(&dw)
+	}
+
+	if fld.parent != nil {
+		dw.Name("Parent")
+		dw.Ref(fld.parent)
+	} else {
+		dw.Name("FT")
+		dw.Name(fieldType(fld.f.Type))
+		dw.Name("T")
+		dw.String(fld.f.Name)
+		dw.Name("Ff")
+		dw.Value(fld.flags())
+		fld.writeValue(&dw, "V")
+		fld.writeValue(&dw, "DV")
+	}
+
+	if fld.f.MaxLen > 0 && fld.f.Type == dox2go.FT_Text {
+		dw.Name("MaxLen")
+		dw.Value(fld.f.MaxLen)
+	}
+
+	if len(fld.f.Options) > 0 &&
+		(fld.f.Type == dox2go.FT_ComboBox || fld.f.Type == dox2go.FT_ListBox) {
+		dw.Name("Opt")
+		aw.Start()
+		for _, o := range fld.f.Options {
+			aw.String(o)
+		}
+		aw.End()
+	}
+
+	if len(fld.kids) > 0 {
+		dw.Name("Kids")
+		aw.Start()
+		for _, k := range fld.kids {
+			aw.Ref(k)
+		}
+		aw.End()
+	}
+
+	if fld.f.Type == dox2go.FT_PushButton && fld.f.URI != "" {
+		dw.Name("A")
+		dw.Start()
+		dw.Name("S")
+		dw.Name("URI")
+		dw.Name("URI")
+		dw.String(fld.f.URI)
+		dw.End()
+	}
+
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	if aw.err != nil {
+		return n, aw.err
+	}
+	n += dw.n + aw.n
+
+	n2, err := endObj(fld, w)
+	n += int64(n2)
+	return n, err
+}
+
+func (fld *pdfField) writeValue(dw *dictionaryWriter, key string) {
+	switch fld.f.Type {
+	case dox2go.FT_Text, dox2go.FT_ComboBox, dox2go.FT_ListBox:
+		dw.Name(key)
+		dw.String(fld.f.Value)
+	case dox2go.FT_CheckBox:
+		dw.Name(key)
+		if fld.f.Checked {
+			dw.Name(checkBoxOn)
+		} else {
+			dw.Name("Off")
+		}
+	case dox2go.FT_Radio:
+		dw.Name(key)
+		if fld.f.Value != "" {
+			dw.Name(fld.f.Value)
+		} else {
+			dw.Name("Off")
+		}
+	}
+}
+
+// writeMK writes the appearance characteristics viewers use
+// when regenerating the field's appearance.
+func (fld *pdfField) writeMK(dw *dictionaryWriter) {
+	dw.Name("MK")
+	dw.Start()
+	dw.Name("BC")
+	dw.Value("[0 0 0]")
+	dw.Name("BG")
+	switch fld.f.Type {
+	case dox2go.FT_PushButton:
+		dw.Value("[0.75 0.75 0.75]")
+		dw.Name("CA")
+		dw.String(fld.f.Value)
+	case dox2go.FT_CheckBox:
+		dw.Value("[1 1 1]")
+		dw.Name("CA")
+		dw.String("4")
+	case dox2go.FT_Radio:
+		dw.Value("[1 1 1]")
+		dw.Name("CA")
+		dw.String("l")
+	default:
+		dw.Value("[1 1 1]")
+	}
+	dw.End()
+}
+
+func (fld *pdfField) writeAP(dw *dictionaryWriter) {
+	dw.Name("AP")
+	dw.Start()
+	dw.Name("N")
+	if fld.off == nil {
+		dw.Ref(fld.on)
+	} else {
+		dw.Start()
+		dw.Name(fld.state)
+		dw.Ref(fld.on)
+		dw.Name("Off")
+		dw.Ref(fld.off)
+		dw.End()
+	}
+	dw.End()
+
+	if fld.off != nil {
+		dw.Name("AS")
+		if fld.f.Checked {
+			dw.Name(fld.state)
+		} else {
+			dw.Name("Off")
+		}
+	}
+}
+
+///////////////////////////////////////////////////////////
+
+var (
+	black     = dox2go.RGB(0, 0, 0)
+	white     = dox2go.RGB(255, 255, 255)
+	lightGray = dox2go.RGB(191, 191, 191)
+	highlight = dox2go.RGB(153, 193, 218)
+)
+
+// drawAppearances creates the appearance streams of a
+// widget. Check boxes and radio buttons have an appearance
+// for both their on and off states.
+func (fld *pdfField) drawAppearances() {
+
+	pu := fld.page.pu
+	w := dox2go.ConvertUnit(fld.r[2]-fld.r[0], dox2go.U_PT, pu)
+	h := dox2go.ConvertUnit(fld.r[3]-fld.r[1], dox2go.U_PT, pu)
+
+	fld.on = fld.page.doc.newFormXObj(pu, w, h)
+	fld.drawAppearance(fld.on.sfc, w, h, true)
+
+	if fld.f.Type == dox2go.FT_CheckBox || fld.f.Type == dox2go.FT_Radio {
+		fld.off = fld.page.doc.newFormXObj(pu, w, h)
+		fld.drawAppearance(fld.off.sfc, w, h, false)
+	}
+}
+
+func (fld *pdfField) drawAppearance(s *pdfSurface, w, h float64, on bool) {
+
+	lw := dox2go.ConvertUnit(1, dox2go.U_PT, s.u)
+	pad := 2 * lw
+	size := fld.font.size
+
+	if fld.f.Type == dox2go.FT_Radio {
+		r := math.Min(w, h) / 2
+		p := dox2go.NewPath()
+		p.Arc(w/2, h/2, r-lw/2, 0, 2*math.Pi)
+		s.Bg(white)
+		s.Fill(p)
+		s.LineWidth(lw)
+		s.Fg(black)
+		s.Stroke(p)
+		if on {
+			p = dox2go.NewPath()
+			p.Arc(w/2, h/2, r/2, 0, 2*math.Pi)
+			s.Bg(black)
+			s.Fill(p)
+		}
+		return
+	}
+
+	bg := white
+	if fld.f.Type == dox2go.FT_PushButton {
+		bg = lightGray
+	}
+
+	p := dox2go.NewPath()
+	p.Rect(0, 0, w, h)
+	s.Bg(bg)
+	s.Fill(p)
+	p = dox2go.NewPath()
+	p.Rect(lw/2, lw/2, w-lw/2, h-lw/2)
+	s.LineWidth(lw)
+	s.Fg(black)
+	s.Stroke(p)
+
+	switch fld.f.Type {
+	case dox2go.FT_CheckBox:
+		if on {
+			size = 0.8 * h
+			f := &pdfFont{fld.font.face, size}
+			s.Bg(black)
+			s.Text(f, (w-0.76*size)/2, (h-0.7*size)/2, "4")
+		}
+		return
+
+	case dox2go.FT_PushButton:
+		// Without font metrics the caption is centered
+		// using an average character width.
+		tw := 0.5 * size * float64(len([]rune(fld.f.Value)))
+		s.Bg(black)
+		s.Text(fld.font, (w-tw)/2, (h-size)/2+0.22*size, fld.f.Value)
+		return
+	}
+
+	fmt.Fprint(s.w, "/Tx BMC\r\n")
+	s.PushState()
+	s.clipRect(lw, lw, w-2*lw, h-2*lw)
+
+	leading := 1.15 * size
+
+	switch {
+	case fld.f.Type == dox2go.FT_ListBox:
+		for ix, o := range fld.f.Options {
+			top := h - pad - float64(ix)*leading
+			if o == fld.f.Value {
+				p = dox2go.NewPath()
+				p.Rect(lw, top-leading, w-lw, top)
+				s.Bg(highlight)
+				s.Fill(p)
+			}
+			s.Bg(black)
+			s.Text(fld.font, pad, top-size, o)
+			s.endText()
+		}
+
+	case fld.f.Type == dox2go.FT_Text && fld.f.Flags&dox2go.FF_Multiline != 0:
+		s.Bg(black)
+		for ix, l := range strings.Split(fld.f.Value, "\n") {
+			s.Text(fld.font, pad, h-pad-size-float64(ix)*leading, l)
+			s.endText()
+		}
+
+	default:
+		s.Bg(black)
+		s.Text(fld.font, pad, (h-size)/2+0.22*size, fld.f.Value)
+	}
+
+	s.PopState()
+	fmt.Fprint(s.w, "EMC\r\n")
+}
@@ -0,0 +1,80 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/adkennan/dox2go"
+)
+
+func checkFieldFlags(t *testing.T, f dox2go.FormField, expected int) {
+	fld := &pdfField{f: f}
+	v := fld.flags()
+	if v != expected {
+		t.Errorf("Expected %d. Was %d", expected, v)
+	}
+}
+
+func TestFieldFlags(t *testing.T) {
+
+	checkFieldFlags(t, dox2go.FormField{Type: dox2go.FT_Text}, 0)
+	checkFieldFlags(t, dox2go.FormField{Type: dox2go.FT_Text,
+		Flags: dox2go.FF_Multiline | dox2go.FF_Required}, ffMultiline|ffRequired)
+	checkFieldFlags(t, dox2go.FormField{Type: dox2go.FT_CheckBox,
+		Flags: dox2go.FF_Multiline}, 0)
+	checkFieldFlags(t, dox2go.FormField{Type: dox2go.FT_Radio,
+		Flags: dox2go.FF_ReadOnly}, ffRadio|ffNoToggleToOff|ffReadOnly)
+	checkFieldFlags(t, dox2go.FormField{Type: dox2go.FT_ComboBox}, ffCombo)
+	checkFieldFlags(t, dox2go.FormField{Type: dox2go.FT_ListBox}, 0)
+	checkFieldFlags(t, dox2go.FormField{Type: dox2go.FT_PushButton}, ffPushButton)
+}
+
+func TestButtonAppearances(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	p := d.CreatePage(dox2go.U_PT, 200, 200, dox2go.PO_Portrait)
+	p.AddField(10, 10, 20, 20, dox2go.FormField{Type: dox2go.FT_CheckBox, Name: "A", Checked: true})
+	p.AddField(40, 10, 20, 20, dox2go.FormField{Type: dox2go.FT_CheckBox, Name: "B"})
+	p.AddField(70, 10, 20, 20, dox2go.FormField{Type: dox2go.FT_Radio, Name: "C", Value: "One"})
+	p.AddField(100, 10, 20, 20, dox2go.FormField{Type: dox2go.FT_Radio, Name: "C", Checked: true})
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := readPdf(t, b.Bytes())
+	page, _ := r.Page(0)
+	annots, _ := r.resolveArray(page.Dict()["Annots"])
+	expected := []struct{ on, as Name }{
+		{"Yes", "Yes"},
+		{"Yes", "Off"},
+		{"One", "Off"},
+		{"Choice2", "Choice2"},
+	}
+	if len(annots) != len(expected) {
+		t.Fatalf("Expected %d widgets. Was %d", len(expected), len(annots))
+	}
+	for ix, e := range expected {
+		w, _ := r.resolveDict(annots[ix])
+		ap, _ := r.resolveDict(w["AP"])
+		n, _ := r.resolveDict(ap["N"])
+		if len(n) != 2 || n[e.on] == nil || n["Off"] == nil {
+			t.Errorf("Expected appearances %s and Off. Was %v", e.on, n)
+		}
+		if w["AS"] != e.as {
+			t.Errorf("Expected state %s. Was %v", e.as, w["AS"])
+		}
+	}
+
+	w, _ := r.resolveDict(annots[3])
+	group, _ := r.resolveDict(w["Parent"])
+	if group["V"] != Name("Choice2") {
+		t.Errorf("Expected the group's value to be Choice2. Was %v", group["V"])
+	}
+}
@@ -0,0 +1,173 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"io"
+	"math"
+
+	"github.com/adkennan/dox2go"
+)
+
+// quad is a quadrilateral in default user space described
+// by its four corners in counterclockwise order.
+type quad [8]float64
+
+// pageQuad transforms the rectangle at x, y with size w, h, in
+// the page's unit, by the current transformation of the page's
+// surface.
+func (p *pdfPage) pageQuad(x, y, w, h float64) quad {
+
+	sfc := p.Surface().(*pdfSurface)
+
+	x1 := dox2go.ConvertUnit(x, p.pu, dox2go.U_PT)
+	y1 := dox2go.ConvertUnit(y, p.pu, dox2go.U_PT)
+	x2 := dox2go.ConvertUnit(x+w, p.pu, dox2go.U_PT)
+	y2 := dox2go.ConvertUnit(y+h, p.pu, dox2go.U_PT)
+
+	var q quad
+	q[0], q[1] = sfc.ctm.transform(x1, y1)
+	q[2], q[3] = sfc.ctm.transform(x2, y1)
+	q[4], q[5] = sfc.ctm.transform(x2, y2)
+	q[6], q[7] = sfc.ctm.transform(x1, y2)
+	return q
+}
+
+// rect is a rectangle in default user space described by
+// its lower left and upper right corners.
+type rect [4]float64
+
+// bounds returns the smallest rectangle that contains the quad.
+func (q quad) bounds() rect {
+	r := rect{q[0], q[1], q[0], q[1]}
+	for ix := 2; ix < len(q); ix += 2 {
+		r[0] = math.Min(r[0], q[ix])
+		r[1] = math.Min(r[1], q[ix+1])
+		r[2] = math.Max(r[2], q[ix])
+		r[3] = math.Max(r[3], q[ix+1])
+	}
+	return r
+}
+
+// rectangular reports whether the quad is an upright rectangle.
+func (q quad) rectangular() bool {
+	return q[1] == q[3] && q[2] == q[4] && q[5] == q[7] && q[6] == q[0]
+}
+
+func (r rect) write(ps pdfStructure) {
+	aw := arrayWriter{ps.Writer(), 0, nil}
+	aw.Start()
+	aw.Value(r[0])
+	aw.Value(" ")
+	aw.Value(r[1])
+	aw.Value(" ")
+	aw.Value(r[2])
+	aw.Value(" ")
+	aw.Value(r[3])
+	aw.End()
+	ps.HandleResult(aw.n, aw.err)
+}
+
+func (p *pdfPage) addAnnot(a pdfObj) {
+	p.annots = append(p.annots, a)
+	p.doc.objs = append(p.doc.objs, a)
+}
+
+func (p *pdfPage) LinkURI(x, y, w, h float64, uri string) {
+	p.addAnnot(&pdfLinkAnnot{len(p.doc.objs) + 1, p.pageQuad(x, y, w, h), uri, nil, ""})
+}
+
+func (p *pdfPage) LinkPage(x, y, w, h float64, target dox2go.Page, fit dox2go.PageFit) {
+	if tp, ok := target.(*pdfPage); ok {
+		p.addAnnot(&pdfLinkAnnot{len(p.doc.objs) + 1, p.pageQuad(x, y, w, h), "", fitDest(tp, fit), ""})
+	}
+}
+
+func (p *pdfPage) LinkDestination(x, y, w, h float64, name string) {
+	p.addAnnot(&pdfLinkAnnot{len(p.doc.objs) + 1, p.pageQuad(x, y, w, h), "", nil, name})
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfLinkAnnot is a link annotation. Its target is either
+// a URI, an explicit destination or a named destination.
+type pdfLinkAnnot struct {
+	id   int
+	q    quad
+	uri  string
+	dest *pdfDest
+	name string
+}
+
+func (a *pdfLinkAnnot) Id() int {
+	return a.id
+}
+
+func (a *pdfLinkAnnot) Type() string {
+	return "Annot"
+}
+
+func (a *pdfLinkAnnot) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(a, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	aw := arrayWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(a.Type())
+	dw.Name("Subtype")
+	dw.Name("Link")
+	dw.Name("Rect")
+	a.q.bounds().write(&dw)
+	dw.Name("F")
+	dw.Value(4)
+	if !a.q.rectangular() {
+		dw.Name("QuadPoints")
+		aw.Start()
+		for _, v := range a.q {
+			aw.Value(v)
+			aw.Value(" ")
+		}
+		aw.End()
+	}
+	dw.Name("Border")
+	dw.Value("[0 0 0]")
+
+	switch {
+	case a.dest != nil:
+		dw.Name("Dest")
+		a.dest.write(&dw)
+	case a.name != "":
+		dw.Name("Dest")
+		dw.String(a.name)
+	default:
+		dw.Name("A")
+		dw.Start()
+		dw.Name("S")
+		dw.Name("URI")
+		dw.Name("URI")
+		dw.String(a.uri)
+		dw.End()
+	}
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	if aw.err != nil {
+		return n, aw.err
+	}
+	n += dw.n + aw.n
+
+	n2, err := endObj(a, w)
+	n += int64(n2)
+	return n, err
+}
@@ -0,0 +1,49 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	d2g "github.com/adkennan/dox2go"
+)
+
+func checkQuad(t *testing.T, q quad, expected quad) {
+	for ix := range q {
+		if math.Abs(q[ix]-expected[ix]) > 0.0001 {
+			t.Errorf("Expected %v. Was %v", expected, q)
+			return
+		}
+	}
+}
+
+func TestPageQuad(t *testing.T) {
+	var b bytes.Buffer
+
+	d := NewPdfDoc(&b)
+	p := d.CreatePage(d2g.U_PT, 600, 800, d2g.PO_Portrait).(*pdfPage)
+	s := p.Surface()
+
+	checkQuad(t, p.pageQuad(10, 20, 30, 40), quad{10, 20, 40, 20, 40, 60, 10, 60})
+
+	s.PushState()
+	s.Translate(100, 100)
+	s.Scale(2, 2)
+	checkQuad(t, p.pageQuad(10, 20, 30, 40), quad{120, 140, 180, 140, 180, 220, 120, 220})
+
+	s.Rotate(math.Pi / 2)
+	q := p.pageQuad(0, 0, 10, 10)
+	checkQuad(t, q, quad{100, 100, 100, 120, 80, 120, 80, 100})
+	if q.rectangular() {
+		t.Errorf("Expected rotated quad not to be rectangular.")
+	}
+	s.PopState()
+
+	checkQuad(t, p.pageQuad(10, 20, 30, 40), quad{10, 20, 40, 20, 40, 60, 10, 60})
+}
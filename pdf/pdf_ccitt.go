@@ -0,0 +1,201 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+// This file implements a CCITT Group 4 (ITU-T T.6) encoder
+// for bilevel images written with the CCITTFaxDecode filter.
+
+type ccittCode struct {
+	bits uint32
+	len  uint
+}
+
+// Two dimensional coding mode codes.
+var (
+	ccittPass       = ccittCode{0x1, 4}
+	ccittHorizontal = ccittCode{0x1, 3}
+	ccittEOFB       = ccittCode{0x001001, 24}
+)
+
+// Vertical mode codes for a1 - b1 from -3 to 3.
+var ccittVertical = [7]ccittCode{
+	{0x02, 7}, {0x02, 6}, {0x2, 3}, {0x1, 1}, {0x3, 3}, {0x03, 6}, {0x03, 7},
+}
+
+// Terminating codes for run lengths 0 to 63.
+var ccittWhiteTerm = [64]ccittCode{
+	{0x35, 8}, {0x07, 6}, {0x7, 4}, {0x8, 4}, {0xB, 4}, {0xC, 4}, {0xE, 4}, {0xF, 4},
+	{0x13, 5}, {0x14, 5}, {0x07, 5}, {0x08, 5}, {0x08, 6}, {0x03, 6}, {0x34, 6}, {0x35, 6},
+	{0x2A, 6}, {0x2B, 6}, {0x27, 7}, {0x0C, 7}, {0x08, 7}, {0x17, 7}, {0x03, 7}, {0x04, 7},
+	{0x28, 7}, {0x2B, 7}, {0x13, 7}, {0x24, 7}, {0x18, 7}, {0x02, 8}, {0x03, 8}, {0x1A, 8},
+	{0x1B, 8}, {0x12, 8}, {0x13, 8}, {0x14, 8}, {0x15, 8}, {0x16, 8}, {0x17, 8}, {0x28, 8},
+	{0x29, 8}, {0x2A, 8}, {0x2B, 8}, {0x2C, 8}, {0x2D, 8}, {0x04, 8}, {0x05, 8}, {0x0A, 8},
+	{0x0B, 8}, {0x52, 8}, {0x53, 8}, {0x54, 8}, {0x55, 8}, {0x24, 8}, {0x25, 8}, {0x58, 8},
+	{0x59, 8}, {0x5A, 8}, {0x5B, 8}, {0x4A, 8}, {0x4B, 8}, {0x32, 8}, {0x33, 8}, {0x34, 8},
+}
+
+var ccittBlackTerm = [64]ccittCode{
+	{0x37, 10}, {0x2, 3}, {0x3, 2}, {0x2, 2}, {0x3, 3}, {0x3, 4}, {0x2, 4}, {0x3, 5},
+	{0x5, 6}, {0x4, 6}, {0x4, 7}, {0x5, 7}, {0x7, 7}, {0x4, 8}, {0x7, 8}, {0x18, 9},
+	{0x17, 10}, {0x18, 10}, {0x08, 10}, {0x67, 11}, {0x68, 11}, {0x6C, 11}, {0x37, 11}, {0x28, 11},
+	{0x17, 11}, {0x18, 11}, {0xCA, 12}, {0xCB, 12}, {0xCC, 12}, {0xCD, 12}, {0x68, 12}, {0x69, 12},
+	{0x6A, 12}, {0x6B, 12}, {0xD2, 12}, {0xD3, 12}, {0xD4, 12}, {0xD5, 12}, {0xD6, 12}, {0xD7, 12},
+	{0x6C, 12}, {0x6D, 12}, {0xDA, 12}, {0xDB, 12}, {0x54, 12}, {0x55, 12}, {0x56, 12}, {0x57, 12},
+	{0x64, 12}, {0x65, 12}, {0x52, 12}, {0x53, 12}, {0x24, 12}, {0x37, 12}, {0x38, 12}, {0x27, 12},
+	{0x28, 12}, {0x58, 12}, {0x59, 12}, {0x2B, 12}, {0x2C, 12}, {0x5A, 12}, {0x66, 12}, {0x67, 12},
+}
+
+// Make up codes for run lengths 64 to 1728 in steps of 64.
+var ccittWhiteMakeUp = [27]ccittCode{
+	{0x1B, 5}, {0x12, 5}, {0x17, 6}, {0x37, 7}, {0x36, 8}, {0x37, 8}, {0x64, 8}, {0x65, 8},
+	{0x68, 8}, {0x67, 8}, {0xCC, 9}, {0xCD, 9}, {0xD2, 9}, {0xD3, 9}, {0xD4, 9}, {0xD5, 9},
+	{0xD6, 9}, {0xD7, 9}, {0xD8, 9}, {0xD9, 9}, {0xDA, 9}, {0xDB, 9}, {0x98, 9}, {0x99, 9},
+	{0x9A, 9}, {0x18, 6}, {0x9B, 9},
+}
+
+var ccittBlackMakeUp = [27]ccittCode{
+	{0x0F, 10}, {0xC8, 12}, {0xC9, 12}, {0x5B, 12}, {0x33, 12}, {0x34, 12}, {0x35, 12}, {0x6C, 13},
+	{0x6D, 13}, {0x4A, 13}, {0x4B, 13}, {0x4C, 13}, {0x4D, 13}, {0x72, 13}, {0x73, 13}, {0x74, 13},
+	{0x75, 13}, {0x76, 13}, {0x77, 13}, {0x52, 13}, {0x53, 13}, {0x54, 13}, {0x55, 13}, {0x5A, 13},
+	{0x5B, 13}, {0x64, 13}, {0x65, 13},
+}
+
+// Make up codes shared by both colors for run lengths 1792 to 2560.
+var ccittExtMakeUp = [13]ccittCode{
+	{0x08, 11}, {0x0C, 11}, {0x0D, 11}, {0x12, 12}, {0x13, 12}, {0x14, 12}, {0x15, 12},
+	{0x16, 12}, {0x17, 12}, {0x1C, 12}, {0x1D, 12}, {0x1E, 12}, {0x1F, 12},
+}
+
+type ccittBitWriter struct {
+	out   []byte
+	acc   uint32
+	nbits uint
+}
+
+func (bw *ccittBitWriter) write(c ccittCode) {
+	for ix := c.len; ix > 0; ix-- {
+		bw.acc = bw.acc<<1 | (c.bits>>(ix-1))&1
+		bw.nbits++
+		if bw.nbits == 8 {
+			bw.out = append(bw.out, byte(bw.acc))
+			bw.acc = 0
+			bw.nbits = 0
+		}
+	}
+}
+
+func (bw *ccittBitWriter) flush() {
+	if bw.nbits > 0 {
+		bw.out = append(bw.out, byte(bw.acc<<(8-bw.nbits)))
+		bw.acc = 0
+		bw.nbits = 0
+	}
+}
+
+func (bw *ccittBitWriter) writeRun(run int, black bool) {
+
+	term, makeUp := &ccittWhiteTerm, &ccittWhiteMakeUp
+	if black {
+		term, makeUp = &ccittBlackTerm, &ccittBlackMakeUp
+	}
+
+	for run > 2560 {
+		bw.write(ccittExtMakeUp[len(ccittExtMakeUp)-1])
+		run -= 2560
+	}
+	if run >= 1792 {
+		bw.write(ccittExtMakeUp[run/64-28])
+		run %= 64
+	} else if run >= 64 {
+		bw.write(makeUp[run/64-1])
+		run %= 64
+	}
+	bw.write(term[run])
+}
+
+// nextChange returns the position of the first changing element
+// in line after pos. A changing element is a pixel whose color
+// differs from the pixel before it. The pixel before the start of
+// a line is white. If there are no more changes the width of the
+// line is returned.
+func nextChange(line []byte, pos int) int {
+	prev := byte(0)
+	if pos >= 0 {
+		prev = line[pos]
+	}
+	for x := pos + 1; x < len(line); x++ {
+		if line[x] != prev {
+			return x
+		}
+	}
+	return len(line)
+}
+
+// ccittG4Encode encodes a bilevel image using CCITT Group 4
+// compression. pix holds one byte per pixel, row by row, with
+// 1 for black and 0 for white.
+func ccittG4Encode(pix []byte, width, height int) []byte {
+
+	bw := &ccittBitWriter{make([]byte, 0, len(pix)/16+8), 0, 0}
+
+	ref := make([]byte, width)
+
+	for y := 0; y < height; y++ {
+		line := pix[y*width : (y+1)*width]
+
+		a0 := -1
+		color := byte(0)
+
+		for a0 < width {
+
+			a1 := nextChange(line, a0)
+
+			b1 := nextChange(ref, a0)
+			if b1 < width && ref[b1] == color {
+				b1 = nextChange(ref, b1)
+			}
+			b2 := width
+			if b1 < width {
+				b2 = nextChange(ref, b1)
+			}
+
+			if b2 < a1 {
+				bw.write(ccittPass)
+				a0 = b2
+				continue
+			}
+
+			if d := a1 - b1; d >= -3 && d <= 3 {
+				bw.write(ccittVertical[d+3])
+				a0 = a1
+				color ^= 1
+				continue
+			}
+
+			a2 := width
+			if a1 < width {
+				a2 = nextChange(line, a1)
+			}
+			start := a0
+			if start < 0 {
+				start = 0
+			}
+			bw.write(ccittHorizontal)
+			bw.writeRun(a1-start, color == 1)
+			bw.writeRun(a2-a1, color == 0)
+			a0 = a2
+		}
+
+		ref = line
+	}
+
+	bw.write(ccittEOFB)
+	bw.flush()
+
+	return bw.out
+}
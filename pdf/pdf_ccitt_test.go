@@ -0,0 +1,54 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func checkG4(t *testing.T, pix []byte, w, h int, expected []byte) {
+	v := ccittG4Encode(pix, w, h)
+	if !bytes.Equal(v, expected) {
+		t.Errorf("Expected % x. Was % x", expected, v)
+	}
+}
+
+func TestCCITTG4Encode(t *testing.T) {
+
+	// Two white lines are V0 V0 EOFB.
+	checkG4(t, make([]byte, 16), 8, 2,
+		[]byte{0xC0, 0x04, 0x00, 0x40})
+
+	// A black line is coded in horizontal mode.
+	checkG4(t, []byte{1, 1, 1, 1, 1, 1, 1, 1}, 8, 1,
+		[]byte{0x26, 0xA2, 0x80, 0x08, 0x00, 0x80})
+
+	checkG4(t, []byte{0, 0, 1, 1, 0, 0, 0, 0, 0, 0, 1, 1, 1, 0, 0, 0}, 8, 2,
+		[]byte{0x2F, 0xEE, 0x00, 0x20, 0x02})
+}
+
+func TestIsBilevel(t *testing.T) {
+
+	g := image.NewGray(image.Rect(0, 0, 4, 4))
+	g.SetGray(1, 1, color.Gray{0xFF})
+	if !isBilevel(g) {
+		t.Errorf("Expected black and white gray image to be bilevel.")
+	}
+
+	g.SetGray(2, 2, color.Gray{0x80})
+	if isBilevel(g) {
+		t.Errorf("Expected gray image with mid tones not to be bilevel.")
+	}
+
+	p := image.NewPaletted(image.Rect(0, 0, 4, 4), color.Palette{color.Black, color.White})
+	if !isBilevel(p) {
+		t.Errorf("Expected black and white paletted image to be bilevel.")
+	}
+}
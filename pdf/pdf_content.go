@@ -8,13 +8,12 @@
 package pdf
 
 import (
-	"bytes"
 	"io"
 )
 
 type pdfContent struct {
 	id int
-	b  *bytes.Buffer
+	b  sizedBuffer
 }
 
 func (c *pdfContent) Id() int {
@@ -25,6 +24,10 @@ func (p *pdfContent) Type() string {
 	return "Content"
 }
 
+func (p *pdfContent) hasStream() bool {
+	return true
+}
+
 func (c *pdfContent) WriteTo(w io.Writer) (n int64, err error) {
 	n, err = startObj(c, w)
 	if err != nil {
@@ -34,7 +37,7 @@ func (c *pdfContent) WriteTo(w io.Writer) (n int64, err error) {
 	dw := dictionaryWriter{w, 0, nil}
 	dw.Start()
 	dw.Name("Length")
-	dw.Value(c.b.Len())
+	dw.Value(streamLength(w, c.b.Len()))
 	dw.End()
 
 	if dw.err != nil {
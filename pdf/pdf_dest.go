@@ -0,0 +1,91 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"github.com/adkennan/dox2go"
+)
+
+// destination is where an outline item leads.
+type destination interface {
+	write(ps pdfStructure)
+}
+
+// pdfDest is an explicit destination that describes a page
+// and how it is shown in the window.
+type pdfDest struct {
+	page *pdfPage
+	fit  string
+	x    float64
+	y    float64
+	zoom float64
+}
+
+// xyzDest returns a destination that shows the page with
+// x, y, in the page's unit, at the top left of the window.
+func xyzDest(p *pdfPage, x, y float64) *pdfDest {
+	return &pdfDest{p, "XYZ", x, y, 0}
+}
+
+// zoomDest returns a destination that shows the page with
+// x, y, in the page's unit, at the top left of the window and
+// the page magnified by zoom.
+func zoomDest(p *pdfPage, x, y, zoom float64) *pdfDest {
+	return &pdfDest{p, "XYZ", x, y, zoom}
+}
+
+var pageFits = map[dox2go.PageFit]string{
+	dox2go.PF_Fit:        "Fit",
+	dox2go.PF_FitWidth:   "FitH",
+	dox2go.PF_FitHeight:  "FitV",
+	dox2go.PF_FitContent: "FitB",
+}
+
+// fitDest returns a destination that fits the page to
+// the window.
+func fitDest(p *pdfPage, fit dox2go.PageFit) *pdfDest {
+	return &pdfDest{p, pageFits[fit], 0, 0, 0}
+}
+
+func (d *pdfDest) write(ps pdfStructure) {
+	aw := arrayWriter{ps.Writer(), 0, nil}
+	aw.Start()
+	aw.Ref(d.page)
+	aw.Name(d.fit)
+	switch d.fit {
+	case "XYZ":
+		// The point is in the page's unit and orientation and
+		// is written in the default coordinates of the page.
+		x, y := d.page.base().transform(
+			dox2go.ConvertUnit(d.x, d.page.pu, dox2go.U_PT),
+			dox2go.ConvertUnit(d.y, d.page.pu, dox2go.U_PT))
+		aw.Value(x)
+		aw.Value(" ")
+		aw.Value(y)
+		if d.zoom > 0 {
+			aw.Value(" ")
+			aw.Value(d.zoom)
+		} else {
+			aw.Value(" null")
+		}
+	case "FitH", "FitV":
+		aw.Value("null")
+	}
+	aw.End()
+	ps.HandleResult(aw.n, aw.err)
+}
+
+// copiedDest is an explicit destination copied from another
+// document with its page replaced by the appended page.
+type copiedDest struct {
+	a Object
+}
+
+func (d copiedDest) write(ps pdfStructure) {
+	psObject(ps, d.a)
+}
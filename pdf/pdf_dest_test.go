@@ -0,0 +1,94 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/adkennan/dox2go"
+)
+
+func TestRotatedDestinations(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	p := d.CreatePage(dox2go.U_PT, 300, 200, dox2go.PO_Rotate90)
+	d.AddBookmark("Bookmark", p, 10, 20)
+	d.AddDestination("Dest", p, 10, 20)
+	d.SetOpenAction(p, 10, 20, 0)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := readPdf(t, b.Bytes())
+	cat, _ := r.Catalog()
+	outlines, _ := r.resolveDict(cat["Outlines"])
+	item, _ := r.resolveDict(outlines["First"])
+	names, _ := r.resolveDict(cat["Names"])
+	dests, _ := r.resolveDict(names["Dests"])
+	named, _ := r.resolveArray(dests["Names"])
+	if len(named) != 2 {
+		t.Fatalf("Expected a named destination. Was %v", named)
+	}
+
+	// The point is rotated with the page, so 10, 20 from the
+	// bottom left of the rotated page is 280, 10 from the
+	// bottom left of the unrotated page.
+	for name, dest := range map[string]Object{
+		"bookmark":          item["Dest"],
+		"named destination": named[1],
+		"open action":       cat["OpenAction"],
+	} {
+		a, _ := r.resolveArray(dest)
+		if len(a) != 5 || a[1] != Name("XYZ") {
+			t.Errorf("Expected the %s to be an XYZ destination. Was %v", name, a)
+			continue
+		}
+		if x, _ := number(a[2]); x != 280 {
+			t.Errorf("Expected the %s to show 280, 10. Was %v", name, a)
+		}
+		if y, _ := number(a[3]); y != 10 {
+			t.Errorf("Expected the %s to show 280, 10. Was %v", name, a)
+		}
+	}
+}
+
+func TestSortNames(t *testing.T) {
+
+	names := sortNames([]string{"Chapter 1", "a)b", "Chapter", "a(b", "é"})
+	expected := []string{"Chapter", "Chapter 1", "a(b", "a)b", "é"}
+	for ix, e := range expected {
+		if names[ix] != e {
+			t.Errorf("Expected %q. Was %q", expected, names)
+			break
+		}
+	}
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	p := d.CreatePage(dox2go.U_PT, 300, 200, dox2go.PO_Portrait)
+	d.AddDestination("Chapter 1", p, 0, 200)
+	d.AddDestination("Chapter", p, 0, 100)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := readPdf(t, b.Bytes())
+	cat, _ := r.Catalog()
+	nd, _ := r.resolveDict(cat["Names"])
+	dests, _ := r.resolveDict(nd["Dests"])
+	tree, _ := r.resolveArray(dests["Names"])
+	if len(tree) != 4 || string(tree[0].(String)) != "Chapter" || string(tree[2].(String)) != "Chapter 1" {
+		t.Errorf("Expected Chapter before Chapter 1. Was %v", tree)
+	}
+	for _, name := range []string{"Chapter", "Chapter 1"} {
+		if r.destination(String(name)) == nil {
+			t.Errorf("Expected %s to be found.", name)
+		}
+	}
+}
@@ -9,18 +9,30 @@ package pdf
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"image"
 	"io"
+	"io/ioutil"
+	"time"
 
 	"github.com/adkennan/dox2go"
 )
 
+var ErrClosed = errors.New("The document has already been closed")
+
 ///////////////////////////////////////////////////////////
 
 type pdfCatalog struct {
-	id   int
-	objs []pdfObj
+	id     int
+	objs   []pdfObj
+	lang   string
+	marked bool
+
+	layout     string
+	mode       string
+	openAction *pdfDest
+	prefs      *dox2go.ViewerPreferences
 }
 
 func (c *pdfCatalog) Id() int {
@@ -47,6 +59,34 @@ func (c *pdfCatalog) WriteTo(w io.Writer) (n int64, err error) {
 		dw.Ref(o)
 	}
 
+	if c.marked {
+		dw.Name("MarkInfo")
+		dw.Start()
+		dw.Name("Marked")
+		dw.Value("true")
+		dw.End()
+	}
+	if c.lang != "" {
+		dw.Name("Lang")
+		dw.String(c.lang)
+	}
+	if c.layout != "" {
+		dw.Name("PageLayout")
+		dw.Name(c.layout)
+	}
+	if c.mode != "" {
+		dw.Name("PageMode")
+		dw.Name(c.mode)
+	}
+	if c.openAction != nil {
+		dw.Name("OpenAction")
+		c.openAction.write(&dw)
+	}
+	if c.prefs != nil {
+		dw.Name("ViewerPreferences")
+		writePreferences(&dw, c.prefs)
+	}
+
 	dw.End()
 
 	if dw.err != nil {
@@ -116,49 +156,6 @@ func (c *pdfPages) Close() {
 
 ///////////////////////////////////////////////////////////
 
-type pdfOutlines struct {
-	id   int
-	objs []pdfObj
-}
-
-func (c *pdfOutlines) Id() int {
-	return c.id
-}
-
-func (p *pdfOutlines) Type() string {
-	return "Outlines"
-}
-
-func (c *pdfOutlines) WriteTo(w io.Writer) (n int64, err error) {
-	n, err = startObj(c, w)
-	if err != nil {
-		return 0, err
-	}
-
-	dw := dictionaryWriter{w, 0, nil}
-	dw.Start()
-	dw.Name("Type")
-	dw.Name(c.Type())
-	dw.Name("Count")
-	dw.Value(len(c.objs))
-	for _, o := range c.objs {
-		dw.Name(o.Type())
-		dw.Ref(o)
-	}
-	dw.End()
-
-	if dw.err != nil {
-		return n, dw.err
-	}
-	n += dw.n
-
-	n2, err := endObj(c, w)
-	n += int64(n2)
-	return n, err
-}
-
-///////////////////////////////////////////////////////////
-
 type pdfProcSet struct {
 	id    int
 	names []string
@@ -211,37 +208,91 @@ type pdfDoc struct {
 	pages    *pdfPages
 	procSet  *pdfProcSet
 	fonts    pdfTypeFaceList
+	nameDict *pdfNames
+	form     *pdfAcroForm
+	meta     dox2go.Metadata
+	enc      *pdfEncrypt
+	sigs     []*pdfSigField
+	pdfa     PdfALevel
+	tags     *pdfStructTree
+	labels   *pdfPageLabels
+	ocProps  *pdfOCProperties
+
+	files      []*pdfFileSpec
+	assocFiles *pdfAssocFiles
+	multiply   *pdfExtGState
+	objStreams bool
+
+	// The state of streamed documents.
+	streaming bool
+	spill     bool
+	cw        *countingWriter
+	id        []byte
+	offsets   map[int]int64
+	err       error
+	closed    bool
+
+	// The importers of pages from other documents and the
+	// shared objects they have copied, by the hash of their
+	// contents.
+	imports map[*Reader]*pdfImporter
+	copies  map[string]*pdfImportedObj
 }
 
+// Option configures optional features of a PDF document.
+type Option func(doc *pdfDoc)
+
 // NewPdfDoc constructs a new Document object that
 // writes PDF output.
-func NewPdfDoc(w io.Writer) dox2go.Document {
+func NewPdfDoc(w io.Writer, opts ...Option) dox2go.Document {
 
-	cat := &pdfCatalog{1, make([]pdfObj, 0, 4)}
+	cat := &pdfCatalog{1, make([]pdfObj, 0, 4), "", false, "", "", nil, nil}
 
-	outlines := &pdfOutlines{2, make([]pdfObj, 0)}
+	outlines := &pdfOutlines{2, make([]*pdfOutlineItem, 0)}
 	pages := &pdfPages{3, make([]*pdfPage, 0, 4)}
 	procSet := &pdfProcSet{4, make([]string, 0, 2)}
 
 	cat.objs = append(cat.objs, outlines, pages)
 
-	bp := dox2go.NewBufferPool()
-	bp.CreateCategory(smallBuf, smallBufSize)
-	bp.CreateCategory(largeBuf, largeBufSize)
-
 	doc := &pdfDoc{
 		w,
-		bp,
+		newBufferPool(dox2go.NewBufferPool()),
 		make([]pdfObj, 0, 10),
 		cat,
 		outlines,
 		pages,
 		procSet,
 		make([]*pdfTypeFace, 0, 4),
+		nil,
+		nil,
+		dox2go.Metadata{},
+		nil,
+		nil,
+		PA_None,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+		false,
+		false,
+		false,
+		nil,
+		nil,
+		make(map[int]int64),
+		nil,
+		false,
+		nil,
+		nil,
 	}
 
 	doc.objs = append(doc.objs, cat, outlines, pages, procSet)
 
+	for _, opt := range opts {
+		opt(doc)
+	}
+
 	procSet.Add("PDF")
 	procSet.Add("Text")
 
@@ -249,17 +300,26 @@ func NewPdfDoc(w io.Writer) dox2go.Document {
 }
 
 func (doc *pdfDoc) CreatePage(pu dox2go.PageUnit, w, h float64, po dox2go.PageOrientation) dox2go.Page {
+
+	doc.finishLastPage()
 	p := &pdfPage{
 		len(doc.objs) + 1,
 		w, h,
 		po,
 		pu,
 		doc.pages,
+		doc,
 		nil,
+		make([]pdfObj, 0),
 		&pdfContent{
 			len(doc.objs) + 2,
-			new(bytes.Buffer),
+			doc.getBuffer(contentBuf),
 		},
+		[4]*rect{},
+		0,
+		0,
+		nil,
+		nil,
 	}
 
 	doc.objs = append(doc.objs, p, p.c)
@@ -282,90 +342,263 @@ func (doc *pdfDoc) CreateFont(name string, fs dox2go.FontStyle, size float64) do
 
 func (doc *pdfDoc) CreateImage(src image.Image) dox2go.Image {
 
-	m := &pdfImageMask{len(doc.objs) + 2, 0, 0, bytes.Buffer{}}
-	i := &pdfImage{len(doc.objs) + 1, src, m}
+	return doc.createImage(src, false)
+}
 
-	doc.objs = append(doc.objs, i, m)
+func (doc *pdfDoc) CreateStencil(src image.Image) dox2go.Image {
 
-	return i
+	return doc.createImage(src, true)
 }
 
-func writeXrefEntry(w io.Writer, offset int64) (err error) {
-	_, err = fmt.Fprintf(w, "%010d 00000 n\r\n", offset)
-	return err
-}
+// createImage constructs a new image. Images small enough to be
+// drawn inline are not added to the document unless they are
+// later drawn as an XObject.
+func (doc *pdfDoc) createImage(src image.Image, stencil bool) *pdfImage {
 
-func (doc *pdfDoc) Close() (err error) {
+	i := &pdfImage{0, src, nil, dox2go.DefaultDpi, dox2go.DefaultDpi, stencil, nil, nil, nil}
 
-	doc.pages.Close()
+	if !i.inline() {
+		doc.addImage(i)
+	}
 
-	var offset int64 = 0
+	return i
+}
 
-	xref := doc.pool.GetBuffer(smallBuf)
-	defer doc.pool.FreeBuffer(xref)
+func (doc *pdfDoc) addImage(i *pdfImage) {
 
-	n, err := fmt.Fprintf(xref, "xref\r\n0 %d\r\n", len(doc.objs)+1)
-	if err != nil {
-		return err
+	i.id = len(doc.objs) + 1
+	doc.objs = append(doc.objs, i)
+}
+
+// addMask adds a soft mask for an image with transparent pixels
+// before it is encoded.
+func (doc *pdfDoc) addMask(i *pdfImage) {
+
+	if _, written := doc.offsets[i.id]; written || i.mask != nil || i.encoded != nil || !i.needsMask() {
+		return
 	}
+	i.mask = &pdfImageMask{len(doc.objs) + 1, 0, 0, 8, bytes.Buffer{}, nil}
+	doc.objs = append(doc.objs, i.mask)
+}
 
-	n, err = fmt.Fprint(doc.w, "%PDF-1.7\r\n")
-	if err != nil {
-		return err
+// fail records the first error found while the document is
+// built. It is returned by Close.
+func (doc *pdfDoc) fail(err error) {
+	if doc.err == nil {
+		doc.err = err
 	}
-	offset += int64(n)
+}
 
-	n, err = doc.w.Write([]byte{200, 200, 200, 200, 13, 10})
-	if err != nil {
-		return err
+// discard records an error and returns a surface whose drawing
+// is thrown away, for methods that cannot return the error.
+func (doc *pdfDoc) discard(err error) dox2go.Surface {
+	doc.fail(err)
+	return newSurface(doc, ioutil.Discard, dox2go.U_PT)
+}
+
+// writerFor returns the writer an object is written to. The
+// objects of encrypted documents are written with their own key,
+// except for the encryption dictionary itself.
+func (doc *pdfDoc) writerFor(w io.Writer, o pdfObj) io.Writer {
+	if doc.enc == nil || o == pdfObj(doc.enc) {
+		return w
 	}
-	offset += int64(n)
+	return &objWriter{w, doc.enc.objectKey(o.Id()), nil}
+}
+
+// countingWriter counts the bytes written to a writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func writeXrefEntry(w io.Writer, offset int64) (err error) {
+	_, err = fmt.Fprintf(w, "%010d 00000 n\r\n", offset)
+	return err
+}
+
+// writeObjects writes the objects of the document followed by
+// a cross-reference table and trailer. It returns the offsets of
+// the objects.
+func (doc *pdfDoc) writeObjects(cw *countingWriter, info *pdfInfo, id []byte) ([]int64, error) {
 
 	xrefs := make([]int64, len(doc.objs))
 	for ix, o := range doc.objs {
-		xrefs[ix] = offset
-		n2, err := o.WriteTo(doc.w)
+		if offset, written := doc.offsets[o.Id()]; written {
+			xrefs[ix] = offset
+			continue
+		}
+		xrefs[ix] = cw.n
+		_, err := o.WriteTo(doc.writerFor(cw, o))
 		if err != nil {
-			return err
+			return nil, err
 		}
-		offset += n2
+	}
+	offset := cw.n
+
+	xref := doc.getBuffer(smallBuf)
+	defer doc.pool.FreeBuffer(xref)
+
+	_, err := fmt.Fprintf(xref, "xref\r\n0 %d\r\n", len(doc.objs)+1)
+	if err != nil {
+		return nil, err
 	}
 
 	_, err = fmt.Fprint(xref, "0000000000 65535 f\r\n")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	for _, r := range xrefs {
 		err = writeXrefEntry(xref, r)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	_, err = xref.WriteTo(doc.w)
+	_, err = xref.WriteTo(cw)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = fmt.Fprint(doc.w, "trailer\r\n")
+	_, err = fmt.Fprint(cw, "trailer\r\n")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	dw := dictionaryWriter{doc.w, 0, nil}
+	dw := dictionaryWriter{cw, 0, nil}
 	dw.Start()
 	dw.Name("Size")
 	dw.Value(len(doc.objs) + 1)
-	dw.Name("Root")
-	dw.Ref(doc.catalog)
+	doc.writeTrailer(&dw, info, id)
 	dw.End()
 
 	if dw.err != nil {
-		return dw.err
+		return nil, dw.err
+	}
+
+	_, err = fmt.Fprintf(cw, "startxref\r\n%d\r\n%%%%EOF\r\n", offset)
+	return xrefs, err
+}
+
+// writeTrailer writes the entries of the trailer that identify
+// the document.
+func (doc *pdfDoc) writeTrailer(dw *dictionaryWriter, info *pdfInfo, id []byte) {
+	dw.Name("Root")
+	dw.Ref(doc.catalog)
+	dw.Name("Info")
+	dw.Ref(info)
+	if doc.enc != nil {
+		dw.Name("Encrypt")
+		dw.Ref(doc.enc)
+	}
+	dw.Name("ID")
+	dw.Value(fmt.Sprintf("[<%X> <%X>]", id, id))
+}
+
+func (doc *pdfDoc) Close() (err error) {
+
+	if doc.closed {
+		return ErrClosed
+	}
+	doc.closed = true
+
+	defer func() {
+		if cerr := doc.pool.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	if doc.err != nil {
+		return doc.err
+	}
+
+	if err = doc.checkOptions(); err != nil {
+		return err
+	}
+	if doc.pdfa != PA_None {
+		err = doc.checkPdfA()
+		if err != nil {
+			return err
+		}
+	}
+
+	doc.pages.Close()
+
+	for _, o := range doc.objs {
+		if i, ok := o.(*pdfImage); ok {
+			doc.addMask(i)
+		}
+	}
+
+	now := time.Now()
+	meta := completeMetadata(doc.meta, now)
+	info := &pdfInfo{len(doc.objs) + 1, meta}
+	xmp := &pdfXmp{len(doc.objs) + 2, meta, doc.pdfa.part()}
+	doc.objs = append(doc.objs, info, xmp)
+	doc.catalog.objs = append(doc.catalog.objs, xmp)
+	doc.catalog.lang = meta.Language
+	doc.catalog.marked = doc.tags != nil
+
+	if doc.pdfa != PA_None {
+		doc.addOutputIntent()
 	}
 
-	_, err = fmt.Fprintf(doc.w, "startxref\r\n%d\r\n%%%%EOF\r\n", offset)
+	if doc.enc != nil {
+		doc.enc.id = len(doc.objs) + 1
+		doc.objs = append(doc.objs, doc.enc)
+	}
+
+	err = doc.identify(func() []byte {
+		return fileId(meta, len(doc.objs))
+	})
+	if err != nil {
+		return err
+	}
+	id := doc.id
+
+	w := doc.w
+
+	// Signed documents are written to a buffer so the signature
+	// can be calculated once the whole document is known.
+	var signed *bytes.Buffer
+	if len(doc.sigs) > 0 {
+		sv := doc.sigs[0].v
+		if sv.sig.Time.IsZero() {
+			sv.sig.Time = now
+		}
+		signed = new(bytes.Buffer)
+		w = signed
+	}
+
+	// Offsets are counted as they are written as encryption
+	// changes the size of objects.
+	cw, err := doc.begin(w)
+	if err != nil {
+		return err
+	}
+	var xrefs []int64
+	if doc.objStreams {
+		xrefs, err = doc.writeCompressed(cw, info, id)
+	} else {
+		xrefs, err = doc.writeObjects(cw, info, id)
+	}
+	if err != nil || signed == nil {
+		return err
+	}
+
+	sv := doc.sigs[0].v
+	err = sv.sign(signed.Bytes(), xrefs[sv.id-1])
+	if err != nil {
+		return err
+	}
 
+	_, err = signed.WriteTo(doc.w)
 	return err
 }
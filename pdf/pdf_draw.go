@@ -18,12 +18,109 @@ import (
 )
 
 type pdfSurface struct {
+	doc      *pdfDoc
 	w        io.Writer
 	u        d2g.PageUnit
 	inText   bool
 	fonts    []*pdfTypeFace
 	lastFont *pdfFont
 	xobjs    map[string]pdfObj
+	ctm      matrix
+	states   []matrix
+	page     *pdfPage
+	marked   *pdfStructElem
+	artifact bool
+	props    map[string]pdfObj
+	layers   int
+	gstates  map[string]pdfObj
+}
+
+// matrix is a transformation matrix [a b c d e f] that maps
+// x, y to a*x + c*y + e, b*x + d*y + f.
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// multiply returns the matrix that applies m and then n.
+func (m matrix) multiply(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m matrix) transform(x, y float64) (float64, float64) {
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+func newSurface(doc *pdfDoc, w io.Writer, u d2g.PageUnit) *pdfSurface {
+	return &pdfSurface{
+		doc,
+		w,
+		u,
+		false,
+		make([]*pdfTypeFace, 0, 4),
+		nil,
+		make(map[string]pdfObj),
+		identity,
+		make([]matrix, 0, 4),
+		nil,
+		nil,
+		false,
+		make(map[string]pdfObj),
+		0,
+		make(map[string]pdfObj),
+	}
+}
+
+// writeResources writes the resource dictionary listing the
+// fonts, XObjects, graphics states and marked content
+// properties used by the surface.
+func (sfc *pdfSurface) writeResources(dw *dictionaryWriter) {
+	dw.Start()
+	dw.Name("Font")
+	dw.Start()
+	written := make(map[int]bool)
+	for _, f := range sfc.fonts {
+		if !written[f.Id()] {
+			written[f.Id()] = true
+			dw.Value("/F")
+			dw.Value(f.Id())
+			dw.Value(" ")
+			dw.Ref(f)
+		}
+	}
+	dw.End()
+	dw.Name("XObject")
+	dw.Start()
+	for key, xo := range sfc.xobjs {
+		dw.Name(key)
+		dw.Ref(xo)
+	}
+	dw.End()
+	if len(sfc.gstates) > 0 {
+		dw.Name("ExtGState")
+		dw.Start()
+		for key, gs := range sfc.gstates {
+			dw.Name(key)
+			dw.Ref(gs)
+		}
+		dw.End()
+	}
+	if len(sfc.props) > 0 {
+		dw.Name("Properties")
+		dw.Start()
+		for key, o := range sfc.props {
+			dw.Name(key)
+			dw.Ref(o)
+		}
+		dw.End()
+	}
+	dw.End()
 }
 
 func (sfc *pdfSurface) addXObj(o pdfObj) string {
@@ -39,11 +136,18 @@ func (sfc *pdfSurface) alterMatrix(a, b, c, d, e, f float64) {
 
 	sfc.endText()
 
+	sfc.ctm = matrix{a, b, c, d, e, f}.multiply(sfc.ctm)
+
 	fmt.Fprintf(sfc.w, "%f %f %f %f %f %f cm\r\n",
 		a, b, c, d, e, f)
 }
 
 func (sfc *pdfSurface) Close() {
+	sfc.endMarked()
+	sfc.EndArtifact()
+	for sfc.layers > 0 {
+		sfc.EndLayer()
+	}
 	sfc.endText()
 }
 
@@ -51,12 +155,19 @@ func (sfc *pdfSurface) PushState() {
 
 	sfc.endText()
 
+	sfc.states = append(sfc.states, sfc.ctm)
+
 	fmt.Fprint(sfc.w, "q\r\n")
 }
 
 func (sfc *pdfSurface) PopState() {
 	sfc.endText()
 
+	if len(sfc.states) > 0 {
+		sfc.ctm = sfc.states[len(sfc.states)-1]
+		sfc.states = sfc.states[:len(sfc.states)-1]
+	}
+
 	fmt.Fprint(sfc.w, "Q\r\n")
 }
 
@@ -127,6 +238,7 @@ func (sfc *pdfSurface) LinePattern(pattern []float64, phase float64) {
 }
 
 func (sfc *pdfSurface) Stroke(path *d2g.Path) {
+	sfc.mark()
 	sfc.endText()
 
 	sfc.writePath(path)
@@ -135,6 +247,7 @@ func (sfc *pdfSurface) Stroke(path *d2g.Path) {
 }
 
 func (sfc *pdfSurface) Fill(path *d2g.Path) {
+	sfc.mark()
 	sfc.endText()
 
 	sfc.writePath(path)
@@ -156,6 +269,8 @@ func (sfc *pdfSurface) Text(f d2g.Font, x, y float64, text string) {
 
 	if pf, ok := f.(*pdfFont); ok {
 
+		sfc.mark()
+
 		if !sfc.inText {
 			fmt.Fprint(sfc.w, "BT\r\n")
 			sfc.inText = true
@@ -201,22 +316,72 @@ func (sfc *pdfSurface) Text(f d2g.Font, x, y float64, text string) {
 
 func (sfc *pdfSurface) Image(i d2g.Image, x, y, w, h float64) {
 
+	sfc.PlaceImage(i, x, y, w, h, d2g.IP_Stretch, d2g.AN_Center)
+}
+
+func (sfc *pdfSurface) PlaceImage(i d2g.Image, x, y, w, h float64, ip d2g.ImagePlacement, a d2g.Anchor) {
+
+	sfc.mark()
 	sfc.endText()
 
-	if pi, ok := i.(*pdfImage); ok {
+	switch i.(type) {
+	case *pdfImage, *pdfImportedPage:
+
+		ix, iy, iw, ih := d2g.ImageRect(i, sfc.u, x, y, w, h, ip, a)
 
 		sfc.PushState()
-		sfc.Translate(x, y)
-		sfc.Scale(w, h)
 
-		name := sfc.addXObj(pi)
+		if ip == d2g.IP_Fill {
+			sfc.clipRect(x, y, w, h)
+		}
 
-		fmt.Fprintf(sfc.w, "/%s Do\r\n", name)
+		sfc.Translate(ix, iy)
+		sfc.alterMatrix(
+			d2g.ConvertUnit(iw, sfc.u, d2g.U_PT), 0,
+			0, d2g.ConvertUnit(ih, sfc.u, d2g.U_PT),
+			0, 0)
+
+		// Imported pages are forms that fill the unit square,
+		// the same as images.
+		if ipg, ok := i.(*pdfImportedPage); ok {
+			name := sfc.addXObj(ipg)
+
+			fmt.Fprintf(sfc.w, "/%s Do\r\n", name)
+		} else if pi := i.(*pdfImage); pi.inline() {
+			// Inline images are not objects that checkPdfA can
+			// find once the document is closed.
+			if sfc.doc.pdfa != PA_None && pi.deviceCMYK() {
+				sfc.doc.fail(ErrDeviceCMYK)
+			}
+			if err := pi.writeInline(sfc.w); err != nil {
+				sfc.doc.fail(err)
+			}
+		} else {
+			if pi.id == 0 {
+				sfc.doc.addImage(pi)
+			}
+			if sfc.doc.spill {
+				sfc.doc.spillImage(pi)
+			}
+
+			name := sfc.addXObj(pi)
+
+			fmt.Fprintf(sfc.w, "/%s Do\r\n", name)
+		}
 
 		sfc.PopState()
 	}
 }
 
+func (sfc *pdfSurface) clipRect(x, y, w, h float64) {
+
+	fmt.Fprintf(sfc.w, "%f %f %f %f re W n\r\n",
+		d2g.ConvertUnit(x, sfc.u, d2g.U_PT),
+		d2g.ConvertUnit(y, sfc.u, d2g.U_PT),
+		d2g.ConvertUnit(w, sfc.u, d2g.U_PT),
+		d2g.ConvertUnit(h, sfc.u, d2g.U_PT))
+}
+
 func (sfc *pdfSurface) endText() {
 
 	if sfc.inText {
@@ -0,0 +1,420 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// EncryptionAlgorithm selects the cipher used to encrypt a document.
+type EncryptionAlgorithm int32
+
+// Supported encryption algorithms.
+const (
+	EA_AES128 EncryptionAlgorithm = iota // AES-128, security handler revision 4.
+	EA_AES256                            // AES-256, security handler revision 6.
+)
+
+// Permission is a set of operations readers allow when a document
+// is opened with the user password.
+type Permission uint32
+
+// Permissions that may be granted to readers.
+const (
+	PM_Print         Permission = 1 << 2
+	PM_Modify        Permission = 1 << 3
+	PM_Copy          Permission = 1 << 4
+	PM_Annotate      Permission = 1 << 5
+	PM_FillForms     Permission = 1 << 8
+	PM_Accessibility Permission = 1 << 9
+	PM_Assemble      Permission = 1 << 10
+	PM_PrintHighRes  Permission = 1 << 11
+
+	PM_All = PM_Print | PM_Modify | PM_Copy | PM_Annotate |
+		PM_FillForms | PM_Accessibility | PM_Assemble | PM_PrintHighRes
+)
+
+// Encrypt protects a document with the standard security handler.
+// The user password is required to open the document and grants the
+// permissions in perms. The owner password grants full access; when
+// it is empty the user password is used instead.
+func Encrypt(alg EncryptionAlgorithm, userPassword, ownerPassword string, perms Permission) Option {
+	return func(doc *pdfDoc) {
+		if ownerPassword == "" {
+			ownerPassword = userPassword
+		}
+		doc.enc = &pdfEncrypt{
+			0,
+			alg,
+			[]byte(userPassword),
+			[]byte(ownerPassword),
+			permissionValue(perms),
+			nil, nil, nil, nil, nil, nil,
+		}
+	}
+}
+
+// permissionValue returns the value of the P entry. Bits 7, 8 and
+// 13 to 32 are reserved and must be set.
+func permissionValue(perms Permission) int32 {
+	return int32(uint32(perms&PM_All) | 0xFFFFF0C0)
+}
+
+///////////////////////////////////////////////////////////
+
+// passwordPadding is used to pad or create passwords for
+// revision 4 of the security handler.
+var passwordPadding = []byte{
+	0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41,
+	0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+	0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80,
+	0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+}
+
+// pdfEncrypt is the encryption dictionary of the document. It
+// also holds the file key used to derive the key of each object.
+type pdfEncrypt struct {
+	id    int
+	alg   EncryptionAlgorithm
+	user  []byte
+	owner []byte
+	p     int32
+	key   []byte
+	o     []byte
+	u     []byte
+	oe    []byte
+	ue    []byte
+	perms []byte
+}
+
+func (e *pdfEncrypt) Id() int {
+	return e.id
+}
+
+func (e *pdfEncrypt) Type() string {
+	return "Encrypt"
+}
+
+// init calculates the file key and password entries. fileId is the
+// first element of the document's ID.
+func (e *pdfEncrypt) init(fileId []byte) error {
+	if e.alg == EA_AES256 {
+		return e.initR6()
+	}
+	e.initR4(fileId)
+	return nil
+}
+
+func padPassword(pwd []byte) []byte {
+	p := make([]byte, 0, 32)
+	p = append(p, pwd...)
+	if len(p) > 32 {
+		p = p[:32]
+	}
+	return append(p, passwordPadding[:32-len(p)]...)
+}
+
+// rc4Rounds encrypts data with key, then 19 more times with each
+// byte of the key XORed with the round number.
+func rc4Rounds(key, data []byte) []byte {
+	out := make([]byte, len(data))
+	copy(out, data)
+	k := make([]byte, len(key))
+	for i := 0; i < 20; i++ {
+		for ix := range key {
+			k[ix] = key[ix] ^ byte(i)
+		}
+		c, _ := rc4.NewCipher(k)
+		c.XORKeyStream(out, out)
+	}
+	return out
+}
+
+// md5Rounds hashes data then rehashes the result 50 times.
+func md5Rounds(data []byte) []byte {
+	h := md5.Sum(data)
+	return rehash(h[:])
+}
+
+// rehash hashes an MD5 hash 50 more times.
+func rehash(h []byte) []byte {
+	for i := 0; i < 50; i++ {
+		s := md5.Sum(h)
+		h = s[:]
+	}
+	return h
+}
+
+func (e *pdfEncrypt) initR4(fileId []byte) {
+
+	e.o = rc4Rounds(md5Rounds(padPassword(e.owner)), padPassword(e.user))
+
+	h := md5.New()
+	h.Write(padPassword(e.user))
+	h.Write(e.o)
+	binary.Write(h, binary.LittleEndian, e.p)
+	h.Write(fileId)
+	e.key = rehash(h.Sum(nil))
+
+	h = md5.New()
+	h.Write(passwordPadding)
+	h.Write(fileId)
+	e.u = append(rc4Rounds(e.key, h.Sum(nil)), make([]byte, 16)...)
+}
+
+// hashR6 is the password hash of revision 6 of the security handler.
+func hashR6(pwd, salt, udata []byte) []byte {
+
+	h := sha256.New()
+	h.Write(pwd)
+	h.Write(salt)
+	h.Write(udata)
+	k := h.Sum(nil)
+
+	for i := 0; ; i++ {
+		k1 := make([]byte, 0, 64*(len(pwd)+len(k)+len(udata)))
+		for j := 0; j < 64; j++ {
+			k1 = append(k1, pwd...)
+			k1 = append(k1, k...)
+			k1 = append(k1, udata...)
+		}
+
+		b, _ := aes.NewCipher(k[:16])
+		cipher.NewCBCEncrypter(b, k[16:32]).CryptBlocks(k1, k1)
+
+		sum := 0
+		for _, c := range k1[:16] {
+			sum += int(c)
+		}
+		switch sum % 3 {
+		case 0:
+			s := sha256.Sum256(k1)
+			k = s[:]
+		case 1:
+			s := sha512.Sum384(k1)
+			k = s[:]
+		case 2:
+			s := sha512.Sum512(k1)
+			k = s[:]
+		}
+
+		if i >= 63 && int(k1[len(k1)-1]) <= i+1-32 {
+			break
+		}
+	}
+
+	return k[:32]
+}
+
+// encryptKeyR6 encrypts the file key with the hash of a password
+// using AES-256 with no padding and a zero initialization vector.
+func encryptKeyR6(hash, fileKey []byte) []byte {
+	b, _ := aes.NewCipher(hash)
+	out := make([]byte, len(fileKey))
+	cipher.NewCBCEncrypter(b, make([]byte, aes.BlockSize)).CryptBlocks(out, fileKey)
+	return out
+}
+
+func truncatePassword(pwd []byte) []byte {
+	if len(pwd) > 127 {
+		return pwd[:127]
+	}
+	return pwd
+}
+
+func (e *pdfEncrypt) initR6() error {
+
+	// The file key, 8 byte validation and key salts for each
+	// password and 4 random bytes for the Perms entry.
+	r := make([]byte, 32+8*4+4)
+	if _, err := io.ReadFull(rand.Reader, r); err != nil {
+		return err
+	}
+	e.setKeysR6(r)
+	return nil
+}
+
+// setKeysR6 calculates the password entries from the random
+// bytes r chosen by initR6.
+func (e *pdfEncrypt) setKeysR6(r []byte) {
+
+	e.key = r[:32]
+	uvs, uks := r[32:40], r[40:48]
+	ovs, oks := r[48:56], r[56:64]
+
+	user := truncatePassword(e.user)
+	owner := truncatePassword(e.owner)
+
+	e.u = append(append(hashR6(user, uvs, nil), uvs...), uks...)
+	e.ue = encryptKeyR6(hashR6(user, uks, nil), e.key)
+
+	e.o = append(append(hashR6(owner, ovs, e.u), ovs...), oks...)
+	e.oe = encryptKeyR6(hashR6(owner, oks, e.u), e.key)
+
+	perms := make([]byte, 16)
+	binary.LittleEndian.PutUint32(perms, uint32(e.p))
+	copy(perms[4:], []byte{0xFF, 0xFF, 0xFF, 0xFF, 'T', 'a', 'd', 'b'})
+	copy(perms[12:], r[64:])
+	b, _ := aes.NewCipher(e.key)
+	e.perms = make([]byte, 16)
+	b.Encrypt(e.perms, perms)
+}
+
+// objectKey returns the key used to encrypt the strings and
+// streams of the object with the given id.
+func (e *pdfEncrypt) objectKey(id int) []byte {
+	if e.alg == EA_AES256 {
+		return e.key
+	}
+
+	h := md5.New()
+	h.Write(e.key)
+	h.Write([]byte{byte(id), byte(id >> 8), byte(id >> 16), 0, 0})
+	h.Write([]byte("sAlT"))
+	return h.Sum(nil)
+}
+
+// encryptedLength returns the length of n bytes once encrypted;
+// a random initialization vector followed by the data padded to
+// a whole number of blocks.
+func encryptedLength(n int) int {
+	return aes.BlockSize + (n/aes.BlockSize+1)*aes.BlockSize
+}
+
+// encryptData encrypts data with AES in CBC mode.
+func encryptData(key, data []byte) ([]byte, error) {
+
+	out := make([]byte, encryptedLength(len(data)))
+	iv := out[:aes.BlockSize]
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+
+	pad := aes.BlockSize - len(data)%aes.BlockSize
+	copy(out[aes.BlockSize:], data)
+	for ix := len(out) - pad; ix < len(out); ix++ {
+		out[ix] = byte(pad)
+	}
+
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	cipher.NewCBCEncrypter(b, iv).CryptBlocks(out[aes.BlockSize:], out[aes.BlockSize:])
+
+	return out, nil
+}
+
+func (e *pdfEncrypt) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(e, w)
+	if err != nil {
+		return 0, err
+	}
+
+	v, r, cfm, length := 4, 4, "AESV2", 16
+	if e.alg == EA_AES256 {
+		v, r, cfm, length = 5, 6, "AESV3", 32
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Filter")
+	dw.Name("Standard")
+	dw.Name("V")
+	dw.Value(v)
+	dw.Name("R")
+	dw.Value(r)
+	dw.Name("Length")
+	dw.Value(length * 8)
+	dw.Name("CF")
+	dw.Start()
+	dw.Name("StdCF")
+	dw.Start()
+	dw.Name("CFM")
+	dw.Name(cfm)
+	dw.Name("AuthEvent")
+	dw.Name("DocOpen")
+	dw.Name("Length")
+	dw.Value(length)
+	dw.End()
+	dw.End()
+	dw.Name("StmF")
+	dw.Name("StdCF")
+	dw.Name("StrF")
+	dw.Name("StdCF")
+	dw.Name("O")
+	dw.Value(fmt.Sprintf("<%X>", e.o))
+	dw.Name("U")
+	dw.Value(fmt.Sprintf("<%X>", e.u))
+	if e.alg == EA_AES256 {
+		dw.Name("OE")
+		dw.Value(fmt.Sprintf("<%X>", e.oe))
+		dw.Name("UE")
+		dw.Value(fmt.Sprintf("<%X>", e.ue))
+		dw.Name("Perms")
+		dw.Value(fmt.Sprintf("<%X>", e.perms))
+	}
+	dw.Name("P")
+	dw.Value(e.p)
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	n += dw.n
+
+	n2, err := endObj(e, w)
+	n += int64(n2)
+	return n, err
+}
+
+///////////////////////////////////////////////////////////
+
+// objWriter writes a single object to the document. When the
+// document is encrypted the strings and streams of the object
+// are encrypted with the object's key.
+type objWriter struct {
+	w      io.Writer
+	key    []byte
+	stream *bytes.Buffer
+}
+
+func (ow *objWriter) Write(p []byte) (n int, err error) {
+	if ow.stream != nil {
+		return ow.stream.Write(p)
+	}
+	return ow.w.Write(p)
+}
+
+// encryptingWriter returns the objWriter of w if the object being
+// written to it is to be encrypted.
+func encryptingWriter(w io.Writer) *objWriter {
+	if ow, ok := w.(*objWriter); ok && ow.key != nil {
+		return ow
+	}
+	return nil
+}
+
+// streamLength returns the value of the Length entry of a stream
+// containing n bytes written to w.
+func streamLength(w io.Writer, n int) int {
+	if encryptingWriter(w) != nil {
+		return encryptedLength(n)
+	}
+	return n
+}
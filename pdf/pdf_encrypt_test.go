@@ -0,0 +1,209 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/adkennan/dox2go"
+)
+
+func TestPermissionValue(t *testing.T) {
+
+	v := permissionValue(PM_Print | PM_Copy)
+	if v != -3884 {
+		t.Errorf("Expected -3884. Was %d", v)
+	}
+
+	v = permissionValue(PM_All)
+	if v != -4 {
+		t.Errorf("Expected -4. Was %d", v)
+	}
+}
+
+func TestEncryptR4(t *testing.T) {
+
+	id := []byte{0x4C, 0x4D, 0x36, 0x23, 0x14, 0x75, 0x05, 0xF6,
+		0x60, 0xCF, 0x17, 0x1D, 0x69, 0x71, 0x59, 0xC1}
+
+	e := &pdfEncrypt{0, EA_AES128, []byte("user"), []byte("owner"), -3884,
+		nil, nil, nil, nil, nil, nil}
+	e.init(id)
+
+	o := fmt.Sprintf("%X", e.o)
+	if o != "0BA3835F88F90388E74E54584125CE142BE0DE24C6B0D37746E075B891756671" {
+		t.Errorf("Expected O to match. Was %s", o)
+	}
+
+	u := fmt.Sprintf("%X", e.u[:16])
+	if u != "B554BF2A3BCB87B4892FA52E6D95663F" {
+		t.Errorf("Expected U to match. Was %s", u)
+	}
+}
+
+func TestEncryptR6(t *testing.T) {
+
+	e := &pdfEncrypt{0, EA_AES256, []byte("user"), []byte("owner"), -3884,
+		nil, nil, nil, nil, nil, nil}
+	r := make([]byte, 68)
+	for ix := range r {
+		r[ix] = byte(ix)
+	}
+	e.setKeysR6(r)
+
+	for _, c := range []struct {
+		name     string
+		v        []byte
+		expected string
+	}{
+		{"U", e.u, "0883BDD9F6387104B4382DC453DEA14D56EC345FC7E06B5DC5E22D4CDB744D7F202122232425262728292A2B2C2D2E2F"},
+		{"UE", e.ue, "0ACED4B8D236CE53B71FEBA657B9267D9A27E4CCC510F93C30E3A198B59A9B25"},
+		{"O", e.o, "641957C838A6AF724BADD497B43E3B232414FF58C797FD80CB5B3AA706837B6A303132333435363738393A3B3C3D3E3F"},
+		{"OE", e.oe, "E324F0D67EBEBC2337DE7CCE144767B118F16FD0E9F5F64A7A6B5CF657A41A41"},
+		{"Perms", e.perms, "CDAE32EBDE1EE1FB76A73591C0773035"},
+	} {
+		if v := fmt.Sprintf("%X", c.v); v != c.expected {
+			t.Errorf("Expected %s to match. Was %s", c.name, v)
+		}
+	}
+
+	if bytes.Equal(e.u[:32], hashR6([]byte("owner"), e.u[32:40], nil)) {
+		t.Errorf("Expected the owner password not to validate as the user password.")
+	}
+}
+
+// decryptData decrypts data encrypted with AES in CBC mode with
+// the initialization vector before it.
+func decryptData(t *testing.T, key, data []byte) []byte {
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		t.Fatalf("Expected whole blocks. Was %d bytes", len(data))
+	}
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(b, data[:aes.BlockSize]).CryptBlocks(plain, data[aes.BlockSize:])
+	pad := int(plain[len(plain)-1])
+	if pad < 1 || pad > aes.BlockSize {
+		t.Errorf("Expected valid padding. Was %d", pad)
+		return nil
+	}
+	return plain[:len(plain)-pad]
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+
+	for _, alg := range []EncryptionAlgorithm{EA_AES128, EA_AES256} {
+		var b bytes.Buffer
+		d := NewPdfDoc(&b, Encrypt(alg, "user", "owner", PM_Print))
+		d.SetMetadata(dox2go.Metadata{Title: "Secret title"})
+		f := d.CreateFont(FONT_Helvetica, dox2go.FS_Regular, 12)
+		d.CreatePage(dox2go.U_PT, 200, 200, dox2go.PO_Portrait).Surface().Text(f, 10, 10, "Secret text")
+		if err := d.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(b.Bytes(), []byte("Secret")) {
+			t.Errorf("Expected the text to be encrypted.")
+		}
+
+		// The encryption dictionary and trailer are not encrypted
+		// so they can be read without the key.
+		r := newReader(b.Bytes())
+		if err := r.readXrefs(); err != nil {
+			t.Fatal(err)
+		}
+		enc, _ := r.resolveDict(r.Trailer()["Encrypt"])
+		u, _ := enc["U"].(String)
+		o, _ := enc["O"].(String)
+		p, _ := enc["P"].(int)
+		id, _ := r.Trailer()["ID"].(Array)
+		fileId, _ := id[0].(String)
+
+		// The key of each object is derived from the file key,
+		// which is found with the user password.
+		var key func(id int) []byte
+		if alg == EA_AES256 {
+			ue, _ := enc["UE"].(String)
+			h, _ := aes.NewCipher(hashR6([]byte("user"), []byte(u[40:48]), nil))
+			fileKey := make([]byte, 32)
+			cipher.NewCBCDecrypter(h, make([]byte, aes.BlockSize)).CryptBlocks(fileKey, []byte(ue))
+			key = func(id int) []byte { return fileKey }
+		} else {
+			h := md5.New()
+			h.Write(padPassword([]byte("user")))
+			h.Write([]byte(o))
+			binary.Write(h, binary.LittleEndian, int32(p))
+			h.Write([]byte(fileId))
+			fileKey := rehash(h.Sum(nil))
+			if !bytes.Equal(rc4Rounds(fileKey, md5Sum(passwordPadding, []byte(fileId)))[:16], []byte(u[:16])) {
+				t.Errorf("Expected the user password to validate.")
+			}
+			key = func(id int) []byte {
+				return md5Sum(fileKey, []byte{byte(id), byte(id >> 8), byte(id >> 16), 0, 0}, []byte("sAlT"))
+			}
+		}
+
+		infoRef, _ := r.Trailer()["Info"].(Ref)
+		info, _ := r.resolveDict(infoRef)
+		title, _ := info["Title"].(String)
+		if s := decryptData(t, key(infoRef.Id), []byte(title)); string(s) != "Secret title" {
+			t.Errorf("Expected the title to be decrypted. Was %q", s)
+		}
+
+		cat, _ := r.Catalog()
+		pages, _ := r.resolveDict(cat["Pages"])
+		kids, _ := r.resolveArray(pages["Kids"])
+		page, _ := r.resolveDict(kids[0])
+		contentRef, _ := page["Contents"].(Ref)
+		o2, _ := r.Object(contentRef)
+		content, ok := o2.(*Stream)
+		if !ok {
+			t.Fatalf("Expected the page's content. Was %v", o2)
+		}
+		if s := decryptData(t, key(contentRef.Id), content.Data); !bytes.Contains(s, []byte("(Secret text) Tj")) {
+			t.Errorf("Expected the content to be decrypted. Was %q", s)
+		}
+	}
+}
+
+// md5Sum returns the MD5 hash of the concatenation of data.
+func md5Sum(data ...[]byte) []byte {
+	h := md5.New()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+func TestEncryptData(t *testing.T) {
+
+	key := []byte("0123456789ABCDEF")
+	for _, s := range []string{"", "secret", "exactly 16 bytes"} {
+		data, err := encryptData(key, []byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != encryptedLength(len(s)) {
+			t.Errorf("Expected %d bytes. Was %d", encryptedLength(len(s)), len(data))
+		}
+
+		b, _ := aes.NewCipher(key)
+		plain := make([]byte, len(data)-aes.BlockSize)
+		cipher.NewCBCDecrypter(b, data[:aes.BlockSize]).CryptBlocks(plain, data[aes.BlockSize:])
+		plain = plain[:len(plain)-int(plain[len(plain)-1])]
+		if string(plain) != s {
+			t.Errorf("Expected %s. Was %s", s, plain)
+		}
+	}
+}
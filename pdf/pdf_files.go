@@ -0,0 +1,327 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/adkennan/dox2go"
+)
+
+// defaultMimeType is used for embedded files without a MIME type.
+const defaultMimeType = "application/octet-stream"
+
+var ErrEmbeddedFile = errors.New("PDF/A-2 documents cannot contain embedded files")
+
+// relationships are the names of the relationships of associated
+// files, indexed by dox2go.FileRelationship.
+var relationships = [...]string{"Unspecified", "Source", "Data", "Alternative", "Supplement"}
+
+// newFileSpec adds an embedded file and the file specification
+// referring to it to the document.
+func (doc *pdfDoc) newFileSpec(f dox2go.EmbeddedFile) *pdfFileSpec {
+	if f.Relationship < 0 || int(f.Relationship) >= len(relationships) {
+		panic("Invalid File Relationship")
+	}
+	if f.MimeType == "" {
+		f.MimeType = defaultMimeType
+	}
+	if f.Modified.IsZero() {
+		f.Modified = time.Now()
+	}
+
+	ef := &pdfEmbeddedFile{len(doc.objs) + 1, f}
+	fs := &pdfFileSpec{len(doc.objs) + 2, f, ef}
+	doc.objs = append(doc.objs, ef, fs)
+	doc.files = append(doc.files, fs)
+	return fs
+}
+
+func (doc *pdfDoc) AttachFile(f dox2go.EmbeddedFile) {
+	fs := doc.newFileSpec(f)
+
+	// Files with the same name are all listed, under keys made
+	// unique with a suffix. Viewers show the name of the file
+	// rather than its key.
+	files := doc.names().files
+	key := f.Name
+	for n := 2; files[key] != nil; n++ {
+		key = fmt.Sprintf("%s_%d", f.Name, n)
+	}
+	files[key] = fs
+
+	if doc.assocFiles == nil {
+		doc.assocFiles = &pdfAssocFiles{len(doc.objs) + 1, make([]*pdfFileSpec, 0, 1)}
+		doc.objs = append(doc.objs, doc.assocFiles)
+		doc.catalog.objs = append(doc.catalog.objs, doc.assocFiles)
+	}
+	doc.assocFiles.files = append(doc.assocFiles.files, fs)
+}
+
+func (p *pdfPage) AttachFile(x, y, w, h float64, f dox2go.EmbeddedFile) {
+	fs := p.doc.newFileSpec(f)
+	a := &pdfFileAnnot{len(p.doc.objs) + 1, p.pageQuad(x, y, w, h).bounds(), fs, nil}
+	p.addAnnot(a)
+
+	// Annotations need an appearance in PDF/A documents so a
+	// simple icon is drawn rather than relying on the viewer.
+	pu := p.pu
+	aw := dox2go.ConvertUnit(a.r[2]-a.r[0], dox2go.U_PT, pu)
+	ah := dox2go.ConvertUnit(a.r[3]-a.r[1], dox2go.U_PT, pu)
+	a.ap = p.doc.newFormXObj(pu, aw, ah)
+
+	drawIcon(a.ap.sfc, aw, ah, lightGray)
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfEmbeddedFile is the stream holding the contents of an
+// embedded file.
+type pdfEmbeddedFile struct {
+	id int
+	f  dox2go.EmbeddedFile
+}
+
+func (e *pdfEmbeddedFile) Id() int {
+	return e.id
+}
+
+func (e *pdfEmbeddedFile) Type() string {
+	return "EmbeddedFile"
+}
+
+func (e *pdfEmbeddedFile) hasStream() bool {
+	return true
+}
+
+func (e *pdfEmbeddedFile) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(e, w)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := deflate(e.f.Data)
+	if err != nil {
+		return n, err
+	}
+	sum := md5.Sum(e.f.Data)
+
+	dw := dictionaryWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(e.Type())
+	dw.Name("Subtype")
+	dw.Name(e.f.MimeType)
+	dw.Name("Params")
+	dw.Start()
+	dw.Name("Size")
+	dw.Value(len(e.f.Data))
+	dw.Name("ModDate")
+	dw.String(pdfDate(e.f.Modified))
+	dw.Name("CheckSum")
+	dw.Bytes(sum[:])
+	dw.End()
+	dw.Name("Filter")
+	dw.Name("FlateDecode")
+	dw.Name("Length")
+	dw.Value(streamLength(w, len(data)))
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	n += dw.n
+
+	n2, err := startStream(w)
+	if err != nil {
+		return n, err
+	}
+	n += n2
+
+	n3, err := w.Write(data)
+	if err != nil {
+		return n, err
+	}
+	n += int64(n3)
+
+	n2, err = endStream(w)
+	if err != nil {
+		return n, err
+	}
+	n += n2
+	n2, err = endObj(e, w)
+	n += n2
+	return n, err
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfFileSpec is the file specification of an embedded file.
+type pdfFileSpec struct {
+	id int
+	f  dox2go.EmbeddedFile
+	ef *pdfEmbeddedFile
+}
+
+func (fs *pdfFileSpec) Id() int {
+	return fs.id
+}
+
+func (fs *pdfFileSpec) Type() string {
+	return "Filespec"
+}
+
+func (fs *pdfFileSpec) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(fs, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(fs.Type())
+	dw.Name("F")
+	dw.String(fs.f.Name)
+	dw.Name("UF")
+	dw.String(fs.f.Name)
+	if fs.f.Description != "" {
+		dw.Name("Desc")
+		dw.String(fs.f.Description)
+	}
+	dw.Name("EF")
+	dw.Start()
+	dw.Name("F")
+	dw.Ref(fs.ef)
+	dw.Name("UF")
+	dw.Ref(fs.ef)
+	dw.End()
+	dw.Name("AFRelationship")
+	dw.Name(relationships[fs.f.Relationship])
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	n += dw.n
+
+	n2, err := endObj(fs, w)
+	n += int64(n2)
+	return n, err
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfAssocFiles is the array of files associated with the
+// document as a whole.
+type pdfAssocFiles struct {
+	id    int
+	files []*pdfFileSpec
+}
+
+func (a *pdfAssocFiles) Id() int {
+	return a.id
+}
+
+func (a *pdfAssocFiles) Type() string {
+	return "AF"
+}
+
+func (a *pdfAssocFiles) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(a, w)
+	if err != nil {
+		return 0, err
+	}
+
+	aw := arrayWriter{w, 0, nil}
+	aw.Start()
+	for _, fs := range a.files {
+		aw.Ref(fs)
+	}
+	aw.End()
+
+	if aw.err != nil {
+		return n, aw.err
+	}
+	n += aw.n
+
+	n2, err := endObj(a, w)
+	n += int64(n2)
+	return n, err
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfFileAnnot is a file attachment annotation.
+type pdfFileAnnot struct {
+	id int
+	r  rect
+	fs *pdfFileSpec
+	ap *pdfFormXObj
+}
+
+func (a *pdfFileAnnot) Id() int {
+	return a.id
+}
+
+func (a *pdfFileAnnot) Type() string {
+	return "Annot"
+}
+
+func (a *pdfFileAnnot) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(a, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	aw := arrayWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(a.Type())
+	dw.Name("Subtype")
+	dw.Name("FileAttachment")
+	dw.Name("Rect")
+	a.r.write(&dw)
+	dw.Name("F")
+	dw.Value(4)
+	dw.Name("Contents")
+	if a.fs.f.Description != "" {
+		dw.String(a.fs.f.Description)
+	} else {
+		dw.String(a.fs.f.Name)
+	}
+	dw.Name("FS")
+	dw.Ref(a.fs)
+	dw.Name("AF")
+	aw.Start()
+	aw.Ref(a.fs)
+	aw.End()
+	dw.Name("AP")
+	dw.Start()
+	dw.Name("N")
+	dw.Ref(a.ap)
+	dw.End()
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	if aw.err != nil {
+		return n, aw.err
+	}
+	n += dw.n + aw.n
+
+	n2, err := endObj(a, w)
+	n += int64(n2)
+	return n, err
+}
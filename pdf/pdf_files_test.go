@@ -0,0 +1,87 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/adkennan/dox2go"
+)
+
+func TestAttachFile(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b, PdfA(PA_3B))
+	d.AttachFile(dox2go.EmbeddedFile{
+		Name:         "factur-x.xml",
+		MimeType:     "text/xml",
+		Description:  "Invoice data",
+		Modified:     time.Date(2013, 5, 1, 0, 0, 0, 0, time.UTC),
+		Data:         []byte("<invoice/>"),
+		Relationship: dox2go.FR_Alternative,
+	})
+	p := d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+	p.AttachFile(10, 10, 5, 5, dox2go.EmbeddedFile{Name: "notes.txt", Data: []byte("Notes")})
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{
+		"/EmbeddedFiles",
+		"(factur-x.xml)",
+		"/Subtype  /text#2Fxml",
+		"/Subtype  /application#2Foctet-stream",
+		"/AFRelationship  /Alternative",
+		"/AF",
+		"/CheckSum  <DFAD0E97C1CFADE81341EE51F96A955F>",
+		"/FileAttachment",
+		"(Invoice data)",
+	} {
+		if !bytes.Contains(b.Bytes(), []byte(s)) {
+			t.Errorf("Expected the document to contain %s", s)
+		}
+	}
+}
+
+func TestAttachFilePdfA2(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b, PdfA(PA_2B))
+	d.AttachFile(dox2go.EmbeddedFile{Name: "data.csv", Data: []byte("1,2")})
+	if err := d.Close(); err != ErrEmbeddedFile {
+		t.Errorf("Expected %v. Was %v", ErrEmbeddedFile, err)
+	}
+}
+
+func TestAttachFileSameName(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	d.AttachFile(dox2go.EmbeddedFile{Name: "a.txt", Data: []byte("A")})
+	d.AttachFile(dox2go.EmbeddedFile{Name: "a.txt", Data: []byte("B")})
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := readPdf(t, b.Bytes())
+	cat, _ := r.Catalog()
+	af, _ := r.resolveArray(cat["AF"])
+	names, _ := r.resolveDict(cat["Names"])
+	files, _ := r.resolveDict(names["EmbeddedFiles"])
+	tree, _ := r.resolveArray(files["Names"])
+	if len(af) != 2 || len(tree) != 4 {
+		t.Fatalf("Expected both files to be listed. Was %v and %v", af, tree)
+	}
+	if string(tree[0].(String)) != "a.txt" || string(tree[2].(String)) != "a.txt_2" {
+		t.Errorf("Expected unique names. Was %v and %v", tree[0], tree[2])
+	}
+	if tree[1] == tree[3] {
+		t.Errorf("Expected different files. Was %v", tree)
+	}
+}
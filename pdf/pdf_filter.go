@@ -0,0 +1,275 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io/ioutil"
+)
+
+var ErrUnsupportedFilter = errors.New("Unsupported stream filter")
+
+// decodeFilter removes one filter from the data of a stream.
+// Image filters such as DCTDecode are not supported as their
+// data is only useful to an image decoder.
+func decodeFilter(filter Name, params Dict, data []byte) ([]byte, error) {
+
+	switch filter {
+	case "FlateDecode", "Fl":
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		out, err := ioutil.ReadAll(r)
+		// Many writers leave the checksum off the end of the data.
+		if err != nil && len(out) == 0 {
+			return nil, err
+		}
+		return unpredict(params, out)
+
+	case "ASCIIHexDecode", "AHx":
+		return asciiHexDecode(data)
+
+	case "ASCII85Decode", "A85":
+		return ascii85Decode(data)
+
+	case "LZWDecode", "LZW":
+		data, err := lzwDecode(intParam(params, "EarlyChange", 1), data)
+		if err != nil {
+			return nil, err
+		}
+		return unpredict(params, data)
+
+	case "RunLengthDecode", "RL":
+		return runLengthDecode(data), nil
+	}
+
+	return nil, ErrUnsupportedFilter
+}
+
+func intParam(params Dict, key Name, def int) int {
+	if v, ok := params[key].(int); ok {
+		return v
+	}
+	return def
+}
+
+// unpredict reverses the PNG predictors applied to data before
+// it was compressed. The TIFF predictor is not supported.
+func unpredict(params Dict, data []byte) ([]byte, error) {
+
+	predictor := intParam(params, "Predictor", 1)
+	if predictor == 1 {
+		return data, nil
+	}
+	if predictor == 2 {
+		return nil, ErrUnsupportedFilter
+	}
+
+	colors := intParam(params, "Colors", 1)
+	bpc := intParam(params, "BitsPerComponent", 8)
+	columns := intParam(params, "Columns", 1)
+	if colors <= 0 || colors > 32 || bpc <= 0 || bpc > 16 || columns <= 0 || columns > 1<<24 {
+		return nil, &ParseError{0, "Invalid predictor parameters"}
+	}
+
+	bpp := (colors*bpc + 7) / 8
+	rowLen := (colors*bpc*columns + 7) / 8
+	if rowLen > len(data) {
+		// The data does not hold a full row.
+		rowLen = len(data)
+	}
+
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for len(data) > 0 {
+		n := rowLen + 1
+		if n > len(data) {
+			n = len(data)
+		}
+		row := make([]byte, rowLen)
+		copy(row, data[1:n])
+		filter := data[0]
+		data = data[n:]
+
+		for i := 0; i < rowLen; i++ {
+			var left, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up := prev[i]
+			switch filter {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func asciiHexDecode(data []byte) ([]byte, error) {
+	l := &lexer{append(append([]byte{'<'}, bytes.TrimSpace(data)...), '>'), 0}
+	if i := bytes.IndexByte(l.b, '>'); i < len(l.b)-1 {
+		l.b = l.b[:i+1]
+	}
+	s, err := l.hexString()
+	if err != nil {
+		return nil, err
+	}
+	return s.(String), nil
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+
+	var out []byte
+	var v uint32
+	n := 0
+	for _, c := range data {
+		if c == '~' {
+			break
+		}
+		if isWhite(c) {
+			continue
+		}
+		if c == 'z' && n == 0 {
+			out = append(out, 0, 0, 0, 0)
+			continue
+		}
+		if c < '!' || c > 'u' {
+			return nil, errors.New("Invalid ASCII85 data")
+		}
+		v = v*85 + uint32(c-'!')
+		n++
+		if n == 5 {
+			out = append(out, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+			v = 0
+			n = 0
+		}
+	}
+
+	if n > 0 {
+		for i := n; i < 5; i++ {
+			v = v*85 + 84
+		}
+		out = append(out, []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}[:n-1]...)
+	}
+	return out, nil
+}
+
+// lzwDecode decodes LZW compressed data. Unless early is 0
+// the width of codes increases one code early.
+func lzwDecode(early int, data []byte) ([]byte, error) {
+
+	const clear, eod = 256, 257
+
+	table := make([][]byte, eod+1, 4096)
+	for i := 0; i < 256; i++ {
+		table[i] = []byte{byte(i)}
+	}
+
+	var out, prev []byte
+	var bits uint32
+	nbits := 0
+	width := uint(9)
+
+	for _, c := range data {
+		bits = bits<<8 | uint32(c)
+		nbits += 8
+		for nbits >= int(width) {
+			nbits -= int(width)
+			code := int(bits>>uint(nbits)) & (1<<width - 1)
+
+			if code == clear {
+				table = table[:eod+1]
+				width = 9
+				prev = nil
+				continue
+			}
+			if code == eod {
+				return out, nil
+			}
+
+			var entry []byte
+			if code < len(table) && code != clear && code != eod {
+				entry = table[code]
+			} else if code == len(table) && prev != nil {
+				entry = append(append([]byte{}, prev...), prev[0])
+			} else {
+				return nil, errors.New("Invalid LZW data")
+			}
+			out = append(out, entry...)
+
+			if prev != nil && len(table) < cap(table) {
+				table = append(table, append(append([]byte{}, prev...), entry[0]))
+			}
+			prev = entry
+
+			if len(table)+early >= 1<<width && width < 12 {
+				width++
+			}
+		}
+	}
+	return out, nil
+}
+
+func runLengthDecode(data []byte) []byte {
+
+	var out []byte
+	for i := 0; i < len(data); {
+		n := int(data[i])
+		i++
+		switch {
+		case n == 128:
+			return out
+		case n < 128:
+			end := i + n + 1
+			if end > len(data) {
+				end = len(data)
+			}
+			out = append(out, data[i:end]...)
+			i = end
+		case i < len(data):
+			for j := 0; j < 257-n; j++ {
+				out = append(out, data[i])
+			}
+			i++
+		}
+	}
+	return out
+}
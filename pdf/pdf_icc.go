@@ -0,0 +1,141 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// srgbDescription names the sRGB color space in the ICC profile
+// and output intents.
+const srgbDescription = "sRGB IEC61966-2.1"
+
+// srgbCurvePoints is the number of entries in the tone
+// reproduction curve of the sRGB profile.
+const srgbCurvePoints = 1024
+
+type iccTag struct {
+	sig  string
+	data []byte
+}
+
+// s15Fixed16 converts v to the fixed point format used by
+// ICC profiles.
+func s15Fixed16(v float64) int32 {
+	return int32(math.Floor(v*65536 + 0.5))
+}
+
+func iccXYZ(x, y, z float64) []byte {
+	var b bytes.Buffer
+	b.WriteString("XYZ ")
+	binary.Write(&b, binary.BigEndian, []int32{0, s15Fixed16(x), s15Fixed16(y), s15Fixed16(z)})
+	return b.Bytes()
+}
+
+func iccText(s string) []byte {
+	var b bytes.Buffer
+	b.WriteString("text")
+	b.Write(make([]byte, 4))
+	b.WriteString(s)
+	b.WriteByte(0)
+	return b.Bytes()
+}
+
+// iccDescription encodes a version 2 textDescriptionType with
+// an ASCII description and empty Unicode and ScriptCode
+// descriptions.
+func iccDescription(s string) []byte {
+	var b bytes.Buffer
+	b.WriteString("desc")
+	b.Write(make([]byte, 4))
+	binary.Write(&b, binary.BigEndian, uint32(len(s)+1))
+	b.WriteString(s)
+	b.WriteByte(0)
+	b.Write(make([]byte, 4+4+2+1+67))
+	return b.Bytes()
+}
+
+// iccSrgbCurve samples the sRGB transfer function.
+func iccSrgbCurve() []byte {
+	var b bytes.Buffer
+	b.WriteString("curv")
+	b.Write(make([]byte, 4))
+	binary.Write(&b, binary.BigEndian, uint32(srgbCurvePoints))
+	for ix := 0; ix < srgbCurvePoints; ix++ {
+		v := float64(ix) / (srgbCurvePoints - 1)
+		if v <= 0.04045 {
+			v = v / 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		binary.Write(&b, binary.BigEndian, uint16(math.Floor(v*65535+0.5)))
+	}
+	return b.Bytes()
+}
+
+// srgbProfile builds a version 2 ICC display profile describing
+// the sRGB color space, used as the output intent of PDF/A
+// documents.
+func srgbProfile() []byte {
+
+	trc := iccSrgbCurve()
+
+	// The colorants are adapted to the D50 illuminant of the
+	// profile connection space.
+	tags := []iccTag{
+		{"desc", iccDescription(srgbDescription)},
+		{"cprt", iccText("No copyright, use freely")},
+		{"wtpt", iccXYZ(0.9642, 1.0, 0.8249)},
+		{"rXYZ", iccXYZ(0.4360747, 0.2225045, 0.0139322)},
+		{"gXYZ", iccXYZ(0.3850649, 0.7168786, 0.0971045)},
+		{"bXYZ", iccXYZ(0.1430804, 0.0606169, 0.7141733)},
+		{"rTRC", trc},
+		{"gTRC", trc},
+		{"bTRC", trc},
+	}
+
+	// Tag data follows the header and tag table, each tag
+	// aligned to four bytes. The curves share their data.
+	var table, data bytes.Buffer
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	start := 128 + 4 + 12*len(tags)
+	offsets := make(map[*byte]int)
+	for _, t := range tags {
+		off, shared := offsets[&t.data[0]]
+		if !shared {
+			off = start + data.Len()
+			offsets[&t.data[0]] = off
+			data.Write(t.data)
+			for data.Len()%4 != 0 {
+				data.WriteByte(0)
+			}
+		}
+		table.WriteString(t.sig)
+		binary.Write(&table, binary.BigEndian, []uint32{uint32(off), uint32(len(t.data))})
+	}
+
+	size := start + data.Len()
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(size))
+	b.Write(make([]byte, 4))
+	binary.Write(&b, binary.BigEndian, uint32(0x02100000))
+	b.WriteString("mntrRGB XYZ ")
+	binary.Write(&b, binary.BigEndian, []uint16{2013, 1, 1, 0, 0, 0})
+	b.WriteString("acsp")
+	b.Write(make([]byte, 4+4+4+4+8+4))
+	binary.Write(&b, binary.BigEndian, []int32{s15Fixed16(0.9642), s15Fixed16(1.0), s15Fixed16(0.8249)})
+	b.Write(make([]byte, 128-b.Len()))
+
+	table.WriteTo(&b)
+	data.WriteTo(&b)
+
+	return b.Bytes()
+}
@@ -9,16 +9,37 @@ package pdf
 
 import (
 	"bytes"
+	"compress/zlib"
+	"encoding/hex"
 	"image"
+	"image/color"
 	"io"
+
+	"github.com/adkennan/dox2go"
 )
 
 type pdfImage struct {
-	id   int
-	src  image.Image
-	mask *pdfImageMask
+	id       int
+	src      image.Image
+	mask     *pdfImageMask
+	dpiX     float64
+	dpiY     float64
+	stencil  bool
+	colorKey []dox2go.Color
+	encoded  *encodedImage
+	inlined  []byte
+}
+
+// encodedImage holds the compressed pixels of an image that
+// was encoded before it was written.
+type encodedImage struct {
+	sf      sampleFormat
+	bilevel bool
+	data    sizedBuffer
 }
 
+// Id returns 0 for images that are only drawn inline as they
+// are not objects of the document.
 func (i *pdfImage) Id() int {
 	return i.id
 }
@@ -31,40 +52,111 @@ func (i *pdfImage) Height() int {
 	return i.src.Bounds().Dy()
 }
 
+func (i *pdfImage) Dpi() (x, y float64) {
+	return i.dpiX, i.dpiY
+}
+
+func (i *pdfImage) SetDpi(x, y float64) {
+	i.dpiX = x
+	i.dpiY = y
+}
+
+func (i *pdfImage) SetColorKey(min, max dox2go.Color) {
+	i.colorKey = []dox2go.Color{min, max}
+	i.inlined = nil
+}
+
 func (i *pdfImage) Type() string {
 	return "XObject"
 }
 
+func (i *pdfImage) hasStream() bool {
+	return true
+}
+
 func (i *pdfImage) WriteTo(w io.Writer) (n int64, err error) {
 	n, err = startObj(i, w)
 	if err != nil {
 		return 0, err
 	}
 
+	e := i.encoded
+	if e == nil {
+		data := new(bytes.Buffer)
+		sf, bilevel, err := i.encode(data)
+		if err != nil {
+			return n, err
+		}
+		e = &encodedImage{sf, bilevel, data}
+	}
+	sf, bilevel := e.sf, e.bilevel
+
 	dw := dictionaryWriter{w, 0, nil}
+	aw := arrayWriter{w, 0, nil}
 	dw.Start()
 	dw.Name("Type")
 	dw.Name(i.Type())
 	dw.Name("Subtype")
 	dw.Name("Image")
-	dw.Name("ColorSpace")
-	dw.Name("DeviceRGB")
-	dw.Name("BitsPerComponent")
-	dw.Value(8)
+	if i.stencil {
+		dw.Name("ImageMask")
+		dw.Value("true")
+		dw.Name("BitsPerComponent")
+		dw.Value(1)
+	} else if bilevel {
+		dw.Name("ColorSpace")
+		dw.Name("DeviceGray")
+		dw.Name("BitsPerComponent")
+		dw.Value(1)
+	} else {
+		dw.Name("ColorSpace")
+		dw.Name(sf.colorSpace)
+		dw.Name("BitsPerComponent")
+		dw.Value(sf.bpc)
+	}
 	dw.Name("Width")
 	dw.Value(i.Width())
 	dw.Name("Height")
 	dw.Value(i.Height())
+	if bilevel {
+		dw.Name("Filter")
+		dw.Name("CCITTFaxDecode")
+		dw.Name("DecodeParms")
+		dw.Start()
+		dw.Name("K")
+		dw.Value(-1)
+		dw.Name("Columns")
+		dw.Value(i.Width())
+		dw.Name("Rows")
+		dw.Value(i.Height())
+		dw.End()
+	} else {
+		dw.Name("Filter")
+		dw.Name("FlateDecode")
+	}
 	dw.Name("Length")
-	dw.Value(3 * i.Width() * i.Height())
-	dw.Name("SMask")
-	dw.Ref(i.mask)
+	dw.Value(streamLength(w, e.data.Len()))
+	if i.colorKey != nil && !i.stencil {
+		dw.Name("Mask")
+		aw.Start()
+		for _, v := range sf.colorKeyRange(i.colorKey[0], i.colorKey[1]) {
+			aw.Value(v)
+			aw.Value(" ")
+		}
+		aw.End()
+	} else if !bilevel && i.mask != nil && i.mask.w != 0 {
+		dw.Name("SMask")
+		dw.Ref(i.mask)
+	}
 	dw.End()
 
 	if dw.err != nil {
 		return 0, dw.err
 	}
-	n += dw.n
+	if aw.err != nil {
+		return 0, aw.err
+	}
+	n += dw.n + aw.n
 
 	n2, err := startStream(w)
 	if err != nil {
@@ -72,21 +164,11 @@ func (i *pdfImage) WriteTo(w io.Writer) (n int64, err error) {
 	}
 	n += int64(n2)
 
-	b := i.src.Bounds()
-	for y := b.Min.Y; y < b.Max.Y; y++ {
-		for x := b.Min.X; x < b.Max.X; x++ {
-			r, g, b, a := i.src.At(x, y).RGBA()
-			n3, err := w.Write([]byte{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)})
-			if err != nil {
-				return n, err
-			}
-			i.mask.content.WriteByte(uint8(a >> 8))
-			n += int64(n3)
-		}
+	n3, err := e.data.WriteTo(w)
+	if err != nil {
+		return n, err
 	}
-
-	i.mask.w = i.Width()
-	i.mask.h = i.Height()
+	n += n3
 
 	n2, err = endStream(w)
 	if err != nil {
@@ -98,11 +180,375 @@ func (i *pdfImage) WriteTo(w io.Writer) (n int64, err error) {
 	return n, err
 }
 
+// needsMask reports whether the image has transparent pixels
+// that are written to a soft mask.
+func (i *pdfImage) needsMask() bool {
+
+	if i.stencil || i.colorKey != nil || !i.sampleFormat().alpha {
+		return false
+	}
+	return !isOpaque(i.src) && !isBilevel(i.src)
+}
+
+// encode writes the compressed pixels of the image to w and
+// returns the format they were written in. Bilevel images are
+// encoded with CCITT Group 4 and all others with Flate.
+func (i *pdfImage) encode(w io.Writer) (sf sampleFormat, bilevel bool, err error) {
+
+	sf = i.sampleFormat()
+	bilevel = i.stencil || (i.colorKey == nil && sf.colorSpace != "DeviceCMYK" && isBilevel(i.src))
+	if bilevel {
+		_, err = w.Write(ccittG4Encode(i.bilevelPixels(), i.Width(), i.Height()))
+	} else {
+		err = deflateTo(w, i.samples(sf))
+	}
+	return
+}
+
+// Images with no more than this many bytes of uncompressed
+// samples are drawn as inline images.
+const inlineImageMaxBytes = 4096
+
+// inline reports whether the image can be drawn as an inline
+// image in a content stream instead of as an XObject. Inline
+// images must be small and cannot have soft masks or color keys.
+func (i *pdfImage) inline() bool {
+
+	if i.colorKey != nil {
+		return false
+	}
+
+	sf := i.sampleFormat()
+	if i.stencil {
+		sf = sampleFormat{"DeviceGray", 1, false}
+	}
+
+	if (i.Width()*sf.components()*sf.bpc+7)/8*i.Height() > inlineImageMaxBytes {
+		return false
+	}
+
+	return i.stencil || !sf.alpha || isOpaque(i.src)
+}
+
+var inlineColorSpaces = map[string]string{
+	"DeviceGray": "G",
+	"DeviceRGB":  "RGB",
+	"DeviceCMYK": "CMYK",
+}
+
+// writeInline writes the image to a content stream as an
+// inline image. The data is hex encoded so that it cannot
+// be mistaken for the end of the image. The image is encoded
+// once however many times it is drawn.
+func (i *pdfImage) writeInline(w io.Writer) error {
+
+	if i.inlined == nil {
+		var b bytes.Buffer
+		if err := i.encodeInline(&b); err != nil {
+			return err
+		}
+		i.inlined = b.Bytes()
+	}
+	_, err := w.Write(i.inlined)
+	return err
+}
+
+func (i *pdfImage) encodeInline(w io.Writer) error {
+
+	var data bytes.Buffer
+	sf, bilevel, err := i.encode(&data)
+	if err != nil {
+		return err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	dw.Value("BI")
+	dw.Name("W")
+	dw.Value(i.Width())
+	dw.Name("H")
+	dw.Value(i.Height())
+	if i.stencil {
+		dw.Name("IM")
+		dw.Value("true")
+		dw.Name("BPC")
+		dw.Value(1)
+	} else if bilevel {
+		dw.Name("CS")
+		dw.Name("G")
+		dw.Name("BPC")
+		dw.Value(1)
+	} else {
+		dw.Name("CS")
+		dw.Name(inlineColorSpaces[sf.colorSpace])
+		dw.Name("BPC")
+		dw.Value(sf.bpc)
+	}
+	if bilevel {
+		dw.Name("F")
+		dw.Value("[/AHx /CCF]")
+		dw.Name("DP")
+		dw.Value("[null <<")
+		dw.Name("K")
+		dw.Value(-1)
+		dw.Name("Columns")
+		dw.Value(i.Width())
+		dw.Name("Rows")
+		dw.Value(i.Height())
+		dw.Value(">>]")
+	} else {
+		dw.Name("F")
+		dw.Value("[/AHx /Fl]")
+	}
+	dw.Value("\r\nID ")
+	dw.Value(hex.EncodeToString(data.Bytes()))
+	dw.Value(">\r\nEI\r\n")
+
+	return dw.err
+}
+
+func (sf sampleFormat) components() int {
+	switch sf.colorSpace {
+	case "DeviceGray":
+		return 1
+	case "DeviceCMYK":
+		return 4
+	}
+	return 3
+}
+
+// sampleFormat describes the color space and sample size
+// used to write the pixels of an image.
+type sampleFormat struct {
+	colorSpace string
+	bpc        int
+	alpha      bool
+}
+
+// sampleFormat chooses the format that best preserves the
+// pixels of the source image. CMYK images with a color key
+// are written as RGB, as the key is given as RGB colors; gray
+// images keep their gray samples and the key is converted to
+// gray.
+func (i *pdfImage) sampleFormat() sampleFormat {
+
+	switch i.src.(type) {
+	case *image.RGBA64, *image.NRGBA64:
+		return sampleFormat{"DeviceRGB", 16, true}
+	case *image.Gray16:
+		return sampleFormat{"DeviceGray", 16, false}
+	case *image.Gray:
+		return sampleFormat{"DeviceGray", 8, false}
+	case *image.CMYK:
+		if i.colorKey == nil {
+			return sampleFormat{"DeviceCMYK", 8, false}
+		}
+	}
+
+	return sampleFormat{"DeviceRGB", 8, true}
+}
+
+// deviceCMYK reports whether the image is written with the
+// DeviceCMYK color space.
+func (i *pdfImage) deviceCMYK() bool {
+	return !i.stencil && i.sampleFormat().colorSpace == "DeviceCMYK"
+}
+
+// colorKeyRange returns the values of the Mask array that
+// makes colors between min and max transparent.
+func (sf sampleFormat) colorKeyRange(min, max dox2go.Color) []int {
+
+	var r []int
+	if sf.colorSpace == "DeviceGray" {
+		gMin := color.GrayModel.Convert(color.RGBA{min.R, min.G, min.B, 0xFF}).(color.Gray)
+		gMax := color.GrayModel.Convert(color.RGBA{max.R, max.G, max.B, 0xFF}).(color.Gray)
+		r = []int{int(gMin.Y), int(gMax.Y)}
+	} else {
+		r = []int{int(min.R), int(max.R), int(min.G), int(max.G), int(min.B), int(max.B)}
+	}
+
+	if sf.bpc == 16 {
+		for ix := range r {
+			r[ix] *= 0x101
+		}
+	}
+	return r
+}
+
+// samples returns the pixels of the image in the supplied
+// format. When the format has an alpha channel and the image
+// has no color key the alpha channel is written to the soft
+// mask.
+func (i *pdfImage) samples(sf sampleFormat) []byte {
+
+	useMask := sf.alpha && i.colorKey == nil && i.mask != nil
+
+	data := make([]byte, 0, 4*i.Width()*i.Height())
+
+	b := i.src.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := i.src.At(x, y)
+
+			switch {
+			case sf.colorSpace == "DeviceCMYK":
+				k := color.CMYKModel.Convert(c).(color.CMYK)
+				data = append(data, k.C, k.M, k.Y, k.K)
+
+			case sf.colorSpace == "DeviceGray" && sf.bpc == 16:
+				g := color.Gray16Model.Convert(c).(color.Gray16)
+				data = append(data, uint8(g.Y>>8), uint8(g.Y))
+
+			case sf.colorSpace == "DeviceGray":
+				g := color.GrayModel.Convert(c).(color.Gray)
+				data = append(data, g.Y)
+
+			case sf.bpc == 16:
+				n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+				data = append(data,
+					uint8(n.R>>8), uint8(n.R),
+					uint8(n.G>>8), uint8(n.G),
+					uint8(n.B>>8), uint8(n.B))
+				if useMask {
+					i.mask.content.Write([]byte{uint8(n.A >> 8), uint8(n.A)})
+				}
+
+			default:
+				r, g, b, a := c.RGBA()
+				data = append(data, uint8(r>>8), uint8(g>>8), uint8(b>>8))
+				if useMask {
+					i.mask.content.WriteByte(uint8(a >> 8))
+				}
+			}
+		}
+	}
+
+	if useMask {
+		i.mask.w = i.Width()
+		i.mask.h = i.Height()
+		i.mask.bpc = sf.bpc
+	}
+
+	return data
+}
+
+// bilevelPixels returns the image with one byte per pixel, 1 for
+// black and 0 for white. For stencils the dark, opaque pixels that
+// are painted with the fill color are black.
+func (i *pdfImage) bilevelPixels() []byte {
+
+	pix := make([]byte, 0, i.Width()*i.Height())
+
+	b := i.src.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if isDark(i.src.At(x, y)) {
+				pix = append(pix, 1)
+			} else {
+				pix = append(pix, 0)
+			}
+		}
+	}
+
+	return pix
+}
+
+func isDark(c color.Color) bool {
+	_, _, _, a := c.RGBA()
+	g := color.Gray16Model.Convert(c).(color.Gray16)
+	return a >= 0x8000 && g.Y < 0x8000
+}
+
+// isBilevel reports whether every pixel of an image is
+// opaque black or opaque white.
+func isBilevel(src image.Image) bool {
+
+	switch s := src.(type) {
+	case *image.Paletted:
+		for _, c := range s.Palette {
+			if !isBlackOrWhite(c) {
+				return false
+			}
+		}
+		return true
+
+	case *image.Gray:
+		b := s.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for _, v := range s.Pix[s.PixOffset(b.Min.X, y):s.PixOffset(b.Max.X, y)] {
+				if v != 0 && v != 0xFF {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	b := src.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if !isBlackOrWhite(src.At(x, y)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isOpaque reports whether every pixel of an image is opaque.
+func isOpaque(src image.Image) bool {
+
+	if o, ok := src.(interface {
+		Opaque() bool
+	}); ok {
+		return o.Opaque()
+	}
+
+	b := src.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := src.At(x, y).RGBA(); a != 0xFFFF {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isBlackOrWhite(c color.Color) bool {
+	r, g, b, a := c.RGBA()
+	if a != 0xFFFF {
+		return false
+	}
+	return (r == 0 && g == 0 && b == 0) ||
+		(r == 0xFFFF && g == 0xFFFF && b == 0xFFFF)
+}
+
+// deflate compresses data for use with the FlateDecode filter.
+func deflate(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	if err := deflateTo(&b, data); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// deflateTo compresses data for use with the FlateDecode filter
+// and writes it to w.
+func deflateTo(w io.Writer, data []byte) error {
+	zw := zlib.NewWriter(w)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
 type pdfImageMask struct {
 	id      int
 	w       int
 	h       int
+	bpc     int
 	content bytes.Buffer
+	data    sizedBuffer
 }
 
 func (i *pdfImageMask) Id() int {
@@ -113,6 +559,10 @@ func (i *pdfImageMask) Type() string {
 	return "XObject"
 }
 
+func (i *pdfImageMask) hasStream() bool {
+	return true
+}
+
 func (i *pdfImageMask) WriteTo(w io.Writer) (n int64, err error) {
 
 	n, err = startObj(i, w)
@@ -120,6 +570,15 @@ func (i *pdfImageMask) WriteTo(w io.Writer) (n int64, err error) {
 		return 0, err
 	}
 
+	data := i.data
+	if data == nil {
+		b, err := deflate(i.content.Bytes())
+		if err != nil {
+			return n, err
+		}
+		data = bytes.NewBuffer(b)
+	}
+
 	dw := dictionaryWriter{w, 0, nil}
 	dw.Start()
 	dw.Name("Type")
@@ -129,13 +588,15 @@ func (i *pdfImageMask) WriteTo(w io.Writer) (n int64, err error) {
 	dw.Name("ColorSpace")
 	dw.Name("DeviceGray")
 	dw.Name("BitsPerComponent")
-	dw.Value(8)
+	dw.Value(i.bpc)
 	dw.Name("Width")
 	dw.Value(i.w)
 	dw.Name("Height")
 	dw.Value(i.h)
+	dw.Name("Filter")
+	dw.Name("FlateDecode")
 	dw.Name("Length")
-	dw.Value(i.w * i.h)
+	dw.Value(streamLength(w, data.Len()))
 	dw.End()
 
 	if dw.err != nil {
@@ -149,11 +610,11 @@ func (i *pdfImageMask) WriteTo(w io.Writer) (n int64, err error) {
 	}
 	n += n2
 
-	n3, err := i.content.WriteTo(w)
+	n3, err := data.WriteTo(w)
 	if err != nil {
 		return n, err
 	}
-	n += int64(n3)
+	n += n3
 
 	n2, err = endStream(w)
 	if err != nil {
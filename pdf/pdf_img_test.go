@@ -0,0 +1,315 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"testing"
+
+	d2g "github.com/adkennan/dox2go"
+)
+
+func checkSamples(t *testing.T, src image.Image, cs string, bpc int, expected []byte) {
+	i := &pdfImage{1, src, &pdfImageMask{2, 0, 0, 8, bytes.Buffer{}, nil}, 72, 72, false, nil, nil, nil}
+
+	sf := i.sampleFormat()
+	if sf.colorSpace != cs || sf.bpc != bpc {
+		t.Errorf("Expected %s %d. Was %s %d", cs, bpc, sf.colorSpace, sf.bpc)
+	}
+
+	v := i.samples(sf)
+	if !bytes.Equal(v, expected) {
+		t.Errorf("Expected % x. Was % x", expected, v)
+	}
+}
+
+func TestImageSamples(t *testing.T) {
+
+	r := image.Rect(0, 0, 1, 1)
+
+	rgba64 := image.NewRGBA64(r)
+	rgba64.SetRGBA64(0, 0, color.RGBA64{0x1234, 0x5678, 0x9ABC, 0xFFFF})
+	checkSamples(t, rgba64, "DeviceRGB", 16, []byte{0x12, 0x34, 0x56, 0x78, 0x9A, 0xBC})
+
+	gray16 := image.NewGray16(r)
+	gray16.SetGray16(0, 0, color.Gray16{0x1234})
+	checkSamples(t, gray16, "DeviceGray", 16, []byte{0x12, 0x34})
+
+	cmyk := image.NewCMYK(r)
+	cmyk.SetCMYK(0, 0, color.CMYK{1, 2, 3, 4})
+	checkSamples(t, cmyk, "DeviceCMYK", 8, []byte{1, 2, 3, 4})
+
+	rgba := image.NewRGBA(r)
+	rgba.SetRGBA(0, 0, color.RGBA{1, 2, 3, 0xFF})
+	checkSamples(t, rgba, "DeviceRGB", 8, []byte{1, 2, 3})
+}
+
+func TestInlineImage(t *testing.T) {
+
+	small := image.NewGray(image.Rect(0, 0, 8, 8))
+	i := &pdfImage{0, small, nil, 72, 72, false, nil, nil, nil}
+	if !i.inline() {
+		t.Errorf("Expected small opaque image to be inline.")
+	}
+
+	var b bytes.Buffer
+	if err := i.writeInline(&b); err != nil {
+		t.Error(err)
+	}
+	if !bytes.HasPrefix(b.Bytes(), []byte("BI")) || !bytes.HasSuffix(b.Bytes(), []byte("EI\r\n")) {
+		t.Errorf("Expected an inline image. Was %s", b.String())
+	}
+
+	// The image is encoded once.
+	small.Pix[0] = 0x80
+	var again bytes.Buffer
+	if err := i.writeInline(&again); err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(b.Bytes(), again.Bytes()) {
+		t.Errorf("Expected the same inline image to be written again.")
+	}
+
+	i.SetColorKey(d2g.RGB(0, 0, 0), d2g.RGB(0, 0, 0))
+	if i.inline() {
+		t.Errorf("Expected image with a color key not to be inline.")
+	}
+
+	transparent := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	i = &pdfImage{0, transparent, nil, 72, 72, false, nil, nil, nil}
+	if i.inline() {
+		t.Errorf("Expected transparent image not to be inline.")
+	}
+
+	large := image.NewGray(image.Rect(0, 0, 100, 100))
+	large.Pix[1] = 0x80
+	i = &pdfImage{0, large, nil, 72, 72, false, nil, nil, nil}
+	if i.inline() {
+		t.Errorf("Expected large image not to be inline.")
+	}
+}
+
+// drawnImages draws images on a page and returns the image
+// XObjects of the page as they are read.
+func drawnImages(t *testing.T, images func(d *pdfDoc) []d2g.Image) (*Reader, []Dict) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	p := d.CreatePage(d2g.U_PT, 200, 200, d2g.PO_Portrait)
+	for _, i := range images(d.(*pdfDoc)) {
+		p.Surface().Image(i, 0, 0, 100, 100)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := readPdf(t, b.Bytes())
+	page, _ := r.Page(0)
+	res, _ := page.Resources()
+	xobjs, _ := r.resolveDict(res["XObject"])
+	keys := make([]string, 0, len(xobjs))
+	for k := range xobjs {
+		keys = append(keys, string(k))
+	}
+	sortNames(keys)
+	var out []Dict
+	for _, k := range keys {
+		s, _ := r.Resolve(xobjs[Name(k)])
+		if stm, ok := s.(*Stream); ok {
+			out = append(out, stm.Dict)
+		}
+	}
+	return r, out
+}
+
+func TestStencil(t *testing.T) {
+
+	src := image.NewNRGBA(image.Rect(0, 0, 200, 200))
+	src.Set(10, 10, color.Black)
+
+	_, images := drawnImages(t, func(d *pdfDoc) []d2g.Image {
+		return []d2g.Image{d.CreateStencil(src)}
+	})
+	if len(images) != 1 {
+		t.Fatalf("Expected 1 image. Was %d", len(images))
+	}
+	s := images[0]
+	if s["ImageMask"] != true || s["BitsPerComponent"] != 1 || s["ColorSpace"] != nil {
+		t.Errorf("Expected a stencil mask. Was %v", s)
+	}
+	if s["SMask"] != nil || s["Mask"] != nil {
+		t.Errorf("Expected a stencil not to be masked. Was %v", s)
+	}
+
+	// Dark pixels are encoded as black, 0, which the default
+	// decode array of a stencil paints.
+	if d, ok := s["Decode"].(Array); ok && (len(d) != 2 || d[0] != 0 || d[1] != 1) {
+		t.Errorf("Expected the default decode array. Was %v", d)
+	}
+	if parms, _ := s["DecodeParms"].(Dict); parms["BlackIs1"] == true {
+		t.Errorf("Expected black to be 0. Was %v", parms)
+	}
+	i := &pdfImage{0, src, nil, 72, 72, true, nil, nil, nil}
+	pix := i.bilevelPixels()
+	if pix[10*200+10] != 1 || pix[0] != 0 {
+		t.Errorf("Expected only the dark pixel to be painted.")
+	}
+}
+
+func TestColorKey(t *testing.T) {
+
+	r := image.Rect(0, 0, 100, 100)
+	rgb := image.NewNRGBA(r)
+	rgb.Set(1, 1, color.NRGBA{0x10, 0x20, 0x30, 0x80})
+	gray := image.NewGray(r)
+	gray.Pix[1] = 0x80
+	gray16 := image.NewGray16(r)
+	gray16.Pix[1] = 0x80
+
+	_, images := drawnImages(t, func(d *pdfDoc) []d2g.Image {
+		var out []d2g.Image
+		for _, src := range []image.Image{rgb, gray, gray16} {
+			i := d.CreateImage(src)
+			i.(d2g.ColorKeyed).SetColorKey(d2g.RGB(0xFF, 0, 0), d2g.RGB(0xFF, 0x10, 0x10))
+			out = append(out, i)
+		}
+		return out
+	})
+
+	expected := []Array{
+		{0xFF, 0xFF, 0, 0x10, 0, 0x10},
+		{0x4C, 0x57},
+		{0x4C * 0x101, 0x57 * 0x101},
+	}
+	if len(images) != len(expected) {
+		t.Fatalf("Expected %d images. Was %d", len(expected), len(images))
+	}
+	for ix, s := range images {
+		m, _ := s["Mask"].(Array)
+		if len(m) != len(expected[ix]) {
+			t.Errorf("Expected a mask of %v. Was %v", expected[ix], s["Mask"])
+			continue
+		}
+		for j := range m {
+			if m[j] != expected[ix][j] {
+				t.Errorf("Expected a mask of %v. Was %v", expected[ix], m)
+				break
+			}
+		}
+		if s["SMask"] != nil {
+			t.Errorf("Expected a color keyed image not to have a soft mask. Was %v", s["SMask"])
+		}
+	}
+}
+
+func TestSoftMask(t *testing.T) {
+
+	r := image.Rect(0, 0, 100, 100)
+	opaque := image.NewNRGBA(r)
+	for ix := 3; ix < len(opaque.Pix); ix += 4 {
+		opaque.Pix[ix] = 0xFF
+	}
+	opaque.Pix[0] = 0x80
+	transparent := image.NewNRGBA(r)
+	transparent.Pix[0] = 0x80
+
+	rd, images := drawnImages(t, func(d *pdfDoc) []d2g.Image {
+		return []d2g.Image{d.CreateImage(opaque), d.CreateImage(transparent)}
+	})
+	if len(images) != 2 {
+		t.Fatalf("Expected 2 images. Was %d", len(images))
+	}
+	if images[0]["SMask"] != nil {
+		t.Errorf("Expected an opaque image not to have a soft mask. Was %v", images[0]["SMask"])
+	}
+	m, err := rd.Resolve(images[1]["SMask"])
+	if s, ok := m.(*Stream); err != nil || !ok || s.Dict["Subtype"] != Name("Image") {
+		t.Errorf("Expected a transparent image to have a soft mask. Was %v", m)
+	}
+
+	// Only the images and the mask are written.
+	n := 0
+	for id, e := range rd.xref {
+		if e.typ == 0 {
+			continue
+		}
+		o, _ := rd.Object(Ref{id, 0})
+		if o == nil {
+			t.Errorf("Expected object %d not to be null", id)
+		}
+		if s, ok := o.(*Stream); ok && s.Dict["Subtype"] == Name("Image") {
+			n++
+		}
+	}
+	if n != 3 {
+		t.Errorf("Expected 2 images and a mask. Was %d", n)
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (w failingWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestInlineImageError(t *testing.T) {
+
+	d := NewPdfDoc(ioutil.Discard).(*pdfDoc)
+	i := d.CreateImage(image.NewGray(image.Rect(0, 0, 8, 8)))
+	if i.Id() != 0 {
+		t.Errorf("Expected an inline image to have no id. Was %d", i.Id())
+	}
+
+	newSurface(d, failingWriter{}, d2g.U_PT).Image(i, 0, 0, 10, 10)
+	if d.err == nil || d.err.Error() != "write failed" {
+		t.Errorf("Expected the error writing the image. Was %v", d.err)
+	}
+}
+
+func TestImageUnits(t *testing.T) {
+
+	d := NewPdfDoc(ioutil.Discard).(*pdfDoc)
+	i := d.CreateImage(image.NewGray(image.Rect(0, 0, 100, 100)))
+
+	for _, c := range []struct {
+		ip       d2g.ImagePlacement
+		expected []string
+	}{
+		// The box is converted from millimetres to points.
+		{d2g.IP_Stretch, []string{
+			"1.000000 0.000000 0.000000 1.000000 28.346457 56.692913 cm",
+			"85.039370 0.000000 0.000000 113.385827 0.000000 0.000000 cm",
+		}},
+		{d2g.IP_Fit, []string{
+			"1.000000 0.000000 0.000000 1.000000 28.346457 56.692913 cm",
+			"85.039370 0.000000 0.000000 85.039370 0.000000 0.000000 cm",
+		}},
+		// 100 pixels at 72 dpi are 100 points.
+		{d2g.IP_Natural, []string{
+			"1.000000 0.000000 0.000000 1.000000 28.346457 56.692913 cm",
+			"100.000000 0.000000 0.000000 100.000000 0.000000 0.000000 cm",
+		}},
+	} {
+		var b bytes.Buffer
+		s := newSurface(d, &b, d2g.U_MM)
+		if c.ip == d2g.IP_Stretch {
+			s.Image(i, 10, 20, 30, 40)
+		} else {
+			s.PlaceImage(i, 10, 20, 30, 40, c.ip, d2g.AN_BottomLeft)
+		}
+		for _, e := range c.expected {
+			if !bytes.Contains(b.Bytes(), []byte(e+"\r\n")) {
+				t.Errorf("Expected %s. Was %s", e, b.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,536 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/adkennan/dox2go"
+)
+
+var ErrNotPdfDoc = errors.New("Pages can only be imported into PDF documents")
+
+// ImportPage returns page n of a document that is read, where
+// the first page is 0, as an Image that can be drawn on the
+// surfaces of doc. The page is drawn as it is displayed, using
+// its crop box and rotation, and is one pixel per point at the
+// default resolution.
+//
+// The objects used by the page are copied into doc once no
+// matter how many times the page, or other pages sharing them,
+// are imported from the same Reader.
+func ImportPage(doc dox2go.Document, r *Reader, n int) (dox2go.Image, error) {
+
+	d, ok := doc.(*pdfDoc)
+	if !ok {
+		return nil, ErrNotPdfDoc
+	}
+
+	im := d.importer(r)
+	if ip, ok := im.pages[n]; ok {
+		return ip, nil
+	}
+
+	p, err := r.Page(n)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := p.Content()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := p.Attr("Resources")
+	if err != nil {
+		return nil, err
+	}
+	res, err = im.copy(res)
+	if err != nil {
+		return nil, err
+	}
+
+	ip := &pdfImportedPage{
+		len(d.objs) + 1,
+		p.CropBox(),
+		p.Rotate(),
+		res,
+		content,
+		dox2go.DefaultDpi,
+		dox2go.DefaultDpi,
+	}
+	d.objs = append(d.objs, ip)
+	im.pages[n] = ip
+
+	return ip, nil
+}
+
+// pdfImporter copies the objects of a Reader into a document.
+// Objects are copied once and ids maps the ids of the objects
+// that are read to their copies, or to the pages they were
+// appended as.
+type pdfImporter struct {
+	doc     *pdfDoc
+	r       *Reader
+	ids     map[int]pdfObj
+	pages   map[int]*pdfImportedPage
+	pending map[int]bool
+	placed  map[int]bool
+	fonts   map[Name]Name
+}
+
+func (doc *pdfDoc) importer(r *Reader) *pdfImporter {
+	if doc.imports == nil {
+		doc.imports = make(map[*Reader]*pdfImporter)
+		doc.copies = make(map[string]*pdfImportedObj)
+	}
+	im := doc.imports[r]
+	if im == nil {
+		im = &pdfImporter{
+			doc,
+			r,
+			make(map[int]pdfObj),
+			make(map[int]*pdfImportedPage),
+			make(map[int]bool),
+			make(map[int]bool),
+			nil,
+		}
+		doc.imports[r] = im
+	}
+	return im
+}
+
+// copy returns o with the objects it refers to copied into the
+// document and its references changed to refer to the copies.
+// References to pages that have not been appended to the
+// document and to annotations on them are replaced with null
+// rather than copying the rest of the document.
+func (im *pdfImporter) copy(o Object) (Object, error) {
+
+	switch v := o.(type) {
+	case Ref:
+		if c, ok := im.ids[v.Id]; ok {
+			return Ref{c.Id(), 0}, nil
+		}
+		if im.pending[v.Id] {
+			return nil, nil
+		}
+		src, err := im.r.Object(v)
+		if err != nil {
+			return nil, err
+		}
+
+		switch s := src.(type) {
+		case *Stream:
+			return im.copyShared(v.Id, s)
+		case Dict:
+			if t := s["Type"]; t == Name("Page") || t == Name("Pages") {
+				return nil, nil
+			}
+			if sharedTypes[s["Type"]] {
+				return im.copyShared(v.Id, s)
+			}
+			if isAnnot(s) {
+				a := im.annotation(s)
+				if a == nil {
+					return nil, nil
+				}
+				src = a
+			}
+		}
+
+		cp, err := im.copyObject(v.Id, src)
+		if err != nil {
+			return nil, err
+		}
+		return Ref{cp.id, 0}, nil
+
+	case Array:
+		a := make(Array, len(v))
+		for ix, e := range v {
+			c, err := im.copy(e)
+			if err != nil {
+				return nil, err
+			}
+			a[ix] = c
+		}
+		return a, nil
+
+	case Dict:
+		d := make(Dict, len(v))
+		for k, e := range v {
+			c, err := im.copy(e)
+			if err != nil {
+				return nil, err
+			}
+			// Fields lose the kids that are not copied.
+			if a, ok := c.(Array); ok && k == "Kids" {
+				c = withoutNulls(a)
+			}
+			d[k] = c
+		}
+		return d, nil
+
+	case *Stream:
+		// The length is written with the copy.
+		dict := make(Dict, len(v.Dict))
+		for k, e := range v.Dict {
+			if k != "Length" {
+				dict[k] = e
+			}
+		}
+		d, err := im.copy(dict)
+		if err != nil {
+			return nil, err
+		}
+		return &Stream{d.(Dict), v.Data}, nil
+	}
+
+	return o, nil
+}
+
+// copyObject adds a copy of the object with the given id to the
+// document. The copy is added before its contents so that
+// objects that refer back to it are copied once.
+func (im *pdfImporter) copyObject(id int, o Object) (*pdfImportedObj, error) {
+	cp := &pdfImportedObj{len(im.doc.objs) + 1, nil}
+	im.doc.objs = append(im.doc.objs, cp)
+	im.ids[id] = cp
+
+	var err error
+	cp.obj, err = im.copy(o)
+	return cp, err
+}
+
+// These objects are shared by pages and are copied once even
+// when they are read from several documents.
+var sharedTypes = map[Object]bool{
+	Name("Font"):           true,
+	Name("FontDescriptor"): true,
+	Name("Encoding"):       true,
+	Name("ExtGState"):      true,
+	Name("Pattern"):        true,
+}
+
+// copyShared copies a stream, such as an image, or a shared
+// dictionary, such as a font, unless an object with the same
+// contents has already been copied from this or another
+// document.
+func (im *pdfImporter) copyShared(id int, o Object) (Object, error) {
+
+	// The contents are copied first to compare the copies, so an
+	// object that refers back to itself is left out.
+	im.pending[id] = true
+	c, err := im.copy(o)
+	delete(im.pending, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	h := sha256.New()
+	if s, ok := c.(*Stream); ok {
+		psObject(&dictionaryWriter{&b, 0, nil}, s.Dict)
+		h.Write(b.Bytes())
+		h.Write(s.Data)
+	} else {
+		psObject(&dictionaryWriter{&b, 0, nil}, c)
+		h.Write(b.Bytes())
+	}
+	key := string(h.Sum(nil))
+
+	cp, ok := im.doc.copies[key]
+	if !ok {
+		cp = &pdfImportedObj{len(im.doc.objs) + 1, c}
+		im.doc.objs = append(im.doc.objs, cp)
+		im.doc.copies[key] = cp
+	}
+	im.ids[id] = cp
+	return Ref{cp.id, 0}, nil
+}
+
+func withoutNulls(a Array) Array {
+	out := a[:0]
+	for _, e := range a {
+		if e != nil {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// pdfImportedObj is an object copied from another document.
+type pdfImportedObj struct {
+	id  int
+	obj Object
+}
+
+func (o *pdfImportedObj) Id() int {
+	return o.id
+}
+
+func (o *pdfImportedObj) Type() string {
+	var t Object
+	switch v := o.obj.(type) {
+	case Dict:
+		t = v["Type"]
+	case *Stream:
+		t = v.Dict["Type"]
+	}
+	if n, ok := t.(Name); ok {
+		return string(n)
+	}
+	return "Object"
+}
+
+func (o *pdfImportedObj) hasStream() bool {
+	_, ok := o.obj.(*Stream)
+	return ok
+}
+
+func (o *pdfImportedObj) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(o, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+
+	s, isStream := o.obj.(*Stream)
+	if !isStream {
+		psObject(&dw, o.obj)
+		psValue(&dw, "\r\n")
+		if dw.err != nil {
+			return n, dw.err
+		}
+		n += dw.n
+		n2, err := endObj(o, w)
+		return n + n2, err
+	}
+
+	dict := make(Dict, len(s.Dict)+1)
+	for k, v := range s.Dict {
+		dict[k] = v
+	}
+	dict["Length"] = streamLength(w, len(s.Data))
+	psObject(&dw, dict)
+	psValue(&dw, "\r\n")
+	if dw.err != nil {
+		return n, dw.err
+	}
+	n += dw.n
+
+	n2, err := startStream(w)
+	if err != nil {
+		return n, err
+	}
+	n += n2
+
+	n3, err := w.Write(s.Data)
+	if err != nil {
+		return n, err
+	}
+	n += int64(n3)
+
+	n2, err = endStream(w)
+	if err != nil {
+		return n, err
+	}
+	n += n2
+	n2, err = endObj(o, w)
+	return n + n2, err
+}
+
+// psObject writes an object of a document that is read.
+// Dictionaries are written with their keys sorted.
+func psObject(ps pdfStructure, o Object) {
+
+	switch v := o.(type) {
+	case nil:
+		psValue(ps, " null")
+	case bool:
+		psValue(ps, " ")
+		psValue(ps, v)
+	case int:
+		psValue(ps, " ")
+		psValue(ps, v)
+	case float64:
+		psValue(ps, " ")
+		psValue(ps, strconv.FormatFloat(v, 'f', -1, 64))
+	case Name:
+		psName(ps, string(v))
+	case String:
+		psBytes(ps, v)
+	case Ref:
+		psValue(ps, fmt.Sprintf(" %d %d R", v.Id, v.Gen))
+	case Array:
+		psValue(ps, " [")
+		for _, e := range v {
+			psObject(ps, e)
+		}
+		psValue(ps, " ]")
+	case Dict:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, string(k))
+		}
+		sortNames(keys)
+		psValue(ps, " <<")
+		for _, k := range keys {
+			psName(ps, k)
+			psObject(ps, v[Name(k)])
+		}
+		psValue(ps, " >>")
+	case keyword:
+		// Bare words are invalid outside content streams but are
+		// copied as they are found.
+		psValue(ps, " ")
+		psValue(ps, string(v))
+	case *Stream:
+		// Streams are always indirect objects.
+		psValue(ps, " null")
+	}
+}
+
+// pdfImportedPage is a page of another document drawn as a
+// form XObject. The form's matrix maps the page as it is
+// displayed onto the unit square, like an image.
+type pdfImportedPage struct {
+	id        int
+	box       [4]float64
+	rotate    int
+	resources Object
+	content   []byte
+	dpiX      float64
+	dpiY      float64
+}
+
+func (ip *pdfImportedPage) Id() int {
+	return ip.id
+}
+
+func (ip *pdfImportedPage) Type() string {
+	return "XObject"
+}
+
+func (ip *pdfImportedPage) hasStream() bool {
+	return true
+}
+
+// size returns the size of the page in points as it is
+// displayed.
+func (ip *pdfImportedPage) size() (w, h float64) {
+	w = ip.box[2] - ip.box[0]
+	h = ip.box[3] - ip.box[1]
+	if ip.rotate == 90 || ip.rotate == 270 {
+		return h, w
+	}
+	return w, h
+}
+
+func (ip *pdfImportedPage) Width() int {
+	w, _ := ip.size()
+	return int(math.Floor(w + 0.5))
+}
+
+func (ip *pdfImportedPage) Height() int {
+	_, h := ip.size()
+	return int(math.Floor(h + 0.5))
+}
+
+func (ip *pdfImportedPage) Dpi() (x, y float64) {
+	return ip.dpiX, ip.dpiY
+}
+
+func (ip *pdfImportedPage) SetDpi(x, y float64) {
+	ip.dpiX = x
+	ip.dpiY = y
+}
+
+// matrix returns the matrix that maps the crop box of the page,
+// rotated clockwise, onto the unit square.
+func (ip *pdfImportedPage) matrix() matrix {
+	x0, y0 := ip.box[0], ip.box[1]
+	w := ip.box[2] - x0
+	h := ip.box[3] - y0
+	switch ip.rotate {
+	case 90:
+		return matrix{0, -1 / w, 1 / h, 0, -y0 / h, 1 + x0/w}
+	case 180:
+		return matrix{-1 / w, 0, 0, -1 / h, 1 + x0/w, 1 + y0/h}
+	case 270:
+		return matrix{0, 1 / w, -1 / h, 0, 1 + y0/h, -x0 / w}
+	}
+	return matrix{1 / w, 0, 0, 1 / h, -x0 / w, -y0 / h}
+}
+
+func (ip *pdfImportedPage) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(ip, w)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := deflate(ip.content)
+	if err != nil {
+		return n, err
+	}
+
+	m := ip.matrix()
+
+	dw := dictionaryWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(ip.Type())
+	dw.Name("Subtype")
+	dw.Name("Form")
+	dw.Name("BBox")
+	writeNumbers(&dw, ip.box[:])
+	dw.Name("Matrix")
+	writeNumbers(&dw, m[:])
+	if ip.resources != nil {
+		dw.Name("Resources")
+		psObject(&dw, ip.resources)
+	}
+	dw.Name("Filter")
+	dw.Name("FlateDecode")
+	dw.Name("Length")
+	dw.Value(streamLength(w, len(data)))
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	n += dw.n
+
+	n2, err := startStream(w)
+	if err != nil {
+		return n, err
+	}
+	n += n2
+
+	n3, err := w.Write(data)
+	if err != nil {
+		return n, err
+	}
+	n += int64(n3)
+
+	n2, err = endStream(w)
+	if err != nil {
+		return n, err
+	}
+	n += n2
+	n2, err = endObj(ip, w)
+	n += n2
+	return n, err
+}
@@ -0,0 +1,123 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/adkennan/dox2go"
+)
+
+// sourceDoc returns a document of two pages that share a font
+// and an image.
+func sourceDoc(t *testing.T) *Reader {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	f := d.CreateFont(FONT_Helvetica, dox2go.FS_Regular, 12)
+	img := d.CreateImage(image.NewRGBA(image.Rect(0, 0, 50, 50)))
+
+	for _, po := range []dox2go.PageOrientation{dox2go.PO_Portrait, dox2go.PO_Rotate90} {
+		s := d.CreatePage(dox2go.U_PT, 200, 100, po).Surface()
+		s.Text(f, 10, 10, "Letterhead")
+		s.Image(img, 10, 10, 50, 50)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return readPdf(t, b.Bytes())
+}
+
+func TestImportPage(t *testing.T) {
+
+	src := sourceDoc(t)
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+
+	first, err := ImportPage(d, src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := ImportPage(d, src, 0); again != first {
+		t.Errorf("Expected a page to be imported once")
+	}
+	second, err := ImportPage(d, src, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Width() != 200 || first.Height() != 100 {
+		t.Errorf("Expected 200x100. Was %dx%d", first.Width(), first.Height())
+	}
+	if second.Width() != 100 || second.Height() != 200 {
+		t.Errorf("Expected the rotated page to be 100x200. Was %dx%d", second.Width(), second.Height())
+	}
+
+	if _, err = ImportPage(d, src, 2); err != ErrPageRange {
+		t.Errorf("Expected %v. Was %v", ErrPageRange, err)
+	}
+
+	s := d.CreatePage(dox2go.U_PT, 400, 400, dox2go.PO_Portrait).Surface()
+	s.PlaceImage(first, 0, 0, 400, 200, dox2go.IP_Fit, dox2go.AN_Center)
+	s.PlaceImage(first, 0, 200, 100, 100, dox2go.IP_Natural, dox2go.AN_TopLeft)
+	s.Image(second, 200, 200, 100, 200)
+	if err = d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := readPdf(t, b.Bytes())
+	p, _ := out.Page(0)
+	res, _ := p.Resources()
+	xobjs, _ := out.resolveDict(res["XObject"])
+	if len(xobjs) != 2 {
+		t.Errorf("Expected 2 forms. Was %d", len(xobjs))
+	}
+
+	fonts, images := 0, 0
+	for id := range out.xref {
+		o, _ := out.Object(Ref{id, 0})
+		d, _ := out.resolveDict(o)
+		switch {
+		case d["Type"] == Name("Font"):
+			fonts++
+		case d["Subtype"] == Name("Image"):
+			images++
+		}
+	}
+	if fonts != 1 {
+		t.Errorf("Expected the shared font to be copied once. Was %d", fonts)
+	}
+	if images != 2 {
+		t.Errorf("Expected the shared image and its mask to be copied once. Was %d", images)
+	}
+}
+
+func TestImportedPageMatrix(t *testing.T) {
+
+	for _, c := range []struct {
+		rotate int
+		// The corner of the crop box shown at the top left.
+		x, y float64
+	}{
+		{0, 10, 70},
+		{90, 10, 20},
+		{180, 50, 20},
+		{270, 50, 70},
+	} {
+		ip := &pdfImportedPage{1, [4]float64{10, 20, 50, 70}, c.rotate, nil, nil, 72, 72}
+		m := ip.matrix()
+		x := m[0]*c.x + m[2]*c.y + m[4]
+		y := m[1]*c.x + m[3]*c.y + m[5]
+		if x > 1e-9 || y < 1-1e-9 || y > 1+1e-9 {
+			t.Errorf("Expected %d degrees to show %v, %v at the top left. Was %v, %v", c.rotate, c.x, c.y, x, y)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/adkennan/dox2go"
+)
+
+const defaultProducer = "dox2go"
+
+func (doc *pdfDoc) SetMetadata(m dox2go.Metadata) {
+	doc.meta = m
+}
+
+// completeMetadata fills in the defaults for any metadata
+// that has not been supplied.
+func completeMetadata(m dox2go.Metadata, now time.Time) dox2go.Metadata {
+	if m.Producer == "" {
+		m.Producer = defaultProducer
+	}
+	if m.Created.IsZero() {
+		m.Created = now
+	}
+	if m.Modified.IsZero() {
+		m.Modified = m.Created
+	}
+	return m
+}
+
+// pdfDate formats a time as a PDF date string.
+func pdfDate(t time.Time) string {
+	_, offset := t.Zone()
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	if offset == 0 {
+		return t.Format("D:20060102150405Z")
+	}
+	return fmt.Sprintf("%s%c%02d'%02d'",
+		t.Format("D:20060102150405"), sign, offset/3600, offset/60%60)
+}
+
+// fileId calculates an identifier for a document from its
+// metadata and the number of objects it contains.
+func fileId(m dox2go.Metadata, objCount int) []byte {
+	h := md5.New()
+	fmt.Fprintf(h, "%s|%s|%s|%s|%d",
+		m.Title, m.Author, m.Producer,
+		m.Created.Format(time.RFC3339Nano), objCount)
+	return h.Sum(nil)
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfInfo is the document information dictionary.
+type pdfInfo struct {
+	id   int
+	meta dox2go.Metadata
+}
+
+func (i *pdfInfo) Id() int {
+	return i.id
+}
+
+func (i *pdfInfo) Type() string {
+	return "Info"
+}
+
+func (i *pdfInfo) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(i, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	dw.Start()
+	if i.meta.Title != "" {
+		dw.Name("Title")
+		dw.String(i.meta.Title)
+	}
+	if i.meta.Author != "" {
+		dw.Name("Author")
+		dw.String(i.meta.Author)
+	}
+	if i.meta.Subject != "" {
+		dw.Name("Subject")
+		dw.String(i.meta.Subject)
+	}
+	if len(i.meta.Keywords) > 0 {
+		dw.Name("Keywords")
+		dw.String(strings.Join(i.meta.Keywords, ", "))
+	}
+	if i.meta.Creator != "" {
+		dw.Name("Creator")
+		dw.String(i.meta.Creator)
+	}
+	dw.Name("Producer")
+	dw.String(i.meta.Producer)
+	dw.Name("CreationDate")
+	dw.String(pdfDate(i.meta.Created))
+	dw.Name("ModDate")
+	dw.String(pdfDate(i.meta.Modified))
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	n += dw.n
+
+	n2, err := endObj(i, w)
+	n += int64(n2)
+	return n, err
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfXmp is an XMP metadata stream that describes the
+// same information as the document information dictionary.
+// When pdfaPart is not zero the stream also identifies the
+// part of the PDF/A standard the document conforms to.
+type pdfXmp struct {
+	id       int
+	meta     dox2go.Metadata
+	pdfaPart int
+}
+
+func (x *pdfXmp) Id() int {
+	return x.id
+}
+
+func (x *pdfXmp) Type() string {
+	return "Metadata"
+}
+
+func (x *pdfXmp) hasStream() bool {
+	return true
+}
+
+func xmlText(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func xmpDate(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05-07:00")
+}
+
+// packet returns the XMP packet describing the document.
+func (x *pdfXmp) packet() []byte {
+
+	var b bytes.Buffer
+
+	b.WriteString("<?xpacket begin=\"\xEF\xBB\xBF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString("<rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:dc=\"http://purl.org/dc/elements/1.1/\">\n")
+	b.WriteString("<dc:format>application/pdf</dc:format>\n")
+	if x.meta.Title != "" {
+		fmt.Fprintf(&b, "<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:title>\n",
+			xmlText(x.meta.Title))
+	}
+	if x.meta.Author != "" {
+		fmt.Fprintf(&b, "<dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>\n",
+			xmlText(x.meta.Author))
+	}
+	if x.meta.Subject != "" {
+		fmt.Fprintf(&b, "<dc:description><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:description>\n",
+			xmlText(x.meta.Subject))
+	}
+	if len(x.meta.Keywords) > 0 {
+		b.WriteString("<dc:subject><rdf:Bag>")
+		for _, k := range x.meta.Keywords {
+			fmt.Fprintf(&b, "<rdf:li>%s</rdf:li>", xmlText(k))
+		}
+		b.WriteString("</rdf:Bag></dc:subject>\n")
+	}
+	if x.meta.Language != "" {
+		fmt.Fprintf(&b, "<dc:language><rdf:Bag><rdf:li>%s</rdf:li></rdf:Bag></dc:language>\n",
+			xmlText(x.meta.Language))
+	}
+	b.WriteString("</rdf:Description>\n")
+
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\">\n")
+	if x.meta.Creator != "" {
+		fmt.Fprintf(&b, "<xmp:CreatorTool>%s</xmp:CreatorTool>\n", xmlText(x.meta.Creator))
+	}
+	fmt.Fprintf(&b, "<xmp:CreateDate>%s</xmp:CreateDate>\n", xmpDate(x.meta.Created))
+	fmt.Fprintf(&b, "<xmp:ModifyDate>%s</xmp:ModifyDate>\n", xmpDate(x.meta.Modified))
+	fmt.Fprintf(&b, "<xmp:MetadataDate>%s</xmp:MetadataDate>\n", xmpDate(x.meta.Modified))
+	b.WriteString("</rdf:Description>\n")
+
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:pdf=\"http://ns.adobe.com/pdf/1.3/\">\n")
+	if len(x.meta.Keywords) > 0 {
+		fmt.Fprintf(&b, "<pdf:Keywords>%s</pdf:Keywords>\n", xmlText(strings.Join(x.meta.Keywords, ", ")))
+	}
+	fmt.Fprintf(&b, "<pdf:Producer>%s</pdf:Producer>\n", xmlText(x.meta.Producer))
+	b.WriteString("</rdf:Description>\n")
+
+	if x.pdfaPart != 0 {
+		b.WriteString("<rdf:Description rdf:about=\"\" xmlns:pdfaid=\"http://www.aiim.org/pdfa/ns/id/\">\n")
+		fmt.Fprintf(&b, "<pdfaid:part>%d</pdfaid:part>\n", x.pdfaPart)
+		b.WriteString("<pdfaid:conformance>B</pdfaid:conformance>\n")
+		b.WriteString("</rdf:Description>\n")
+	}
+
+	b.WriteString("</rdf:RDF>\n")
+	b.WriteString("</x:xmpmeta>\n")
+	b.WriteString("<?xpacket end=\"w\"?>")
+
+	return b.Bytes()
+}
+
+func (x *pdfXmp) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(x, w)
+	if err != nil {
+		return 0, err
+	}
+
+	data := x.packet()
+
+	dw := dictionaryWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(x.Type())
+	dw.Name("Subtype")
+	dw.Name("XML")
+	dw.Name("Length")
+	dw.Value(streamLength(w, len(data)))
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	n += dw.n
+
+	n2, err := startStream(w)
+	if err != nil {
+		return n, err
+	}
+	n += n2
+
+	n3, err := w.Write(data)
+	if err != nil {
+		return n, err
+	}
+	n += int64(n3)
+
+	n2, err = endStream(w)
+	if err != nil {
+		return n, err
+	}
+	n += n2
+	n2, err = endObj(x, w)
+	n += n2
+	return n, err
+}
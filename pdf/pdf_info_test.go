@@ -0,0 +1,134 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/adkennan/dox2go"
+)
+
+func checkDate(t *testing.T, tm time.Time, expected string) {
+	v := pdfDate(tm)
+	if v != expected {
+		t.Errorf("Expected %s. Was %s", expected, v)
+	}
+}
+
+func TestPdfDate(t *testing.T) {
+
+	checkDate(t, time.Date(2013, 4, 5, 6, 7, 8, 0, time.UTC), "D:20130405060708Z")
+	checkDate(t, time.Date(2013, 4, 5, 6, 7, 8, 0, time.FixedZone("", 10*3600+30*60)), "D:20130405060708+10'30'")
+	checkDate(t, time.Date(2013, 4, 5, 6, 7, 8, 0, time.FixedZone("", -5*3600)), "D:20130405060708-05'00'")
+}
+
+// metadataDoc writes a document with metadata and returns it.
+func metadataDoc(t *testing.T, m dox2go.Metadata) []byte {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	d.SetMetadata(m)
+	d.CreatePage(dox2go.U_PT, 100, 100, dox2go.PO_Portrait)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestMetadata(t *testing.T) {
+
+	m := dox2go.Metadata{
+		Title:    "Report & Summary",
+		Author:   "A. Kennan",
+		Keywords: []string{"one", "two"},
+		Created:  time.Date(2013, 4, 5, 6, 7, 8, 0, time.UTC),
+	}
+	r := readPdf(t, metadataDoc(t, m))
+
+	info, err := r.resolveDict(r.Trailer()["Info"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[Name]string{
+		"Title":        "Report & Summary",
+		"Author":       "A. Kennan",
+		"Keywords":     "one, two",
+		"Producer":     defaultProducer,
+		"CreationDate": "D:20130405060708Z",
+		"ModDate":      "D:20130405060708Z",
+	} {
+		if s, ok := info[k].(String); !ok || string(s) != v {
+			t.Errorf("Expected %s of %s. Was %v", k, v, info[k])
+		}
+	}
+
+	cat, _ := r.Catalog()
+	x, _ := r.Resolve(cat["Metadata"])
+	stm, ok := x.(*Stream)
+	if !ok {
+		t.Fatalf("Expected an XMP stream. Was %v", x)
+	}
+	data, err := r.Decode(stm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"<rdf:li xml:lang=\"x-default\">Report &amp; Summary</rdf:li>",
+		"<dc:creator><rdf:Seq><rdf:li>A. Kennan</rdf:li></rdf:Seq></dc:creator>",
+		"<pdf:Keywords>one, two</pdf:Keywords>",
+		"<xmp:CreateDate>2013-04-05T06:07:08+00:00</xmp:CreateDate>",
+		"<pdf:Producer>dox2go</pdf:Producer>",
+	} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("Expected the metadata to contain %s. Was %s", s, data)
+		}
+	}
+}
+
+func TestFileId(t *testing.T) {
+
+	created := time.Date(2013, 4, 5, 6, 7, 8, 0, time.UTC)
+	id := func(title string) string {
+		r := readPdf(t, metadataDoc(t, dox2go.Metadata{Title: title, Created: created}))
+		a, _ := r.Trailer()["ID"].(Array)
+		if len(a) != 2 {
+			t.Fatalf("Expected two identifiers. Was %v", r.Trailer()["ID"])
+		}
+		first, _ := a[0].(String)
+		second, _ := a[1].(String)
+		if len(first) != 16 || string(first) != string(second) {
+			t.Errorf("Expected two equal 16 byte identifiers. Was %v", a)
+		}
+		return string(first)
+	}
+
+	if id("A") != id("A") {
+		t.Errorf("Expected the same document to have the same identifier.")
+	}
+	if id("A") == id("B") {
+		t.Errorf("Expected different documents to have different identifiers.")
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	d.CreatePage(dox2go.U_PT, 100, 100, dox2go.PO_Portrait)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	n := b.Len()
+	if err := d.Close(); err != ErrClosed {
+		t.Errorf("Expected %v. Was %v", ErrClosed, err)
+	}
+	if b.Len() != n {
+		t.Errorf("Expected nothing more to be written. Was %d bytes", b.Len()-n)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"io"
+	"sort"
+
+	"github.com/adkennan/dox2go"
+)
+
+// labelStyles are the numbering styles of page labels, indexed
+// by dox2go.PageLabelStyle.
+var labelStyles = [...]string{"", "D", "R", "r", "A", "a"}
+
+// pdfPageLabel starts a range of page labels.
+type pdfPageLabel struct {
+	page   *pdfPage
+	style  dox2go.PageLabelStyle
+	prefix string
+	start  int
+}
+
+// pdfPageLabels is the number tree of page label ranges. It is
+// only added to the catalog once a range has been defined.
+type pdfPageLabels struct {
+	id     int
+	pages  *pdfPages
+	ranges []*pdfPageLabel
+}
+
+func (doc *pdfDoc) AddPageLabels(p dox2go.Page, style dox2go.PageLabelStyle, prefix string, start int) {
+	page, ok := p.(*pdfPage)
+	if !ok {
+		return
+	}
+	if style < 0 || int(style) >= len(labelStyles) {
+		panic("Invalid Page Label Style")
+	}
+	if start < 1 {
+		start = 1
+	}
+
+	if doc.labels == nil {
+		doc.labels = &pdfPageLabels{len(doc.objs) + 1, doc.pages, make([]*pdfPageLabel, 0, 4)}
+		doc.objs = append(doc.objs, doc.labels)
+		doc.catalog.objs = append(doc.catalog.objs, doc.labels)
+	}
+
+	l := &pdfPageLabel{page, style, prefix, start}
+	for ix, r := range doc.labels.ranges {
+		if r.page == page {
+			doc.labels.ranges[ix] = l
+			return
+		}
+	}
+	doc.labels.ranges = append(doc.labels.ranges, l)
+}
+
+func (l *pdfPageLabels) Id() int {
+	return l.id
+}
+
+func (l *pdfPageLabels) Type() string {
+	return "PageLabels"
+}
+
+// index returns the position of a page in the document or -1
+// if it is not part of the document.
+func (l *pdfPageLabels) index(p *pdfPage) int {
+	for ix, pg := range l.pages.pages {
+		if pg == p {
+			return ix
+		}
+	}
+	return -1
+}
+
+func (l *pdfPageLabels) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(l, w)
+	if err != nil {
+		return 0, err
+	}
+
+	// The keys of the number tree are page indexes in ascending
+	// order. The first page must always have a label so pages
+	// before the first range are numbered with decimals.
+	keys := make(map[*pdfPageLabel]int)
+	ranges := make([]*pdfPageLabel, 0, len(l.ranges)+1)
+	for _, r := range l.ranges {
+		if ix := l.index(r.page); ix >= 0 {
+			keys[r] = ix
+			ranges = append(ranges, r)
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return keys[ranges[i]] < keys[ranges[j]]
+	})
+	if len(ranges) == 0 || keys[ranges[0]] != 0 {
+		first := &pdfPageLabel{nil, dox2go.LS_Decimal, "", 1}
+		keys[first] = 0
+		ranges = append([]*pdfPageLabel{first}, ranges...)
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	aw := arrayWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Nums")
+	aw.Start()
+	for _, r := range ranges {
+		aw.Value(" ")
+		aw.Value(keys[r])
+		dw.Start()
+		dw.Name("Type")
+		dw.Name("PageLabel")
+		if r.style != dox2go.LS_None {
+			dw.Name("S")
+			dw.Name(labelStyles[r.style])
+		}
+		if r.prefix != "" {
+			dw.Name("P")
+			dw.String(r.prefix)
+		}
+		if r.start != 1 {
+			dw.Name("St")
+			dw.Value(r.start)
+		}
+		dw.End()
+	}
+	aw.End()
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	if aw.err != nil {
+		return n, aw.err
+	}
+	n += dw.n + aw.n
+
+	n2, err := endObj(l, w)
+	n += int64(n2)
+	return n, err
+}
@@ -0,0 +1,55 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/adkennan/dox2go"
+)
+
+func TestPageLabels(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	pages := make([]dox2go.Page, 6)
+	for ix := range pages {
+		pages[ix] = d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+	}
+
+	d.AddPageLabels(pages[4], dox2go.LS_Decimal, "A-", 1)
+	d.AddPageLabels(pages[0], dox2go.LS_LowerRoman, "", 1)
+	d.AddPageLabels(pages[2], dox2go.LS_Decimal, "", 1)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := b.String()
+	expected := "/Nums  [  0 <<  /Type  /PageLabel  /S  /r  >>\r\n 2 <<  /Type  /PageLabel  /S  /D  >>\r\n 4 <<  /Type  /PageLabel  /S  /D  /P  (A-)  >>\r\n ]"
+	if !bytes.Contains([]byte(s), []byte(expected)) {
+		t.Errorf("Expected the document to contain %q", expected)
+	}
+	if !bytes.Contains([]byte(s), []byte("/PageLabels")) {
+		t.Errorf("Expected the catalog to refer to the page labels.")
+	}
+}
+
+func TestPageLabelsFirstPage(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+	p := d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+	d.AddPageLabels(p, dox2go.LS_UpperLetters, "", 3)
+	d.Close()
+
+	expected := "/Nums  [  0 <<  /Type  /PageLabel  /S  /D  >>\r\n 1 <<  /Type  /PageLabel  /S  /A  /St 3 >>"
+	if !bytes.Contains(b.Bytes(), []byte(expected)) {
+		t.Errorf("Expected the document to contain %q", expected)
+	}
+}
@@ -0,0 +1,211 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/adkennan/dox2go"
+)
+
+// pdfOCProperties lists the optional content groups of the
+// document and their default state. It is only added to the
+// catalog once a layer has been created.
+type pdfOCProperties struct {
+	id     int
+	layers []*pdfLayer
+	pdfa   PdfALevel
+}
+
+func (doc *pdfDoc) CreateLayer(name string, visible, printed bool) dox2go.Layer {
+	if doc.ocProps == nil {
+		doc.ocProps = &pdfOCProperties{len(doc.objs) + 1, make([]*pdfLayer, 0, 4), doc.pdfa}
+		doc.objs = append(doc.objs, doc.ocProps)
+		doc.catalog.objs = append(doc.catalog.objs, doc.ocProps)
+	}
+
+	l := &pdfLayer{len(doc.objs) + 1, name, visible, printed}
+	doc.objs = append(doc.objs, l)
+	doc.ocProps.layers = append(doc.ocProps.layers, l)
+	return l
+}
+
+func (o *pdfOCProperties) Id() int {
+	return o.id
+}
+
+func (o *pdfOCProperties) Type() string {
+	return "OCProperties"
+}
+
+func (o *pdfOCProperties) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(o, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	aw := arrayWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("OCGs")
+	o.writeLayers(&aw, func(l *pdfLayer) bool { return true })
+
+	// The default configuration shows the layers in the order
+	// they were created and applies their usage when viewing
+	// and printing. PDF/A does not allow usage to be applied
+	// automatically, so checkPdfA rejects layers that would be
+	// printed differently from how they are shown.
+	dw.Name("D")
+	dw.Start()
+	dw.Name("Name")
+	dw.String("Default")
+	dw.Name("Order")
+	o.writeLayers(&aw, func(l *pdfLayer) bool { return true })
+	dw.Name("OFF")
+	o.writeLayers(&aw, func(l *pdfLayer) bool { return !l.visible })
+	if o.pdfa == PA_None {
+		dw.Name("AS")
+		aw.Start()
+		for _, event := range []string{"View", "Print"} {
+			dw.Start()
+			dw.Name("Event")
+			dw.Name(event)
+			dw.Name("OCGs")
+			o.writeLayers(&aw, func(l *pdfLayer) bool { return true })
+			dw.Name("Category")
+			aw.Start()
+			aw.Name(event)
+			aw.End()
+			dw.End()
+		}
+		aw.End()
+	}
+	dw.End()
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	if aw.err != nil {
+		return n, aw.err
+	}
+	n += dw.n + aw.n
+
+	n2, err := endObj(o, w)
+	n += int64(n2)
+	return n, err
+}
+
+// writeLayers writes an array of references to the layers
+// matching a condition.
+func (o *pdfOCProperties) writeLayers(aw *arrayWriter, match func(l *pdfLayer) bool) {
+	aw.Start()
+	for _, l := range o.layers {
+		if match(l) {
+			aw.Ref(l)
+		}
+	}
+	aw.End()
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfLayer is an optional content group.
+type pdfLayer struct {
+	id      int
+	name    string
+	visible bool
+	printed bool
+}
+
+func (l *pdfLayer) Id() int {
+	return l.id
+}
+
+func (l *pdfLayer) Name() string {
+	return l.name
+}
+
+func (l *pdfLayer) Type() string {
+	return "OCG"
+}
+
+// usageState returns the name of a usage state.
+func usageState(on bool) string {
+	if on {
+		return "ON"
+	}
+	return "OFF"
+}
+
+func (l *pdfLayer) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(l, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(l.Type())
+	dw.Name("Name")
+	dw.String(l.name)
+	dw.Name("Usage")
+	dw.Start()
+	dw.Name("View")
+	dw.Start()
+	dw.Name("ViewState")
+	dw.Name(usageState(l.visible))
+	dw.End()
+	dw.Name("Print")
+	dw.Start()
+	dw.Name("PrintState")
+	dw.Name(usageState(l.printed))
+	dw.End()
+	dw.End()
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	n += dw.n
+
+	n2, err := endObj(l, w)
+	n += int64(n2)
+	return n, err
+}
+
+///////////////////////////////////////////////////////////
+
+func (sfc *pdfSurface) BeginLayer(l dox2go.Layer) {
+	layer, ok := l.(*pdfLayer)
+	if !ok {
+		return
+	}
+
+	sfc.endMarked()
+	sfc.endText()
+
+	key := "OC" + strconv.Itoa(layer.id)
+	sfc.props[key] = layer
+	sfc.layers++
+
+	fmt.Fprintf(sfc.w, "/OC /%s BDC\r\n", key)
+}
+
+func (sfc *pdfSurface) EndLayer() {
+	if sfc.layers > 0 {
+		sfc.endMarked()
+		sfc.endText()
+
+		fmt.Fprint(sfc.w, "EMC\r\n")
+		sfc.layers--
+	}
+}
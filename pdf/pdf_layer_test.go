@@ -0,0 +1,81 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/adkennan/dox2go"
+)
+
+func TestLayers(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	dims := d.CreateLayer("Dimensions", true, true)
+	furn := d.CreateLayer("Furniture", false, true)
+
+	p := d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+	s := p.Surface()
+	path := dox2go.NewPath()
+	path.Rect(10, 10, 20, 20)
+
+	s.BeginLayer(dims)
+	s.Stroke(path)
+	s.EndLayer()
+	s.BeginLayer(furn)
+	s.Fill(path)
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := bytes.Count(b.Bytes(), []byte("EMC")); c != 2 {
+		t.Errorf("Expected 2 EMC operators. Was %d", c)
+	}
+
+	for _, s := range []string{
+		"/OC /OC" + strconv.Itoa(dims.Id()) + " BDC",
+		"/OCProperties",
+		"/Properties",
+		"/ViewState  /OFF",
+		"(Furniture)",
+		"/OFF  [  " + strconv.Itoa(furn.Id()) + " 0 R ]",
+	} {
+		if !bytes.Contains(b.Bytes(), []byte(s)) {
+			t.Errorf("Expected the document to contain %s", s)
+		}
+	}
+}
+
+func TestLayerConfiguration(t *testing.T) {
+
+	for _, level := range []PdfALevel{PA_None, PA_2B} {
+		var b bytes.Buffer
+		d := NewPdfDoc(&b, PdfA(level))
+		d.CreateLayer("Notes", true, true)
+		d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+		if err := d.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r := readPdf(t, b.Bytes())
+		cat, _ := r.Catalog()
+		props, _ := r.resolveDict(cat["OCProperties"])
+		config, _ := r.resolveDict(props["D"])
+		if name, _ := config["Name"].(String); string(name) != "Default" {
+			t.Errorf("Expected the default configuration to be named. Was %v", config["Name"])
+		}
+
+		// PDF/A does not allow usage to be applied automatically.
+		if _, ok := config["AS"]; ok != (level == PA_None) {
+			t.Errorf("Expected usage to be applied only when not PDF/A. Was %v for level %d", config["AS"], level)
+		}
+	}
+}
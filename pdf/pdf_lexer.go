@@ -0,0 +1,499 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// These are the objects of a document that is read. Integers
+// are read as int, real numbers as float64, booleans as bool and
+// null as nil.
+type Object interface{}
+
+// Name is a PDF name, without the leading slash.
+type Name string
+
+// String is a PDF string. Strings are sequences of bytes and are
+// not necessarily text.
+type String []byte
+
+// Array is a PDF array.
+type Array []Object
+
+// Dict is a PDF dictionary.
+type Dict map[Name]Object
+
+// Ref is a reference to an indirect object.
+type Ref struct {
+	Id  int
+	Gen int
+}
+
+// Stream is a PDF stream. Data holds the bytes of the stream as
+// they appear in the document, before any filters are decoded.
+type Stream struct {
+	Dict Dict
+	Data []byte
+}
+
+// ParseError describes a problem with the syntax of a document
+// and where it was found.
+type ParseError struct {
+	Offset int64
+	Msg    string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.Msg, e.Offset)
+}
+
+// keyword is a bare word such as obj, R or a content stream
+// operator.
+type keyword string
+
+// delimiter is one of the tokens that start or end arrays
+// and dictionaries.
+type delimiter string
+
+// lexer splits the bytes of a document or content stream
+// into tokens.
+type lexer struct {
+	b   []byte
+	pos int
+}
+
+func isWhite(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return &ParseError{int64(l.pos), fmt.Sprintf(format, args...)}
+}
+
+// skipSpace moves past white space and comments.
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		if c == '%' {
+			for l.pos < len(l.b) && l.b[l.pos] != '\r' && l.b[l.pos] != '\n' {
+				l.pos++
+			}
+		} else if !isWhite(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+// token returns the next token, which is a number, Name, String,
+// keyword or delimiter. At the end of the input it returns nil.
+func (l *lexer) token() (Object, error) {
+
+	l.skipSpace()
+	if l.pos >= len(l.b) {
+		return nil, nil
+	}
+
+	c := l.b[l.pos]
+	switch {
+	case c == '/':
+		return l.name()
+	case c == '(':
+		return l.literalString()
+	case c == '<':
+		if l.pos+1 < len(l.b) && l.b[l.pos+1] == '<' {
+			l.pos += 2
+			return delimiter("<<"), nil
+		}
+		return l.hexString()
+	case c == '>':
+		if l.pos+1 < len(l.b) && l.b[l.pos+1] == '>' {
+			l.pos += 2
+			return delimiter(">>"), nil
+		}
+		return nil, l.errorf("Unexpected >")
+	case c == '[' || c == ']' || c == '{' || c == '}':
+		l.pos++
+		return delimiter(c), nil
+	case c == ')':
+		return nil, l.errorf("Unexpected )")
+	}
+
+	start := l.pos
+	for l.pos < len(l.b) && !isWhite(l.b[l.pos]) && !isDelim(l.b[l.pos]) {
+		l.pos++
+	}
+	word := string(l.b[start:l.pos])
+
+	if n, ok := parseNumber(word); ok {
+		return n, nil
+	}
+	return keyword(word), nil
+}
+
+// parseNumber returns the value of an integer or real number.
+func parseNumber(s string) (Object, bool) {
+	if len(s) == 0 {
+		return nil, false
+	}
+	c := s[0]
+	if c != '+' && c != '-' && c != '.' && (c < '0' || c > '9') {
+		return nil, false
+	}
+	if i, err := strconv.Atoi(s); err == nil {
+		return i, true
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, true
+	}
+	// Some writers produce numbers such as "--1" or "1.2.3".
+	if c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9') {
+		return 0, true
+	}
+	return nil, false
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func (l *lexer) name() (Object, error) {
+	l.pos++
+	var b []byte
+	for l.pos < len(l.b) && !isWhite(l.b[l.pos]) && !isDelim(l.b[l.pos]) {
+		c := l.b[l.pos]
+		if c == '#' && l.pos+2 < len(l.b) {
+			h, ok1 := unhex(l.b[l.pos+1])
+			lo, ok2 := unhex(l.b[l.pos+2])
+			if ok1 && ok2 {
+				b = append(b, h<<4|lo)
+				l.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		l.pos++
+	}
+	return Name(b), nil
+}
+
+func (l *lexer) literalString() (Object, error) {
+	l.pos++
+	var b []byte
+	depth := 0
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return String(b), nil
+			}
+			depth--
+		case '\r':
+			// End of line markers are read as a single line feed.
+			if l.pos < len(l.b) && l.b[l.pos] == '\n' {
+				l.pos++
+			}
+			c = '\n'
+		case '\\':
+			if l.pos >= len(l.b) {
+				break
+			}
+			c = l.b[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.b) && l.b[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.b) && l.b[l.pos] >= '0' && l.b[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.b[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return nil, l.errorf("Unterminated string")
+}
+
+func (l *lexer) hexString() (Object, error) {
+	l.pos++
+	var b []byte
+	var hi byte
+	odd := false
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		l.pos++
+		if c == '>' {
+			if odd {
+				b = append(b, hi<<4)
+			}
+			return String(b), nil
+		}
+		v, ok := unhex(c)
+		if !ok {
+			if isWhite(c) {
+				continue
+			}
+			return nil, l.errorf("Invalid hex string")
+		}
+		if odd {
+			b = append(b, hi<<4|v)
+		} else {
+			hi = v
+		}
+		odd = !odd
+	}
+	return nil, l.errorf("Unterminated hex string")
+}
+
+// maxDepth is the deepest that arrays and dictionaries may be
+// nested before the input is considered malformed.
+const maxDepth = 256
+
+// object reads a complete object, which may be an array,
+// dictionary or a reference. Keywords other than true, false
+// and null are returned as they are found.
+func (l *lexer) object() (Object, error) {
+	return l.nested(0)
+}
+
+// nested reads an object found within depth arrays or
+// dictionaries.
+func (l *lexer) nested(depth int) (Object, error) {
+
+	if depth > maxDepth {
+		return nil, l.errorf("Objects nested too deeply")
+	}
+
+	start := l.pos
+	t, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := t.(type) {
+	case nil:
+		return nil, l.errorf("Unexpected end of input")
+
+	case int:
+		// An integer may be the start of a reference.
+		save := l.pos
+		if gen, _ := l.token(); gen != nil {
+			if g, ok := gen.(int); ok {
+				if r, _ := l.token(); r == keyword("R") {
+					return Ref{v, g}, nil
+				}
+			}
+		}
+		l.pos = save
+		return v, nil
+
+	case keyword:
+		switch v {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return v, nil
+
+	case delimiter:
+		switch v {
+		case "[":
+			a := Array{}
+			for {
+				l.skipSpace()
+				if l.pos < len(l.b) && l.b[l.pos] == ']' {
+					l.pos++
+					return a, nil
+				}
+				o, err := l.nested(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				a = append(a, o)
+			}
+
+		case "<<":
+			d := Dict{}
+			for {
+				k, err := l.token()
+				if err != nil {
+					return nil, err
+				}
+				if k == delimiter(">>") {
+					return d, nil
+				}
+				key, ok := k.(Name)
+				if !ok {
+					return nil, l.errorf("Expected a name in dictionary")
+				}
+				o, err := l.nested(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				if o != nil {
+					d[key] = o
+				}
+			}
+		}
+		l.pos = start
+		return nil, l.errorf("Unexpected %s", v)
+	}
+
+	return t, nil
+}
+
+// streamStart returns the offset of the data of a stream that
+// follows the stream keyword, or -1 if there is no stream.
+func (l *lexer) streamStart() int {
+	save := l.pos
+	if t, _ := l.token(); t != keyword("stream") {
+		l.pos = save
+		return -1
+	}
+	if l.pos < len(l.b) && l.b[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.b) && l.b[l.pos] == '\n' {
+		l.pos++
+	}
+	return l.pos
+}
+
+// Operation is an operator of a content stream and its operands.
+// The operand of an inline image is a Stream holding its
+// dictionary and data.
+type Operation struct {
+	Operator string
+	Operands []Object
+}
+
+// ParseContent splits a decoded content stream into its
+// operations.
+func ParseContent(content []byte) ([]Operation, error) {
+
+	l := &lexer{content, 0}
+	var ops []Operation
+	var operands []Object
+
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.b) {
+			break
+		}
+
+		o, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+
+		k, ok := o.(keyword)
+		if !ok {
+			operands = append(operands, o)
+			continue
+		}
+
+		if k == "BI" {
+			img, err := l.inlineImage()
+			if err != nil {
+				return nil, err
+			}
+			operands = append(operands, img)
+		}
+
+		ops = append(ops, Operation{string(k), operands})
+		operands = nil
+	}
+
+	return ops, nil
+}
+
+// inlineImage reads the dictionary and data of an inline image
+// up to and including the EI operator.
+func (l *lexer) inlineImage() (*Stream, error) {
+
+	d := Dict{}
+	for {
+		k, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		if k == keyword("ID") {
+			break
+		}
+		key, ok := k.(Name)
+		if !ok {
+			return nil, l.errorf("Expected a name in inline image")
+		}
+		v, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		d[key] = v
+	}
+
+	// A single white space character follows ID.
+	l.pos++
+	start := l.pos
+	for i := start; i+2 <= len(l.b); i++ {
+		if l.b[i] == 'E' && l.b[i+1] == 'I' && i > start && isWhite(l.b[i-1]) &&
+			(i+2 == len(l.b) || isWhite(l.b[i+2]) || isDelim(l.b[i+2])) {
+			l.pos = i + 2
+			return &Stream{d, l.b[start : i-1]}, nil
+		}
+	}
+	return nil, l.errorf("Unterminated inline image")
+}
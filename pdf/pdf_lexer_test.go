@@ -0,0 +1,99 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func checkParse(t *testing.T, src string, expected Object) {
+	l := &lexer{[]byte(src), 0}
+	o, err := l.object()
+	if err != nil {
+		t.Errorf("Expected %s to parse. Was %v", src, err)
+		return
+	}
+	if !reflect.DeepEqual(o, expected) {
+		t.Errorf("Expected %#v. Was %#v", expected, o)
+	}
+}
+
+func TestParseObjects(t *testing.T) {
+
+	checkParse(t, "42", 42)
+	checkParse(t, "-3.5", -3.5)
+	checkParse(t, ".5", 0.5)
+	checkParse(t, "true", true)
+	checkParse(t, "null", nil)
+	checkParse(t, "/Name#20With#2FHex", Name("Name With/Hex"))
+	checkParse(t, "(a (nested) string\\n\\051\\\r\nx)", String("a (nested) string\n)x"))
+	checkParse(t, "<48 65 6C6C 6F7>", String("Hello\x70"))
+	checkParse(t, "12 0 R", Ref{12, 0})
+	checkParse(t, "[1 2 0 R 3 /A]", Array{1, Ref{2, 0}, 3, Name("A")})
+	checkParse(t, "[1 2]", Array{1, 2})
+	checkParse(t, "<< /Type /Page % comment\r\n /Kids [3 0 R] /Empty null >>",
+		Dict{"Type": Name("Page"), "Kids": Array{Ref{3, 0}}})
+}
+
+func TestParseContent(t *testing.T) {
+
+	ops, err := ParseContent([]byte("q 1 0 0 1 10 20 cm BT /F1 12 Tf (Hi) Tj ET " +
+		"BI /W 2 /H 1 /BPC 8 /CS /G ID \x00\xFF EI Q"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, op := range ops {
+		names = append(names, op.Operator)
+	}
+	expected := []string{"q", "cm", "BT", "Tf", "Tj", "ET", "BI", "Q"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v. Was %v", expected, names)
+	}
+
+	if !reflect.DeepEqual(ops[3].Operands, []Object{Name("F1"), 12}) {
+		t.Errorf("Expected /F1 12. Was %v", ops[3].Operands)
+	}
+
+	img := ops[6].Operands[0].(*Stream)
+	if img.Dict["W"] != 2 || string(img.Data) != "\x00\xFF" {
+		t.Errorf("Expected a 2 pixel inline image. Was %v %q", img.Dict, img.Data)
+	}
+}
+
+func TestDecodeFilters(t *testing.T) {
+
+	for _, c := range []struct {
+		filter   Name
+		data     string
+		expected string
+	}{
+		{"ASCIIHexDecode", "48656c6C6f>", "Hello"},
+		{"ASCII85Decode", "87cURDZ~>", "Hello"},
+		{"RunLengthDecode", "\x01Hi\xFEo\x80", "Hiooo"},
+		{"LZWDecode", "\x80\x0B\x60\x50\x22\x0C\x0C\x85\x01", "-----A---B"},
+	} {
+		v, err := decodeFilter(c.filter, nil, []byte(c.data))
+		if err != nil {
+			t.Errorf("Expected %s to decode. Was %v", c.filter, err)
+		} else if string(v) != c.expected {
+			t.Errorf("Expected %q. Was %q", c.expected, v)
+		}
+	}
+
+	// Rows of two bytes using the Sub and Up predictors.
+	v, err := unpredict(Dict{"Predictor": 12, "Columns": 2},
+		[]byte{1, 1, 2, 2, 1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, []byte{1, 3, 2, 4}) {
+		t.Errorf("Expected [1 3 2 4]. Was %v", v)
+	}
+}
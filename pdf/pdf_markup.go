@@ -0,0 +1,562 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adkennan/dox2go"
+)
+
+// annotSubtypes are the subtypes of markup annotations, indexed
+// by dox2go.AnnotationType.
+var annotSubtypes = [...]string{
+	"Text", "Highlight", "Underline", "StrikeOut", "Squiggly", "Stamp",
+	"FreeText", "Square", "Circle", "Line", "Polygon", "PolyLine", "Ink",
+}
+
+// Annotation flags.
+const (
+	afPrint    = 1 << 2
+	afNoZoom   = 1 << 3
+	afNoRotate = 1 << 4
+)
+
+var yellow = dox2go.RGB(255, 255, 0)
+
+func (p *pdfPage) Annotate(x, y, w, h float64, a dox2go.Annotation) dox2go.Surface {
+
+	if a.Type < 0 || int(a.Type) >= len(annotSubtypes) {
+		panic("Invalid Annotation Type")
+	}
+
+	doc := p.doc
+
+	if a.Color == (dox2go.Color{}) {
+		a.Color = yellow
+	}
+	if a.Date.IsZero() {
+		a.Date = time.Now()
+	}
+	if a.Name == "" {
+		switch a.Type {
+		case dox2go.AT_Text:
+			a.Name = "Note"
+		case dox2go.AT_Stamp:
+			a.Name = "Draft"
+		}
+	}
+
+	var font *pdfFont
+	switch a.Type {
+	case dox2go.AT_Stamp, dox2go.AT_FreeText:
+		var ok bool
+		font, ok = a.Font.(*pdfFont)
+		if !ok {
+			fs := dox2go.FS_Regular
+			if a.Type == dox2go.AT_Stamp {
+				fs = dox2go.FS_Bold
+			}
+			font = doc.CreateFont(FONT_Helvetica, fs,
+				dox2go.ConvertUnit(12, dox2go.U_PT, p.pu)).(*pdfFont)
+		}
+
+		// The default appearance of free text refers to the
+		// font by its name in the form's resources.
+		if a.Type == dox2go.AT_FreeText {
+			doc.acroForm().addFont(font.face)
+		}
+	}
+
+	q := p.pageQuad(x, y, w, h)
+	pts := p.pagePoints(a.Points)
+	if a.Type == dox2go.AT_Line && len(pts) < 4 {
+		pts = []float64{q[0], q[1], q[4], q[5]}
+	}
+	ink := make([][]float64, len(a.Ink))
+	for ix, stroke := range a.Ink {
+		ink[ix] = p.pagePoints(stroke)
+	}
+
+	// The bounds include the whole width of the lines
+	// joining the points. An empty rectangle is ignored when
+	// there are points.
+	r := q.bounds()
+	if (w == 0 || h == 0) && (len(pts) > 0 || len(ink) > 0) {
+		r = rect{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	}
+	for _, s := range append([][]float64{pts}, ink...) {
+		for ix := 0; ix+1 < len(s); ix += 2 {
+			r[0] = math.Min(r[0], s[ix]-1)
+			r[1] = math.Min(r[1], s[ix+1]-1)
+			r[2] = math.Max(r[2], s[ix]+1)
+			r[3] = math.Max(r[3], s[ix+1]+1)
+		}
+	}
+
+	an := &pdfMarkupAnnot{len(doc.objs) + 1, p, a, q, r, pts, ink, font, nil, nil}
+	p.addAnnot(an)
+
+	if a.Contents != "" {
+		an.popup = &pdfPopup{len(doc.objs) + 1, an}
+		p.addAnnot(an.popup)
+	}
+
+	an.ap = doc.newFormXObj(p.pu,
+		dox2go.ConvertUnit(r[2]-r[0], dox2go.U_PT, p.pu),
+		dox2go.ConvertUnit(r[3]-r[1], dox2go.U_PT, p.pu))
+	an.drawAppearance()
+
+	return an.ap.sfc
+}
+
+// pagePoints transforms x, y pairs, in the page's unit, by the
+// current transformation of the page's surface.
+func (p *pdfPage) pagePoints(pts []float64) []float64 {
+	sfc := p.Surface().(*pdfSurface)
+	res := make([]float64, 0, len(pts))
+	for ix := 0; ix+1 < len(pts); ix += 2 {
+		x, y := sfc.ctm.transform(
+			dox2go.ConvertUnit(pts[ix], p.pu, dox2go.U_PT),
+			dox2go.ConvertUnit(pts[ix+1], p.pu, dox2go.U_PT))
+		res = append(res, x, y)
+	}
+	return res
+}
+
+// writeNumbers writes an array of numbers.
+func writeNumbers(ps pdfStructure, vals []float64) {
+	aw := arrayWriter{ps.Writer(), 0, nil}
+	aw.Start()
+	for _, v := range vals {
+		aw.Value(" ")
+		aw.Value(strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	aw.End()
+	ps.HandleResult(aw.n, aw.err)
+}
+
+// drawIcon draws the icon shown for notes and attached files.
+func drawIcon(s *pdfSurface, w, h float64, bg dox2go.Color) {
+	lw := dox2go.ConvertUnit(1, dox2go.U_PT, s.u)
+	path := dox2go.NewPath()
+	path.Rect(lw/2, lw/2, w-lw/2, h-lw/2)
+	s.Bg(bg)
+	s.Fill(path)
+	s.LineWidth(lw)
+	s.Fg(black)
+	s.Stroke(path)
+	path = dox2go.NewPath()
+	for ix := 1; ix <= 3; ix++ {
+		y := h * float64(ix) / 4
+		path.Move(w/4, y)
+		path.Line(3*w/4, y)
+	}
+	s.Stroke(path)
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfMarkupAnnot is a markup annotation. Its points are in
+// default user space.
+type pdfMarkupAnnot struct {
+	id    int
+	page  *pdfPage
+	a     dox2go.Annotation
+	q     quad
+	r     rect
+	pts   []float64
+	ink   [][]float64
+	font  *pdfFont
+	popup *pdfPopup
+	ap    *pdfFormXObj
+}
+
+func (an *pdfMarkupAnnot) Id() int {
+	return an.id
+}
+
+func (an *pdfMarkupAnnot) Type() string {
+	return "Annot"
+}
+
+// local converts a point in default user space to the
+// coordinates of the annotation's appearance.
+func (an *pdfMarkupAnnot) local(x, y float64) (float64, float64) {
+	pu := an.page.pu
+	return dox2go.ConvertUnit(x-an.r[0], dox2go.U_PT, pu),
+		dox2go.ConvertUnit(y-an.r[1], dox2go.U_PT, pu)
+}
+
+// across returns the point a fraction f of the way along the
+// line across the annotation's quad a fraction t of the way
+// from its bottom to its top.
+func (an *pdfMarkupAnnot) across(t, f float64) (float64, float64) {
+	q := an.q
+	lx, ly := q[0]+t*(q[6]-q[0]), q[1]+t*(q[7]-q[1])
+	rx, ry := q[2]+t*(q[4]-q[2]), q[3]+t*(q[5]-q[3])
+	return an.local(lx+f*(rx-lx), ly+f*(ry-ly))
+}
+
+// polyline returns a path joining points in default user space.
+func (an *pdfMarkupAnnot) polyline(pts []float64, closed bool) *dox2go.Path {
+	path := dox2go.NewPath()
+	for ix := 0; ix+1 < len(pts); ix += 2 {
+		x, y := an.local(pts[ix], pts[ix+1])
+		if ix == 0 {
+			path.Move(x, y)
+		} else {
+			path.Line(x, y)
+		}
+	}
+	if closed {
+		path.Close()
+	}
+	return path
+}
+
+func (an *pdfMarkupAnnot) drawAppearance() {
+
+	s := an.ap.sfc
+	pu := an.page.pu
+	w := dox2go.ConvertUnit(an.r[2]-an.r[0], dox2go.U_PT, pu)
+	h := dox2go.ConvertUnit(an.r[3]-an.r[1], dox2go.U_PT, pu)
+	lw := dox2go.ConvertUnit(1, dox2go.U_PT, pu)
+	c := an.a.Color
+
+	s.LineWidth(lw)
+	s.Fg(c)
+
+	switch an.a.Type {
+	case dox2go.AT_Text:
+		drawIcon(s, w, h, c)
+
+	case dox2go.AT_Highlight:
+		s.setExtGState(an.page.doc.multiplyState())
+		s.Bg(c)
+		s.Fill(an.polyline(an.q[:], true))
+
+	case dox2go.AT_Underline, dox2go.AT_StrikeOut:
+		t := 0.08
+		if an.a.Type == dox2go.AT_StrikeOut {
+			t = 0.5
+		}
+		path := dox2go.NewPath()
+		path.Move(an.across(t, 0))
+		path.Line(an.across(t, 1))
+		s.Stroke(path)
+
+	case dox2go.AT_Squiggly:
+		// The waves are about a quarter of the height of
+		// the text apart.
+		q := an.q
+		length := math.Hypot(q[2]-q[0], q[3]-q[1])
+		height := math.Hypot(q[6]-q[0], q[7]-q[1])
+		n := int(math.Max(4, math.Ceil(4*length/math.Max(height, 1))))
+		path := dox2go.NewPath()
+		path.Move(an.across(0.02, 0))
+		for ix := 1; ix <= n; ix++ {
+			t := 0.02
+			if ix%2 == 1 {
+				t = 0.14
+			}
+			path.Line(an.across(t, float64(ix)/float64(n)))
+		}
+		s.Stroke(path)
+
+	case dox2go.AT_Stamp:
+		path := dox2go.NewPath()
+		path.Rect(lw, lw, w-lw, h-lw)
+		s.LineWidth(2 * lw)
+		s.Stroke(path)
+
+		// Without font metrics the text is centered using an
+		// average character width.
+		text := strings.ToUpper(an.a.Name)
+		size := math.Min(0.5*h, (w-4*lw)/(0.7*float64(len([]rune(text)))))
+		f := &pdfFont{an.font.face, size}
+		s.Bg(c)
+		s.Text(f, (w-0.7*size*float64(len([]rune(text))))/2, (h-0.7*size)/2, text)
+
+	case dox2go.AT_FreeText:
+		path := dox2go.NewPath()
+		path.Rect(lw/2, lw/2, w-lw/2, h-lw/2)
+		s.Bg(white)
+		s.Fill(path)
+		s.Stroke(path)
+
+		s.PushState()
+		s.clipRect(lw, lw, w-2*lw, h-2*lw)
+		s.Bg(black)
+		size := an.font.size
+		pad := 2 * lw
+		for ix, l := range strings.Split(an.a.Contents, "\n") {
+			s.Text(an.font, pad, h-pad-size-float64(ix)*1.15*size, l)
+			s.endText()
+		}
+		s.PopState()
+
+	case dox2go.AT_Square:
+		path := dox2go.NewPath()
+		path.Rect(lw/2, lw/2, w-lw/2, h-lw/2)
+		s.Stroke(path)
+
+	case dox2go.AT_Circle:
+		// The ellipse is made of four Bezier curves.
+		const k = 0.5522847498
+		cx, cy := w/2, h/2
+		rx, ry := (w-lw)/2, (h-lw)/2
+		path := dox2go.NewPath()
+		path.Move(cx+rx, cy)
+		path.Curve(cx+rx, cy+k*ry, cx+k*rx, cy+ry, cx, cy+ry)
+		path.Curve(cx-k*rx, cy+ry, cx-rx, cy+k*ry, cx-rx, cy)
+		path.Curve(cx-rx, cy-k*ry, cx-k*rx, cy-ry, cx, cy-ry)
+		path.Curve(cx+k*rx, cy-ry, cx+rx, cy-k*ry, cx+rx, cy)
+		s.Stroke(path)
+
+	case dox2go.AT_Line, dox2go.AT_PolyLine:
+		s.Stroke(an.polyline(an.pts, false))
+
+	case dox2go.AT_Polygon:
+		s.Stroke(an.polyline(an.pts, true))
+
+	case dox2go.AT_Ink:
+		for _, stroke := range an.ink {
+			s.Stroke(an.polyline(stroke, false))
+		}
+	}
+}
+
+func (an *pdfMarkupAnnot) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(an, w)
+	if err != nil {
+		return 0, err
+	}
+
+	a := an.a
+	c := a.Color
+
+	dw := dictionaryWriter{w, 0, nil}
+	aw := arrayWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(an.Type())
+	dw.Name("Subtype")
+	dw.Name(annotSubtypes[a.Type])
+	dw.Name("Rect")
+	an.r.write(&dw)
+	dw.Name("F")
+	if a.Type == dox2go.AT_Text {
+		dw.Value(afPrint | afNoZoom | afNoRotate)
+	} else {
+		dw.Value(afPrint)
+	}
+	dw.Name("C")
+	writeNumbers(&dw, []float64{float64(c.R) / 255, float64(c.G) / 255, float64(c.B) / 255})
+	if c.A < 255 {
+		dw.Name("CA")
+		dw.Value(strconv.FormatFloat(float64(c.A)/255, 'f', 3, 64))
+	}
+	if a.Author != "" {
+		dw.Name("T")
+		dw.String(a.Author)
+	}
+	dw.Name("M")
+	dw.String(pdfDate(a.Date))
+	dw.Name("CreationDate")
+	dw.String(pdfDate(a.Date))
+	if a.Contents != "" {
+		dw.Name("Contents")
+		dw.String(a.Contents)
+	}
+	if an.popup != nil {
+		dw.Name("Popup")
+		dw.Ref(an.popup)
+	}
+	dw.Name("AP")
+	dw.Start()
+	dw.Name("N")
+	dw.Ref(an.ap)
+	dw.End()
+
+	switch a.Type {
+	case dox2go.AT_Text:
+		dw.Name("Name")
+		dw.Name(a.Name)
+		dw.Name("Open")
+		dw.Value(a.Open)
+
+	case dox2go.AT_Highlight, dox2go.AT_Underline, dox2go.AT_StrikeOut, dox2go.AT_Squiggly:
+		// Viewers expect the corners of text markup in the
+		// order top left, top right, bottom left, bottom right.
+		q := an.q
+		dw.Name("QuadPoints")
+		writeNumbers(&dw, []float64{q[6], q[7], q[4], q[5], q[0], q[1], q[2], q[3]})
+
+	case dox2go.AT_Stamp:
+		dw.Name("Name")
+		dw.Name(a.Name)
+
+	case dox2go.AT_FreeText:
+		dw.Name("DA")
+		dw.String(fmt.Sprintf("/F%d %f Tf 0 g", an.font.face.id,
+			dox2go.ConvertUnit(an.font.size, an.page.pu, dox2go.U_PT)))
+
+	default:
+		dw.Name("BS")
+		dw.Start()
+		dw.Name("W")
+		dw.Value(1)
+		dw.End()
+	}
+
+	switch a.Type {
+	case dox2go.AT_Line:
+		dw.Name("L")
+		writeNumbers(&dw, an.pts[:4])
+
+	case dox2go.AT_Polygon, dox2go.AT_PolyLine:
+		dw.Name("Vertices")
+		writeNumbers(&dw, an.pts)
+
+	case dox2go.AT_Ink:
+		dw.Name("InkList")
+		aw.Start()
+		for _, stroke := range an.ink {
+			writeNumbers(&aw, stroke)
+		}
+		aw.End()
+	}
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	if aw.err != nil {
+		return n, aw.err
+	}
+	n += dw.n + aw.n
+
+	n2, err := endObj(an, w)
+	n += int64(n2)
+	return n, err
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfPopup is the window showing the contents of a markup
+// annotation. It is placed beside the annotation.
+type pdfPopup struct {
+	id     int
+	parent *pdfMarkupAnnot
+}
+
+func (p *pdfPopup) Id() int {
+	return p.id
+}
+
+func (p *pdfPopup) Type() string {
+	return "Annot"
+}
+
+func (p *pdfPopup) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(p, w)
+	if err != nil {
+		return 0, err
+	}
+
+	r := p.parent.r
+	dw := dictionaryWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(p.Type())
+	dw.Name("Subtype")
+	dw.Name("Popup")
+	dw.Name("Rect")
+	rect{r[2], r[3] - 120, r[2] + 180, r[3]}.write(&dw)
+	dw.Name("Parent")
+	dw.Ref(p.parent)
+	dw.Name("Open")
+	dw.Value(p.parent.a.Open)
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	n += dw.n
+
+	n2, err := endObj(p, w)
+	n += int64(n2)
+	return n, err
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfExtGState is a graphics state parameter dictionary
+// setting the blend mode.
+type pdfExtGState struct {
+	id    int
+	blend string
+}
+
+// multiplyState returns the graphics state that multiplies
+// colors with the backdrop, adding it to the document if
+// necessary.
+func (doc *pdfDoc) multiplyState() *pdfExtGState {
+	if doc.multiply == nil {
+		doc.multiply = &pdfExtGState{len(doc.objs) + 1, "Multiply"}
+		doc.objs = append(doc.objs, doc.multiply)
+	}
+	return doc.multiply
+}
+
+func (gs *pdfExtGState) Id() int {
+	return gs.id
+}
+
+func (gs *pdfExtGState) Type() string {
+	return "ExtGState"
+}
+
+func (gs *pdfExtGState) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(gs, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(gs.Type())
+	dw.Name("BM")
+	dw.Name(gs.blend)
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	n += dw.n
+
+	n2, err := endObj(gs, w)
+	n += int64(n2)
+	return n, err
+}
+
+func (sfc *pdfSurface) setExtGState(gs *pdfExtGState) {
+	sfc.endText()
+
+	key := "GS" + strconv.Itoa(gs.id)
+	sfc.gstates[key] = gs
+
+	fmt.Fprintf(sfc.w, "/%s gs\r\n", key)
+}
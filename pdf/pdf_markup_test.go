@@ -0,0 +1,72 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/adkennan/dox2go"
+)
+
+func TestAnnotate(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	p := d.CreatePage(dox2go.U_PT, 600, 800, dox2go.PO_Portrait).(*pdfPage)
+
+	date := time.Date(2013, 5, 1, 9, 30, 0, 0, time.UTC)
+	p.Annotate(10, 20, 30, 40, dox2go.Annotation{
+		Type:     dox2go.AT_Highlight,
+		Author:   "Reviewer",
+		Date:     date,
+		Contents: "Check this",
+		Color:    dox2go.RGBA(255, 0, 0, 51),
+	})
+	s := p.Annotate(100, 100, 200, 50, dox2go.Annotation{Type: dox2go.AT_Stamp})
+	p.Annotate(0, 0, 0, 0, dox2go.Annotation{
+		Type:   dox2go.AT_Line,
+		Points: []float64{10, 10, 50, 20},
+	})
+
+	if len(p.annots) != 4 {
+		t.Errorf("Expected 4 annotations including a popup. Was %d", len(p.annots))
+	}
+
+	line := p.annots[3].(*pdfMarkupAnnot)
+	if line.r != (rect{9, 9, 51, 21}) {
+		t.Errorf("Expected %v. Was %v", rect{9, 9, 51, 21}, line.r)
+	}
+
+	stamp := p.annots[2].(*pdfMarkupAnnot)
+	if s != dox2go.Surface(stamp.ap.sfc) {
+		t.Errorf("Expected the appearance surface of the stamp to be returned.")
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{
+		"/Subtype  /Highlight",
+		"/QuadPoints  [  10 60 40 60 10 20 40 20 ]",
+		"/C  [  1 0 0 ]",
+		"/CA 0.200",
+		"(Reviewer)",
+		"(D:20130501093000Z)",
+		"/Subtype  /Popup",
+		"/BM  /Multiply",
+		"/Name  /Draft",
+		"(DRAFT)",
+		"/L  [  10 10 50 20 ]",
+	} {
+		if !bytes.Contains(b.Bytes(), []byte(s)) {
+			t.Errorf("Expected the document to contain %s", s)
+		}
+	}
+}
@@ -0,0 +1,808 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"unicode/utf16"
+
+	"github.com/adkennan/dox2go"
+)
+
+var ErrPageOrder = errors.New("The new order of pages must include each page once")
+
+// AppendPages adds pages of a document that is read to the end of
+// doc, where the first page is 0, and returns them. All of the
+// pages are appended, in order, when none are given. Appending a
+// range of pages to a new document splits the pages out of the
+// one that is read.
+//
+// The links, form fields and outline items that lead to the
+// appended pages are copied with them. Objects the pages share,
+// such as fonts and images, are copied once and streams that are
+// the same in several documents are only written once.
+//
+// Anything drawn on the surface of an appended page is drawn over
+// its content, using the coordinates of the page as it is
+// displayed, in points.
+func AppendPages(doc dox2go.Document, r *Reader, pages ...int) ([]dox2go.Page, error) {
+
+	d, ok := doc.(*pdfDoc)
+	if !ok {
+		return nil, ErrNotPdfDoc
+	}
+
+	if len(pages) == 0 {
+		pages = PageRange(0, r.NumPages()-1)
+	}
+
+	// The pages are found before any are added so that nothing
+	// is added when a page number is out of range.
+	src := make([]*ReadPage, len(pages))
+	for ix, n := range pages {
+		p, err := r.Page(n)
+		if err != nil {
+			return nil, err
+		}
+		src[ix] = p
+	}
+
+	// All of the pages are added before their contents are copied
+	// so that links between them are kept. A page appended more
+	// than once is linked to where it was first appended.
+	im := d.importer(r)
+	added := make([]dox2go.Page, len(src))
+	targets := make(map[int]*pdfPage)
+	for ix, sp := range src {
+		p := im.page(sp)
+		added[ix] = p
+		if id := sp.Ref().Id; id != 0 && im.ids[id] == nil {
+			im.ids[id] = p
+			targets[id] = p
+		}
+	}
+
+	for ix, sp := range src {
+		if err := im.fill(added[ix].(*pdfPage), sp); err != nil {
+			return nil, err
+		}
+	}
+
+	im.copyOutlines(targets)
+
+	return added, nil
+}
+
+// PageRange returns the numbers of the pages from first to last.
+func PageRange(first, last int) []int {
+	var pages []int
+	for n := first; n <= last; n++ {
+		pages = append(pages, n)
+	}
+	return pages
+}
+
+// ReorderPages changes the order of the pages of doc. Each entry
+// of order is the number of a page, where the first is 0, and
+// every page must be listed once.
+func ReorderPages(doc dox2go.Document, order []int) error {
+
+	d, ok := doc.(*pdfDoc)
+	if !ok {
+		return ErrNotPdfDoc
+	}
+
+	pages := d.pages.pages
+	if len(order) != len(pages) {
+		return ErrPageOrder
+	}
+
+	reordered := make([]*pdfPage, len(pages))
+	used := make([]bool, len(pages))
+	for ix, n := range order {
+		if n < 0 || n >= len(pages) || used[n] {
+			return ErrPageOrder
+		}
+		used[n] = true
+		reordered[ix] = pages[n]
+	}
+
+	// The last page of a streamed document is finished before it
+	// is moved as only the last page is finished later.
+	d.finishLastPage()
+
+	d.pages.pages = reordered
+	return nil
+}
+
+// RotatePage turns a page clockwise by a multiple of 90 degrees
+// when it is displayed. Everything on the page, including what
+// is drawn later, is turned with it.
+func RotatePage(p dox2go.Page, degrees int) {
+	if degrees%90 != 0 {
+		panic("Invalid Page Rotation")
+	}
+	if pp, ok := p.(*pdfPage); ok {
+		pp.rotate = ((pp.rotate+degrees)%360 + 360) % 360
+	}
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfPageSource holds the copied contents of a page appended
+// from another document and the form drawn over them.
+type pdfPageSource struct {
+	box       rect
+	resources Dict
+	contents  Array
+	attrs     Dict
+
+	// The form is drawn by the end content stream, with the
+	// original contents enclosed in q and Q.
+	name string
+	form *pdfFormXObj
+	q    *pdfContent
+	end  *pdfContent
+}
+
+// These entries of pages are copied as they are.
+var pageAttrs = []Name{"Group", "UserUnit", "Trans", "Dur"}
+
+var orientations = map[int]dox2go.PageOrientation{
+	0:   dox2go.PO_Portrait,
+	90:  dox2go.PO_Rotate90,
+	180: dox2go.PO_Rotate180,
+	270: dox2go.PO_Rotate270,
+}
+
+// page adds an empty page the size of a page that is read.
+func (im *pdfImporter) page(sp *ReadPage) *pdfPage {
+
+	doc := im.doc
+	doc.finishLastPage()
+
+	mb := sp.MediaBox()
+	box := quad{mb[0], mb[1], mb[2], mb[3], mb[0], mb[1], mb[2], mb[3]}.bounds()
+
+	po, ok := orientations[sp.Rotate()]
+	if !ok {
+		po = dox2go.PO_Portrait
+	}
+
+	p := &pdfPage{
+		len(doc.objs) + 1,
+		box[2] - box[0], box[3] - box[1],
+		po,
+		dox2go.U_PT,
+		doc.pages,
+		doc,
+		nil,
+		make([]pdfObj, 0),
+		nil,
+		[4]*rect{},
+		0,
+		0,
+		nil,
+		&pdfPageSource{box, nil, nil, make(Dict), "", nil, nil, nil},
+	}
+
+	for ix, name := range boxNames {
+		if b, ok := sp.box(Name(name)); ok {
+			r := quad{b[0], b[1], b[2], b[3], b[0], b[1], b[2], b[3]}.bounds()
+			p.boxes[ix] = &r
+		}
+	}
+
+	doc.objs = append(doc.objs, p)
+	doc.pages.pages = append(doc.pages.pages, p)
+
+	return p
+}
+
+// fill copies the contents, resources and annotations of a page
+// that is read to the page it was appended as.
+func (im *pdfImporter) fill(p *pdfPage, sp *ReadPage) error {
+
+	s := p.src
+
+	// The XObjects are copied into a dictionary of their own so
+	// that the form drawn over the page can be added.
+	res, err := sp.Resources()
+	if err != nil {
+		return err
+	}
+	direct := make(Dict, len(res))
+	for k, v := range res {
+		direct[k] = v
+	}
+	xobjs, err := im.r.resolveDict(res["XObject"])
+	if err != nil {
+		return err
+	}
+	if xobjs != nil {
+		direct["XObject"] = xobjs
+	}
+	c, err := im.copy(direct)
+	if err != nil {
+		return err
+	}
+	s.resources = c.(Dict)
+
+	contents := sp.Dict()["Contents"]
+	if ref, ok := contents.(Ref); ok {
+		o, err := im.r.Object(ref)
+		if err != nil {
+			return err
+		}
+		if a, ok := o.(Array); ok {
+			contents = a
+		}
+	}
+	a, ok := contents.(Array)
+	if !ok && contents != nil {
+		a = Array{contents}
+	}
+	if c, err = im.copy(a); err != nil {
+		return err
+	}
+	s.contents = withoutNulls(c.(Array))
+
+	for _, k := range pageAttrs {
+		if v, ok := sp.Dict()[k]; ok {
+			if s.attrs[k], err = im.copy(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	annots, err := im.r.resolveArray(sp.Dict()["Annots"])
+	if err != nil {
+		return err
+	}
+	for _, a := range annots {
+		// Annotations on a page appended twice are only copied to
+		// the first.
+		ref, ok := a.(Ref)
+		if !ok || im.placed[ref.Id] {
+			continue
+		}
+		if _, err := im.copy(ref); err != nil {
+			return err
+		}
+		cp, ok := im.ids[ref.Id].(*pdfImportedObj)
+		if !ok {
+			continue
+		}
+		im.placed[ref.Id] = true
+		p.annots = append(p.annots, cp)
+
+		if d, _ := cp.obj.(Dict); d["Subtype"] == Name("Widget") {
+			if err := im.addField(ref); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// write writes the contents and resources of an appended page.
+func (s *pdfPageSource) write(dw *dictionaryWriter) {
+
+	contents := s.contents
+	res := s.resources
+	if s.form != nil {
+		contents = append(Array{Ref{s.q.id, 0}}, contents...)
+		contents = append(contents, Ref{s.end.id, 0})
+
+		res = make(Dict, len(s.resources)+1)
+		for k, v := range s.resources {
+			res[k] = v
+		}
+		xobjs := Dict{Name(s.name): Ref{s.form.id, 0}}
+		if d, ok := s.resources["XObject"].(Dict); ok {
+			for k, v := range d {
+				xobjs[k] = v
+			}
+		}
+		res["XObject"] = xobjs
+	}
+
+	dw.Name("Contents")
+	psObject(dw, contents)
+	dw.Name("Resources")
+	psObject(dw, res)
+	for _, k := range pageAttrs {
+		if v, ok := s.attrs[k]; ok {
+			psName(dw, string(k))
+			psObject(dw, v)
+		}
+	}
+}
+
+// overlay returns the surface of the form drawn over the
+// contents of an appended page. The form uses its own resources
+// so that their names cannot clash with those of the page.
+func (p *pdfPage) overlay() *pdfSurface {
+
+	doc := p.doc
+	s := p.src
+
+	s.form = doc.newFormXObj(p.pu, p.w, p.h)
+	s.form.bbox = s.box
+
+	xobjs, _ := s.resources["XObject"].(Dict)
+	for n := s.form.id; ; n++ {
+		s.name = fmt.Sprintf("Fm%d", n)
+		if _, used := xobjs[Name(s.name)]; !used {
+			break
+		}
+	}
+
+	s.q = &pdfContent{len(doc.objs) + 1, doc.getBuffer(contentBuf)}
+	s.end = &pdfContent{len(doc.objs) + 2, doc.getBuffer(contentBuf)}
+	fmt.Fprint(s.q.b, "q\r\n")
+	fmt.Fprintf(s.end.b, "Q\r\n/%s Do\r\n", s.name)
+	doc.objs = append(doc.objs, s.q, s.end)
+
+	return s.form.sfc
+}
+
+// finishOverlay writes the form drawn over an appended page of a
+// streamed document and releases its content.
+func (doc *pdfDoc) finishOverlay(s *pdfPageSource) error {
+	if s.form.c == nil {
+		return nil
+	}
+	for _, o := range []pdfObj{s.q, s.end, s.form} {
+		if err := doc.flush(o); err != nil {
+			return err
+		}
+	}
+	doc.pool.FreeBuffer(s.form.c)
+	s.form.c = nil
+	return nil
+}
+
+///////////////////////////////////////////////////////////
+
+func isAnnot(d Dict) bool {
+	return d["Type"] == Name("Annot") || d["Subtype"] != nil && d["Rect"] != nil
+}
+
+// isPage reports whether ref refers to a page that has been
+// appended to the document.
+func (im *pdfImporter) isPage(ref Ref) bool {
+	_, ok := im.ids[ref.Id].(*pdfPage)
+	return ok
+}
+
+// annotation returns an annotation to be copied without the
+// entries that cannot be copied. Links lead to explicit
+// destinations as the names of the document are not copied.
+// Annotations on pages, or links to pages, that have not been
+// appended are left out by returning nil.
+func (im *pdfImporter) annotation(d Dict) Dict {
+
+	if p, ok := d["P"].(Ref); ok && !im.isPage(p) {
+		return nil
+	}
+
+	a := make(Dict, len(d))
+	for k, v := range d {
+		if k != "StructParent" {
+			a[k] = v
+		}
+	}
+	if d["Subtype"] != Name("Link") {
+		return a
+	}
+
+	dest := d["Dest"]
+	if action, _ := im.r.resolveDict(d["A"]); action["S"] == Name("GoTo") {
+		dest = action["D"]
+		delete(a, "A")
+	}
+	if dest == nil {
+		return a
+	}
+
+	explicit := im.r.destination(dest)
+	if explicit == nil {
+		return nil
+	}
+	if ref, ok := explicit[0].(Ref); !ok || !im.isPage(ref) {
+		return nil
+	}
+	a["Dest"] = explicit
+	return a
+}
+
+// destination returns the explicit destination, an array that
+// starts with a page, that o leads to. Named destinations are
+// looked up in the catalog.
+func (r *Reader) destination(o Object) Array {
+
+	o, _ = r.Resolve(o)
+	switch v := o.(type) {
+	case Name:
+		cat, _ := r.Catalog()
+		dests, _ := r.resolveDict(cat["Dests"])
+		o, _ = r.Resolve(dests[v])
+	case String:
+		cat, _ := r.Catalog()
+		names, _ := r.resolveDict(cat["Names"])
+		o = r.lookupName(names["Dests"], string(v), 0)
+	}
+
+	if d, ok := o.(Dict); ok {
+		o, _ = r.Resolve(d["D"])
+	}
+	a, _ := o.(Array)
+	if len(a) == 0 {
+		return nil
+	}
+	return a
+}
+
+// lookupName finds the value of key in a name tree.
+func (r *Reader) lookupName(node Object, key string, depth int) Object {
+
+	d, _ := r.resolveDict(node)
+	if d == nil || depth > 32 {
+		return nil
+	}
+
+	names, _ := r.resolveArray(d["Names"])
+	for ix := 0; ix+1 < len(names); ix += 2 {
+		if k, _ := r.Resolve(names[ix]); k != nil {
+			if s, ok := k.(String); ok && string(s) == key {
+				v, _ := r.Resolve(names[ix+1])
+				return v
+			}
+		}
+	}
+
+	kids, _ := r.resolveArray(d["Kids"])
+	for _, k := range kids {
+		if v := r.lookupName(k, key, depth+1); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// addField adds the field of a copied widget annotation to the
+// form of the document. Fields are renamed when the document
+// already has a field with the same name.
+func (im *pdfImporter) addField(widget Ref) error {
+
+	root := widget
+	for i := 0; i < 32; i++ {
+		d, err := im.r.resolveDict(root)
+		if err != nil {
+			return err
+		}
+		parent, ok := d["Parent"].(Ref)
+		if !ok {
+			break
+		}
+		root = parent
+	}
+
+	cp, ok := im.ids[root.Id].(*pdfImportedObj)
+	if !ok {
+		return nil
+	}
+	field, ok := cp.obj.(Dict)
+	if !ok {
+		return nil
+	}
+
+	af := im.doc.acroForm()
+	for _, f := range af.fields {
+		if f == cp {
+			return nil
+		}
+	}
+
+	cat, err := im.r.Catalog()
+	if err != nil {
+		return err
+	}
+	form, err := im.r.resolveDict(cat["AcroForm"])
+	if err != nil {
+		return err
+	}
+
+	// Fields use the default appearance and fonts of the form
+	// they came from.
+	if field["DA"] == nil && form["DA"] != nil {
+		if field["DA"], err = im.copy(form["DA"]); err != nil {
+			return err
+		}
+	}
+	fonts, err := im.formFonts(form)
+	if err != nil {
+		return err
+	}
+	im.renameFonts(cp, fonts, 0)
+	if na, _ := im.r.Resolve(form["NeedAppearances"]); na == true {
+		af.needAppearances = true
+	}
+
+	if t, ok := field["T"].(String); ok {
+		name := decodeText(t)
+		unique := name
+		for n := 2; af.hasField(unique); n++ {
+			unique = fmt.Sprintf("%s_%d", name, n)
+		}
+		field["T"] = String(stringBytes(unique))
+	}
+
+	af.fields = append(af.fields, cp)
+	return nil
+}
+
+// formFonts copies the fonts of the form of the document that
+// is read and returns the names they are given in the form of
+// the document. A font is renamed when its name is used by
+// another font or could be used by one created later.
+func (im *pdfImporter) formFonts(form Dict) (map[Name]Name, error) {
+
+	if im.fonts != nil {
+		return im.fonts, nil
+	}
+
+	dr, err := im.r.resolveDict(form["DR"])
+	if err != nil {
+		return nil, err
+	}
+	fonts, err := im.r.resolveDict(dr["Font"])
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(fonts))
+	for k := range fonts {
+		keys = append(keys, string(k))
+	}
+	sortNames(keys)
+
+	af := im.doc.acroForm()
+	im.fonts = make(map[Name]Name)
+	for _, k := range keys {
+		c, err := im.copy(fonts[Name(k)])
+		if err != nil {
+			return nil, err
+		}
+		name := Name(k)
+		for n := 2; ; n++ {
+			cur, used := af.imported[name]
+			if ref, ok := c.(Ref); used && ok && cur == ref || !used && !fontName.MatchString(string(name)) {
+				break
+			}
+			name = Name(fmt.Sprintf("%s_%d", k, n))
+		}
+		af.imported[name] = c
+		im.fonts[Name(k)] = name
+	}
+	return im.fonts, nil
+}
+
+// fontName matches the names given to the fonts created in
+// the document.
+var fontName = regexp.MustCompile(`^F[0-9]+$`)
+
+// renameFonts changes the fonts named in the default
+// appearance of a copied field and its kids to the names given
+// by formFonts.
+func (im *pdfImporter) renameFonts(o *pdfImportedObj, fonts map[Name]Name, depth int) {
+
+	d, ok := o.obj.(Dict)
+	if !ok || depth > 32 {
+		return
+	}
+	if da, ok := d["DA"].(String); ok {
+		d["DA"] = renameFonts(da, fonts)
+	}
+	kids, _ := d["Kids"].(Array)
+	for _, k := range kids {
+		if ref, ok := k.(Ref); ok && ref.Id > 0 && ref.Id <= len(im.doc.objs) {
+			if kid, ok := im.doc.objs[ref.Id-1].(*pdfImportedObj); ok {
+				im.renameFonts(kid, fonts, depth+1)
+			}
+		}
+	}
+}
+
+// renameFonts returns the default appearance da with the names
+// of fonts changed to those in fonts.
+func renameFonts(da String, fonts map[Name]Name) String {
+
+	var b bytes.Buffer
+	l := &lexer{[]byte(da), 0}
+	for {
+		l.skipSpace()
+		start := l.pos
+		t, err := l.token()
+		if err != nil || t == nil {
+			b.Write(l.b[start:])
+			break
+		}
+		if name, ok := t.(Name); ok && fonts[name] != "" {
+			b.WriteString("/" + escapeName(string(fonts[name])))
+		} else {
+			b.Write(l.b[start:l.pos])
+		}
+		b.WriteByte(' ')
+	}
+	return String(bytes.TrimSpace(b.Bytes()))
+}
+
+// copyOutlines adds the outline items of the document that is
+// read that lead to pages in targets, along with the items
+// containing them. Damaged outlines are left out.
+func (im *pdfImporter) copyOutlines(targets map[int]*pdfPage) {
+
+	cat, _ := im.r.Catalog()
+	outlines, _ := im.r.resolveDict(cat["Outlines"])
+	if outlines == nil {
+		return
+	}
+
+	items := im.outline(outlines["First"], targets, make(map[Ref]bool))
+	doc := im.doc
+	attachOutline(doc, doc.outlines, &doc.outlines.items, items)
+}
+
+// outline returns the outline item o, the items that follow it
+// and their children, leaving out those that do not lead to
+// pages in targets. The items are added to the document by
+// attachOutline.
+func (im *pdfImporter) outline(o Object, targets map[int]*pdfPage, seen map[Ref]bool) []*pdfOutlineItem {
+
+	var items []*pdfOutlineItem
+	for {
+		ref, ok := o.(Ref)
+		if !ok || seen[ref] {
+			return items
+		}
+		seen[ref] = true
+
+		d, _ := im.r.resolveDict(ref)
+		if d == nil {
+			return items
+		}
+		o = d["Next"]
+
+		i := &pdfOutlineItem{
+			0,
+			im.doc,
+			nil,
+			nil,
+			nil,
+			im.outline(d["First"], targets, seen),
+			"",
+			im.outlineDest(d, targets),
+			false,
+			nil,
+			dox2go.FS_Regular,
+		}
+		if i.dest == nil && len(i.items) == 0 {
+			continue
+		}
+
+		if t, _ := im.r.Resolve(d["Title"]); t != nil {
+			if s, ok := t.(String); ok {
+				i.title = decodeText(s)
+			}
+		}
+		if c, _ := im.r.Resolve(d["Count"]); c != nil {
+			n, _ := c.(int)
+			i.open = n > 0
+		}
+		if c, _ := im.r.resolveArray(d["C"]); len(c) == 3 {
+			var rgb [3]uint8
+			for ix, v := range c {
+				f, _ := number(v)
+				rgb[ix] = uint8(f*255 + 0.5)
+			}
+			i.color = &dox2go.Color{R: rgb[0], G: rgb[1], B: rgb[2], A: 255}
+		}
+		if f, _ := im.r.Resolve(d["F"]); f != nil {
+			flags, _ := f.(int)
+			if flags&1 != 0 {
+				i.fs |= dox2go.FS_Italic
+			}
+			if flags&2 != 0 {
+				i.fs |= dox2go.FS_Bold
+			}
+		}
+
+		items = append(items, i)
+	}
+}
+
+// outlineDest returns the destination of an outline item if it
+// leads to one of the pages in targets. The explicit destination
+// is copied, as links are, so that its position stays in the
+// default coordinates of the page.
+func (im *pdfImporter) outlineDest(d Dict, targets map[int]*pdfPage) destination {
+
+	dest := d["Dest"]
+	if action, _ := im.r.resolveDict(d["A"]); action["S"] == Name("GoTo") {
+		dest = action["D"]
+	}
+	a := im.r.destination(dest)
+	if a == nil {
+		return nil
+	}
+	if ref, ok := a[0].(Ref); !ok || targets[ref.Id] == nil {
+		return nil
+	}
+
+	c, err := im.copy(a)
+	if err != nil {
+		im.doc.fail(err)
+		return nil
+	}
+	return copiedDest{c}
+}
+
+// attachOutline adds outline items and their children to the
+// document below parent.
+func attachOutline(doc *pdfDoc, parent pdfObj, items *[]*pdfOutlineItem, add []*pdfOutlineItem) {
+	for _, i := range add {
+		kids := i.items
+
+		i.id = len(doc.objs) + 1
+		i.parent = parent
+		i.items = make([]*pdfOutlineItem, 0)
+		if len(*items) > 0 {
+			last := (*items)[len(*items)-1]
+			last.next = i
+			i.prev = last
+		}
+		*items = append(*items, i)
+		doc.objs = append(doc.objs, i)
+
+		attachOutline(doc, i, &i.items, kids)
+	}
+}
+
+func number(o Object) (float64, bool) {
+	switch v := o.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// decodeText returns the text of a PDF text string, which is
+// either UTF-16BE, starting with a byte order mark, or one byte
+// per character.
+func decodeText(s String) string {
+	if len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF {
+		u := make([]uint16, 0, len(s)/2)
+		for ix := 2; ix+1 < len(s); ix += 2 {
+			u = append(u, uint16(s[ix])<<8|uint16(s[ix+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+	r := make([]rune, len(s))
+	for ix, c := range s {
+		r[ix] = rune(c)
+	}
+	return string(r)
+}
@@ -0,0 +1,415 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/adkennan/dox2go"
+)
+
+// linkedDoc returns a document of three pages with a bookmark
+// for each, a link from the first page to the last and from the
+// second to the first, and a field on the last.
+func linkedDoc(t *testing.T) []byte {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	f := d.CreateFont(FONT_Helvetica, dox2go.FS_Regular, 12)
+
+	var pages []dox2go.Page
+	for ix, title := range []string{"One", "Two", "Three"} {
+		p := d.CreatePage(dox2go.U_PT, 300, 200, dox2go.PO_Portrait)
+		p.Surface().Text(f, 10, 10, title)
+		d.AddBookmark(title, p, 0, 200).AddBookmark(title+" child", p, 0, 100)
+		pages = append(pages, p)
+		if ix > 0 {
+			pages[ix].LinkPage(10, 10, 50, 20, pages[ix-1], dox2go.PF_Fit)
+		}
+	}
+	pages[0].LinkPage(10, 10, 50, 20, pages[2], dox2go.PF_Fit)
+	pages[2].AddField(10, 100, 100, 20, dox2go.FormField{Type: dox2go.FT_Text, Name: "Name", Value: "A"})
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// annots returns the annotations of a page of a document that
+// is read.
+func annots(t *testing.T, r *Reader, n int) []Dict {
+	p, err := r.Page(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := r.resolveArray(p.Dict()["Annots"])
+	var out []Dict
+	for _, o := range a {
+		d, _ := r.resolveDict(o)
+		out = append(out, d)
+	}
+	return out
+}
+
+func TestAppendPages(t *testing.T) {
+
+	src := sourceDoc(t)
+	other := sourceDoc(t)
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+
+	pages, err := AppendPages(d, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 {
+		t.Errorf("Expected 2 pages. Was %d", len(pages))
+	}
+	if _, err = AppendPages(d, other, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = AppendPages(d, other, 0, 2); err != ErrPageRange {
+		t.Errorf("Expected %v. Was %v", ErrPageRange, err)
+	}
+	if err = d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := readPdf(t, b.Bytes())
+	if out.NumPages() != 4 {
+		t.Fatalf("Expected 4 pages. Was %d", out.NumPages())
+	}
+
+	for ix, rot := range []int{0, 90, 90, 0} {
+		p, _ := out.Page(ix)
+		if p.Rotate() != rot {
+			t.Errorf("Expected page %d to be rotated %d. Was %d", ix, rot, p.Rotate())
+		}
+		if p.MediaBox() != [4]float64{0, 0, 200, 100} {
+			t.Errorf("Expected a 200x100 media box. Was %v", p.MediaBox())
+		}
+		ops, err := p.Operations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ops) == 0 {
+			t.Errorf("Expected page %d to have content", ix)
+		}
+	}
+
+	// The image and font of both documents are the same so
+	// every page uses the same copies.
+	xobjs := make(map[Object]bool)
+	fonts := make(map[Object]bool)
+	for ix := 0; ix < 4; ix++ {
+		p, _ := out.Page(ix)
+		res, _ := p.Resources()
+		x, _ := out.resolveDict(res["XObject"])
+		for _, v := range x {
+			xobjs[v] = true
+		}
+		f, _ := out.resolveDict(res["Font"])
+		for _, v := range f {
+			fonts[v] = true
+		}
+	}
+	if len(xobjs) != 1 {
+		t.Errorf("Expected 1 image. Was %d", len(xobjs))
+	}
+	if len(fonts) != 1 {
+		t.Errorf("Expected 1 font. Was %d", len(fonts))
+	}
+}
+
+func TestSplitPages(t *testing.T) {
+
+	src := readPdf(t, linkedDoc(t))
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	if _, err := AppendPages(d, src, 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	// The second copy of a page does not have its annotations.
+	if _, err := AppendPages(d, src, 2); err != nil {
+		t.Fatal(err)
+	}
+	// Fields from another document with the same name are renamed.
+	if _, err := AppendPages(d, readPdf(t, linkedDoc(t)), PageRange(2, 2)...); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := readPdf(t, b.Bytes())
+	if out.NumPages() != 4 {
+		t.Fatalf("Expected 4 pages. Was %d", out.NumPages())
+	}
+	first, _ := out.Page(0)
+
+	// The link from the last page to the second is left out.
+	a := annots(t, out, 0)
+	if len(a) != 1 || a[0]["Subtype"] != Name("Widget") {
+		t.Errorf("Expected the first page to only have a field. Was %v", a)
+	}
+
+	a = annots(t, out, 1)
+	if len(a) != 1 || a[0]["Subtype"] != Name("Link") {
+		t.Fatalf("Expected the second page to have a link. Was %v", a)
+	}
+	if dest, _ := a[0]["Dest"].(Array); len(dest) == 0 || dest[0] != first.Ref() {
+		t.Errorf("Expected the link to lead to the first page. Was %v", a[0]["Dest"])
+	}
+
+	if a = annots(t, out, 2); len(a) != 0 {
+		t.Errorf("Expected the repeated page to have no annotations. Was %d", len(a))
+	}
+
+	cat, _ := out.Catalog()
+	form, _ := out.resolveDict(cat["AcroForm"])
+	fields, _ := out.resolveArray(form["Fields"])
+	var names []string
+	for _, f := range fields {
+		fd, _ := out.resolveDict(f)
+		name, _ := fd["T"].(String)
+		names = append(names, string(name))
+	}
+	if len(names) != 2 || names[0] != "Name" || names[1] != "Name_2" {
+		t.Errorf("Expected fields Name and Name_2. Was %v", names)
+	}
+
+	// The bookmarks for the pages that were appended are copied
+	// once for each document.
+	outlines, _ := out.resolveDict(cat["Outlines"])
+	var titles []string
+	for o := outlines["First"]; o != nil; {
+		item, _ := out.resolveDict(o)
+		title, _ := item["Title"].(String)
+		titles = append(titles, string(title))
+		if child, _ := out.resolveDict(item["First"]); child != nil {
+			title, _ = child["Title"].(String)
+			titles = append(titles, string(title))
+		}
+		o = item["Next"]
+	}
+	expected := []string{"One", "One child", "Three", "Three child", "Three", "Three child"}
+	if len(titles) != len(expected) {
+		t.Fatalf("Expected bookmarks %v. Was %v", expected, titles)
+	}
+	for ix, e := range expected {
+		if titles[ix] != e {
+			t.Errorf("Expected bookmarks %v. Was %v", expected, titles)
+			break
+		}
+	}
+}
+
+func TestDrawOnAppendedPage(t *testing.T) {
+
+	src := sourceDoc(t)
+
+	for _, opts := range [][]Option{nil, {Streaming()}} {
+		var b bytes.Buffer
+		d := NewPdfDoc(&b, opts...)
+		f := d.CreateFont(FONT_Helvetica, dox2go.FS_Bold, 12)
+
+		pages, err := AppendPages(d, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range pages {
+			p.Surface().Text(f, 10, 80, "Copy")
+		}
+		if err = d.Close(); err != nil {
+			t.Fatal(err)
+		}
+		checkOffsets(t, b.Bytes())
+
+		out := readPdf(t, b.Bytes())
+		for ix := range pages {
+			p, _ := out.Page(ix)
+			contents, _ := out.resolveArray(p.Dict()["Contents"])
+			if len(contents) != 3 {
+				t.Errorf("Expected the page's contents to be enclosed. Was %d streams", len(contents))
+			}
+			content, err := p.Content()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(content, []byte("q\r\n")) || !bytes.Contains(content, []byte("Q\r\n/Fm")) {
+				t.Errorf("Expected the form to be drawn after the page's content. Was %q", content)
+			}
+		}
+	}
+}
+
+func TestReorderPages(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	var pages []*pdfPage
+	for ix := 0; ix < 3; ix++ {
+		pages = append(pages, d.CreatePage(dox2go.U_PT, 100, 100, dox2go.PO_Portrait).(*pdfPage))
+	}
+
+	for _, order := range [][]int{{0, 1}, {0, 1, 1}, {0, 1, 3}} {
+		if err := ReorderPages(d, order); err != ErrPageOrder {
+			t.Errorf("Expected %v for %v. Was %v", ErrPageOrder, order, err)
+		}
+	}
+	if err := ReorderPages(d, []int{2, 0, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := readPdf(t, b.Bytes())
+	for ix, n := range []int{2, 0, 1} {
+		p, _ := out.Page(ix)
+		if p.Ref().Id != pages[n].id {
+			t.Errorf("Expected page %d to be %d. Was %d", ix, pages[n].id, p.Ref().Id)
+		}
+	}
+}
+
+func TestRotatePage(t *testing.T) {
+
+	src := sourceDoc(t)
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	p := d.CreatePage(dox2go.U_PT, 100, 100, dox2go.PO_Rotate90)
+	RotatePage(p, 90)
+	appended, err := AppendPages(d, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	RotatePage(appended[0], -90)
+	RotatePage(appended[1], 270)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := readPdf(t, b.Bytes())
+	for ix, rot := range []int{180, 270, 0} {
+		p, _ := out.Page(ix)
+		if p.Rotate() != rot {
+			t.Errorf("Expected page %d to be rotated %d. Was %d", ix, rot, p.Rotate())
+		}
+	}
+}
+
+func TestMergeFormFonts(t *testing.T) {
+
+	// Both documents name their only font F3.
+	form := func(face string) *Reader {
+		var b bytes.Buffer
+		d := NewPdfDoc(&b)
+		f := d.CreateFont(face, dox2go.FS_Regular, 12)
+		p := d.CreatePage(dox2go.U_PT, 200, 100, dox2go.PO_Portrait)
+		p.AddField(10, 10, 100, 20, dox2go.FormField{Type: dox2go.FT_Text, Name: face, Font: f})
+		if err := d.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return readPdf(t, b.Bytes())
+	}
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	f := d.CreateFont(FONT_Times, dox2go.FS_Regular, 12)
+	p := d.CreatePage(dox2go.U_PT, 200, 100, dox2go.PO_Portrait)
+	p.AddField(10, 10, 100, 20, dox2go.FormField{Type: dox2go.FT_Text, Name: FONT_Times, Font: f})
+	for _, face := range []string{FONT_Helvetica, FONT_Courier} {
+		if _, err := AppendPages(d, form(face)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := readPdf(t, b.Bytes())
+	cat, _ := out.Catalog()
+	af, _ := out.resolveDict(cat["AcroForm"])
+	dr, _ := out.resolveDict(af["DR"])
+	fonts, _ := out.resolveDict(dr["Font"])
+	if len(fonts) != 3 {
+		t.Errorf("Expected 3 fonts. Was %v", fonts)
+	}
+	fields, _ := out.resolveArray(af["Fields"])
+	if len(fields) != 3 {
+		t.Fatalf("Expected 3 fields. Was %d", len(fields))
+	}
+	for _, o := range fields {
+		field, _ := out.resolveDict(o)
+		name, _ := field["T"].(String)
+		da, _ := field["DA"].(String)
+		ops, err := ParseContent([]byte(da))
+		if err != nil || len(ops) == 0 || ops[0].Operator != "Tf" {
+			t.Fatalf("Expected a font in %q", da)
+		}
+		font, _ := out.resolveDict(fonts[ops[0].Operands[0].(Name)])
+		if base, _ := font["BaseFont"].(Name); !strings.HasPrefix(string(base), string(name)) {
+			t.Errorf("Expected field %s to use its font. Was %v", name, font["BaseFont"])
+		}
+	}
+}
+
+func TestAppendOutlineDest(t *testing.T) {
+
+	// A rotated page with an offset media box and bookmarks to a
+	// position on it and to the current position.
+	src := readPdf(t, handmadePdf(
+		"<< /Type /Catalog /Pages 2 0 R /Outlines 4 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [10 20 310 220] /Rotate 90 >>",
+		"<< /Type /Outlines /First 5 0 R /Last 6 0 R /Count 2 >>",
+		"<< /Title (Position) /Parent 4 0 R /Next 6 0 R /Dest [3 0 R /XYZ 240 50 2] >>",
+		"<< /Title (Current) /Parent 4 0 R /Prev 5 0 R /Dest [3 0 R /XYZ null null null] >>",
+	))
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	if _, err := AppendPages(d, src, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := readPdf(t, b.Bytes())
+	page, _ := out.Page(0)
+	cat, _ := out.Catalog()
+	outlines, _ := out.resolveDict(cat["Outlines"])
+
+	expected := []Array{
+		{page.Ref(), Name("XYZ"), 240, 50, 2},
+		{page.Ref(), Name("XYZ"), nil, nil, nil},
+	}
+	o := outlines["First"]
+	for _, e := range expected {
+		item, _ := out.resolveDict(o)
+		dest, _ := item["Dest"].(Array)
+		if len(dest) != len(e) {
+			t.Errorf("Expected %v. Was %v", e, item["Dest"])
+		} else {
+			for ix := range e {
+				if dest[ix] != e[ix] {
+					t.Errorf("Expected %v. Was %v", e, dest)
+					break
+				}
+			}
+		}
+		o = item["Next"]
+	}
+}
@@ -0,0 +1,115 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"bytes"
+	"io"
+	"sort"
+
+	"github.com/adkennan/dox2go"
+)
+
+// pdfNames is the name dictionary of the document. It is
+// only added to the catalog once a name has been defined.
+type pdfNames struct {
+	id    int
+	dests map[string]*pdfDest
+	files map[string]*pdfFileSpec
+}
+
+func (c *pdfNames) Id() int {
+	return c.id
+}
+
+func (c *pdfNames) Type() string {
+	return "Names"
+}
+
+func (c *pdfNames) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(c, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	aw := arrayWriter{w, 0, nil}
+	dw.Start()
+	if len(c.dests) > 0 {
+		dw.Name("Dests")
+		dw.Start()
+		dw.Name("Names")
+		aw.Start()
+		names := make([]string, 0, len(c.dests))
+		for name := range c.dests {
+			names = append(names, name)
+		}
+		for _, name := range sortNames(names) {
+			aw.String(name)
+			c.dests[name].write(&aw)
+		}
+		aw.End()
+		dw.End()
+	}
+	if len(c.files) > 0 {
+		dw.Name("EmbeddedFiles")
+		dw.Start()
+		dw.Name("Names")
+		aw.Start()
+		names := make([]string, 0, len(c.files))
+		for name := range c.files {
+			names = append(names, name)
+		}
+		for _, name := range sortNames(names) {
+			aw.String(name)
+			aw.Ref(c.files[name])
+		}
+		aw.End()
+		dw.End()
+	}
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	if aw.err != nil {
+		return n, aw.err
+	}
+	n += dw.n + aw.n
+
+	n2, err := endObj(c, w)
+	n += int64(n2)
+	return n, err
+}
+
+// sortNames sorts the keys of a name tree in the order
+// required by PDF, which is the byte order of the strings
+// written for them.
+func sortNames(names []string) []string {
+	sort.Slice(names, func(i, j int) bool {
+		return bytes.Compare(stringBytes(names[i]), stringBytes(names[j])) < 0
+	})
+	return names
+}
+
+// names returns the name dictionary of the document, adding
+// it to the catalog if necessary.
+func (doc *pdfDoc) names() *pdfNames {
+	if doc.nameDict == nil {
+		doc.nameDict = &pdfNames{len(doc.objs) + 1, make(map[string]*pdfDest), make(map[string]*pdfFileSpec)}
+		doc.objs = append(doc.objs, doc.nameDict)
+		doc.catalog.objs = append(doc.catalog.objs, doc.nameDict)
+	}
+	return doc.nameDict
+}
+
+func (doc *pdfDoc) AddDestination(name string, p dox2go.Page, x, y float64) {
+	if page, ok := p.(*pdfPage); ok {
+		doc.names().dests[name] = xyzDest(page, x, y)
+	}
+}
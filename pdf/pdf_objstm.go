@@ -0,0 +1,269 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// objStmSize is the most objects packed into one object stream.
+const objStmSize = 100
+
+// ObjectStreams packs the objects of a document that are not
+// streams into compressed object streams and replaces the
+// cross-reference table with a compressed cross-reference stream.
+// This makes documents with many small objects considerably
+// smaller but they cannot be read by viewers older than PDF 1.5.
+func ObjectStreams() Option {
+	return func(doc *pdfDoc) {
+		doc.objStreams = true
+	}
+}
+
+// compressible reports whether an object may be stored in an
+// object stream. The encryption dictionary may not be and the
+// signature is filled in at a known offset once the document
+// has been written.
+func (doc *pdfDoc) compressible(o pdfObj) bool {
+	if o == pdfObj(doc.enc) {
+		return false
+	}
+	for _, s := range doc.sigs {
+		if o == pdfObj(s.v) {
+			return false
+		}
+	}
+	return true
+}
+
+// xrefEntry is an entry of a cross-reference stream. Type 1
+// entries give the offset of an object and type 2 entries the
+// object stream containing it and its index in the stream.
+type xrefEntry struct {
+	typ byte
+	f2  int64
+	f3  int
+}
+
+// writeCompressed writes the objects of the document, packing
+// those that are not streams into object streams, followed by a
+// cross-reference stream. It returns the offsets of the objects
+// written directly to the document.
+func (doc *pdfDoc) writeCompressed(cw *countingWriter, info *pdfInfo, id []byte) ([]int64, error) {
+
+	xrefs := make([]int64, len(doc.objs))
+	entries := make([]xrefEntry, len(doc.objs)+1, len(doc.objs)+16)
+	entries[0] = xrefEntry{0, 0, 0xFFFF}
+
+	streams := make([]*pdfObjStream, 0, len(doc.objs)/objStmSize+1)
+	var stm *pdfObjStream
+
+	b := new(bytes.Buffer)
+	for ix, o := range doc.objs {
+		if offset, written := doc.offsets[o.Id()]; written {
+			xrefs[ix] = offset
+			entries[o.Id()] = xrefEntry{1, offset, 0}
+			continue
+		}
+
+		// Streams are written straight to the document so that
+		// their data is not copied.
+		if s, ok := o.(pdfStreamObj); ok && s.hasStream() || !doc.compressible(o) {
+			xrefs[ix] = cw.n
+			entries[o.Id()] = xrefEntry{1, cw.n, 0}
+			_, err := o.WriteTo(doc.writerFor(cw, o))
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// The strings of objects in an object stream are only
+		// encrypted as part of the stream.
+		b.Reset()
+		_, err := o.WriteTo(b)
+		if err != nil {
+			return nil, err
+		}
+
+		if stm == nil || len(stm.ids) == objStmSize {
+			stm = &pdfObjStream{len(doc.objs) + len(streams) + 1, nil, nil, new(bytes.Buffer)}
+			streams = append(streams, stm)
+		}
+		entries[o.Id()] = xrefEntry{2, int64(stm.id), len(stm.ids)}
+
+		body := bytes.TrimPrefix(b.Bytes(), []byte(fmt.Sprintf("%d 0 obj\r\n", o.Id())))
+		body = bytes.TrimSuffix(body, []byte("endobj\r\n"))
+		stm.add(o.Id(), body)
+	}
+
+	for _, s := range streams {
+		entries = append(entries, xrefEntry{1, cw.n, 0})
+		_, err := s.WriteTo(doc.writerFor(cw, s))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The cross-reference stream is never encrypted.
+	offset := cw.n
+	xid := len(entries)
+	entries = append(entries, xrefEntry{1, offset, 0})
+
+	w2 := 1
+	for v := offset >> 8; v > 0; v >>= 8 {
+		w2++
+	}
+
+	var table bytes.Buffer
+	for _, e := range entries {
+		table.WriteByte(e.typ)
+		for ix := w2 - 1; ix >= 0; ix-- {
+			table.WriteByte(byte(e.f2 >> (8 * uint(ix))))
+		}
+		table.WriteByte(byte(e.f3 >> 8))
+		table.WriteByte(byte(e.f3))
+	}
+	data, err := deflate(table.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = fmt.Fprintf(cw, "%d 0 obj\r\n", xid)
+	if err != nil {
+		return nil, err
+	}
+
+	dw := dictionaryWriter{cw, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name("XRef")
+	dw.Name("Size")
+	dw.Value(len(entries))
+	dw.Name("W")
+	dw.Value(fmt.Sprintf("[1 %d 2]", w2))
+	dw.Name("Filter")
+	dw.Name("FlateDecode")
+	dw.Name("Length")
+	dw.Value(len(data))
+	doc.writeTrailer(&dw, info, id)
+	dw.End()
+
+	if dw.err != nil {
+		return nil, dw.err
+	}
+
+	_, err = fmt.Fprint(cw, "stream\r\n")
+	if err != nil {
+		return nil, err
+	}
+	_, err = cw.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	_, err = fmt.Fprint(cw, "\r\nendstream\r\nendobj\r\n")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = fmt.Fprintf(cw, "startxref\r\n%d\r\n%%%%EOF\r\n", offset)
+	return xrefs, err
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfObjStream is a compressed stream of objects.
+type pdfObjStream struct {
+	id      int
+	ids     []int
+	offsets []int
+	data    *bytes.Buffer
+}
+
+// add appends an object, without its obj and endobj keywords,
+// to the stream.
+func (s *pdfObjStream) add(id int, body []byte) {
+	s.ids = append(s.ids, id)
+	s.offsets = append(s.offsets, s.data.Len())
+	s.data.Write(body)
+}
+
+func (s *pdfObjStream) Id() int {
+	return s.id
+}
+
+func (s *pdfObjStream) Type() string {
+	return "ObjStm"
+}
+
+func (s *pdfObjStream) hasStream() bool {
+	return true
+}
+
+func (s *pdfObjStream) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(s, w)
+	if err != nil {
+		return 0, err
+	}
+
+	// The stream starts with the number and offset of each
+	// object.
+	var b bytes.Buffer
+	for ix, id := range s.ids {
+		fmt.Fprintf(&b, "%d %d ", id, s.offsets[ix])
+	}
+	first := b.Len()
+	b.Write(s.data.Bytes())
+
+	data, err := deflate(b.Bytes())
+	if err != nil {
+		return n, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(s.Type())
+	dw.Name("N")
+	dw.Value(len(s.ids))
+	dw.Name("First")
+	dw.Value(first)
+	dw.Name("Filter")
+	dw.Name("FlateDecode")
+	dw.Name("Length")
+	dw.Value(streamLength(w, len(data)))
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	n += dw.n
+
+	n2, err := startStream(w)
+	if err != nil {
+		return n, err
+	}
+	n += n2
+
+	n3, err := w.Write(data)
+	if err != nil {
+		return n, err
+	}
+	n += int64(n3)
+
+	n2, err = endStream(w)
+	if err != nil {
+		return n, err
+	}
+	n += n2
+	n2, err = endObj(s, w)
+	n += n2
+	return n, err
+}
@@ -0,0 +1,157 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/adkennan/dox2go"
+)
+
+var startXrefRe = regexp.MustCompile(`startxref\r\n(\d+)\r\n`)
+var xrefWidthsRe = regexp.MustCompile(`/W \[1 (\d) 2\]`)
+
+// inflateStream returns the decompressed data of the stream of
+// the object at offset.
+func inflateStream(t *testing.T, data []byte, offset int) []byte {
+	start := bytes.Index(data[offset:], []byte("stream\r\n")) + offset + 8
+	end := bytes.Index(data[start:], []byte("\r\nendstream")) + start
+	r, err := zlib.NewReader(bytes.NewReader(data[start:end]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestObjectStreams(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b, ObjectStreams())
+	for ix := 0; ix < 150; ix++ {
+		p := d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+		p.LinkURI(10, 10, 10, 10, "http://example.com")
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := b.Bytes()
+	if bytes.Contains(data, []byte("\r\nxref\r\n")) {
+		t.Errorf("Expected no cross-reference table.")
+	}
+
+	m := startXrefRe.FindSubmatch(data)
+	if m == nil {
+		t.Fatal("Expected startxref.")
+	}
+	offset, _ := strconv.Atoi(string(m[1]))
+	w := xrefWidthsRe.FindSubmatch(data[offset:])
+	if w == nil {
+		t.Fatal("Expected a cross-reference stream.")
+	}
+	w2 := int(w[1][0] - '0')
+
+	table := inflateStream(t, data, offset)
+	size := 1 + w2 + 2
+	if len(table)%size != 0 {
+		t.Fatalf("Expected whole entries. Was %d bytes", len(table))
+	}
+
+	streams := make(map[int]int)
+	compressed := 0
+	for id := 1; id < len(table)/size; id++ {
+		e := table[id*size : (id+1)*size]
+		f2 := 0
+		for _, c := range e[1 : 1+w2] {
+			f2 = f2<<8 | int(c)
+		}
+		switch e[0] {
+		case 1:
+			prefix := fmt.Sprintf("%d 0 obj\r\n", id)
+			if !bytes.HasPrefix(data[f2:], []byte(prefix)) {
+				t.Errorf("Expected object %d at offset %d.", id, f2)
+			}
+		case 2:
+			compressed++
+			streams[f2]++
+		default:
+			t.Errorf("Expected object %d to be in use. Was type %d", id, e[0])
+		}
+	}
+
+	if compressed < 300 {
+		t.Errorf("Expected the pages and links to be compressed. Was %d objects", compressed)
+	}
+	for id, count := range streams {
+		if count > objStmSize {
+			t.Errorf("Expected at most %d objects in stream %d. Was %d", objStmSize, id, count)
+		}
+	}
+}
+
+func TestObjectStreamsKeepStreams(t *testing.T) {
+
+	src := sourceDoc(t)
+
+	for _, opts := range [][]Option{
+		{ObjectStreams()},
+		{ObjectStreams(), SpillToDisk("", 16)},
+		{ObjectStreams(), Streaming()},
+	} {
+		var b bytes.Buffer
+		d := NewPdfDoc(&b, opts...)
+		d.AttachFile(dox2go.EmbeddedFile{Name: "a.txt", MimeType: "text/plain", Data: []byte("A")})
+		form, err := ImportPage(d, src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := d.CreatePage(dox2go.U_PT, 200, 200, dox2go.PO_Portrait)
+		p.Surface().Image(d.CreateImage(image.NewRGBA(image.Rect(0, 0, 100, 100))), 0, 0, 100, 100)
+		p.Surface().Image(form, 100, 100, 100, 100)
+		p.AddField(10, 150, 80, 20, dox2go.FormField{Type: dox2go.FT_Text, Name: "Name", Value: "A"})
+		if err := d.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r := readPdf(t, b.Bytes())
+		streams := 0
+		for id, e := range r.xref {
+			o, err := r.Object(Ref{id, 0})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := o.(*Stream); ok {
+				streams++
+				if e.typ != 1 {
+					t.Errorf("Expected stream %d to be written directly. Was type %d", id, e.typ)
+				}
+			}
+		}
+
+		// The content, image and its mask, form and its content,
+		// source image and mask, field appearance, embedded file
+		// and metadata are streams.
+		if streams < 10 {
+			t.Errorf("Expected at least 10 streams. Was %d", streams)
+		}
+		page, _ := r.Page(0)
+		if _, err := page.Operations(); err != nil {
+			t.Errorf("Expected the page's content to be read. Was %v", err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"io"
+
+	"github.com/adkennan/dox2go"
+)
+
+///////////////////////////////////////////////////////////
+
+type pdfOutlines struct {
+	id    int
+	items []*pdfOutlineItem
+}
+
+func (c *pdfOutlines) Id() int {
+	return c.id
+}
+
+func (p *pdfOutlines) Type() string {
+	return "Outlines"
+}
+
+func (c *pdfOutlines) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(c, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(c.Type())
+	if len(c.items) > 0 {
+		dw.Name("First")
+		dw.Ref(c.items[0])
+		dw.Name("Last")
+		dw.Ref(c.items[len(c.items)-1])
+	}
+	dw.Name("Count")
+	dw.Value(visibleItems(c.items))
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	n += dw.n
+
+	n2, err := endObj(c, w)
+	n += int64(n2)
+	return n, err
+}
+
+// visibleItems counts the items that are shown when the
+// list of items is shown. The children of open items are
+// shown and the children of closed items are hidden.
+func visibleItems(items []*pdfOutlineItem) int {
+	count := 0
+	for _, i := range items {
+		count++
+		if i.open {
+			count += visibleItems(i.items)
+		}
+	}
+	return count
+}
+
+// addOutlineItem creates a new outline item and appends it to
+// the children of parent.
+func addOutlineItem(doc *pdfDoc, parent pdfObj, items *[]*pdfOutlineItem,
+	title string, p dox2go.Page, x, y float64) *pdfOutlineItem {
+
+	var dest destination
+	if page, ok := p.(*pdfPage); ok {
+		dest = xyzDest(page, x, y)
+	}
+
+	i := &pdfOutlineItem{
+		len(doc.objs) + 1,
+		doc,
+		parent,
+		nil,
+		nil,
+		make([]*pdfOutlineItem, 0),
+		title,
+		dest,
+		true,
+		nil,
+		dox2go.FS_Regular,
+	}
+
+	if len(*items) > 0 {
+		last := (*items)[len(*items)-1]
+		last.next = i
+		i.prev = last
+	}
+	*items = append(*items, i)
+
+	doc.objs = append(doc.objs, i)
+
+	return i
+}
+
+func (doc *pdfDoc) AddBookmark(title string, p dox2go.Page, x, y float64) dox2go.Bookmark {
+	return addOutlineItem(doc, doc.outlines, &doc.outlines.items, title, p, x, y)
+}
+
+///////////////////////////////////////////////////////////
+
+type pdfOutlineItem struct {
+	id     int
+	doc    *pdfDoc
+	parent pdfObj
+	prev   *pdfOutlineItem
+	next   *pdfOutlineItem
+	items  []*pdfOutlineItem
+	title  string
+	dest   destination
+	open   bool
+	color  *dox2go.Color
+	fs     dox2go.FontStyle
+}
+
+func (i *pdfOutlineItem) Id() int {
+	return i.id
+}
+
+func (i *pdfOutlineItem) Type() string {
+	return "Outline"
+}
+
+func (i *pdfOutlineItem) AddBookmark(title string, p dox2go.Page, x, y float64) dox2go.Bookmark {
+	return addOutlineItem(i.doc, i, &i.items, title, p, x, y)
+}
+
+func (i *pdfOutlineItem) SetOpen(open bool) {
+	i.open = open
+}
+
+func (i *pdfOutlineItem) SetColor(c dox2go.Color) {
+	i.color = &c
+}
+
+func (i *pdfOutlineItem) SetStyle(fs dox2go.FontStyle) {
+	i.fs = fs
+}
+
+func (i *pdfOutlineItem) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(i, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	aw := arrayWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Title")
+	dw.String(i.title)
+	dw.Name("Parent")
+	dw.Ref(i.parent)
+	if i.prev != nil {
+		dw.Name("Prev")
+		dw.Ref(i.prev)
+	}
+	if i.next != nil {
+		dw.Name("Next")
+		dw.Ref(i.next)
+	}
+	if len(i.items) > 0 {
+		dw.Name("First")
+		dw.Ref(i.items[0])
+		dw.Name("Last")
+		dw.Ref(i.items[len(i.items)-1])
+
+		// Closed items have a negative count.
+		dw.Name("Count")
+		if i.open {
+			dw.Value(visibleItems(i.items))
+		} else {
+			dw.Value(-visibleItems(i.items))
+		}
+	}
+	if i.dest != nil {
+		dw.Name("Dest")
+		i.dest.write(&dw)
+	}
+	if i.color != nil {
+		dw.Name("C")
+		aw.Start()
+		aw.Value(float64(i.color.R) / 255.0)
+		aw.Value(" ")
+		aw.Value(float64(i.color.G) / 255.0)
+		aw.Value(" ")
+		aw.Value(float64(i.color.B) / 255.0)
+		aw.End()
+	}
+
+	// The flags are 1 for italic and 2 for bold.
+	flags := 0
+	if i.fs&dox2go.FS_Italic != 0 {
+		flags |= 1
+	}
+	if i.fs&dox2go.FS_Bold != 0 {
+		flags |= 2
+	}
+	if flags != 0 {
+		dw.Name("F")
+		dw.Value(flags)
+	}
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	if aw.err != nil {
+		return n, aw.err
+	}
+	n += dw.n + aw.n
+
+	n2, err := endObj(i, w)
+	n += int64(n2)
+	return n, err
+}
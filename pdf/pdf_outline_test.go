@@ -0,0 +1,101 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/adkennan/dox2go"
+)
+
+func TestOutline(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	p := d.CreatePage(dox2go.U_PT, 200, 100, dox2go.PO_Portrait)
+
+	// A
+	//   A1
+	//   A2 (closed)
+	//     A2a
+	//     A2b
+	// B
+	a := d.AddBookmark("A", p, 0, 100)
+	a.AddBookmark("A1", p, 0, 80)
+	a2 := a.AddBookmark("A2", p, 0, 60)
+	a2.SetOpen(false)
+	a2.AddBookmark("A2a", p, 0, 40)
+	a2.AddBookmark("A2b", p, 0, 20).SetStyle(dox2go.FS_Bold | dox2go.FS_Italic)
+	d.AddBookmark("B", p, 0, 0)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := readPdf(t, b.Bytes())
+	cat, _ := r.Catalog()
+	root, _ := cat["Outlines"].(Ref)
+	outlines, _ := r.resolveDict(root)
+	if outlines["Count"] != 4 {
+		t.Errorf("Expected 4 visible items. Was %v", outlines["Count"])
+	}
+
+	refs := make(map[string]Ref)
+	items := make(map[string]Dict)
+	var walk func(parent Ref, d Dict)
+	walk = func(parent Ref, d Dict) {
+		var prev Object
+		for o := d["First"]; o != nil; {
+			item, err := r.resolveDict(o)
+			if err != nil || item == nil {
+				t.Fatalf("Expected an outline item. Was %v", err)
+			}
+			title, _ := item["Title"].(String)
+			refs[string(title)] = o.(Ref)
+			items[string(title)] = item
+			if item["Parent"] != parent {
+				t.Errorf("Expected the parent of %s to be %v. Was %v", title, parent, item["Parent"])
+			}
+			if item["Prev"] != prev {
+				t.Errorf("Expected the previous item of %s to be %v. Was %v", title, prev, item["Prev"])
+			}
+			if item["Next"] == nil && d["Last"] != o {
+				t.Errorf("Expected %s to be the last item. Was %v", title, d["Last"])
+			}
+			walk(o.(Ref), item)
+			prev = o
+			o = item["Next"]
+		}
+	}
+	walk(root, outlines)
+
+	for _, title := range []string{"A", "A1", "A2", "A2a", "A2b", "B"} {
+		if items[title] == nil {
+			t.Fatalf("Expected an item named %s", title)
+		}
+	}
+	for title, first := range map[string]string{"A": "A1", "A2": "A2a"} {
+		if items[title]["First"] != refs[first] {
+			t.Errorf("Expected the first child of %s to be %s", title, first)
+		}
+	}
+
+	// Open items count their visible descendants and closed
+	// items the negative of the descendants that would be shown.
+	for title, count := range map[string]Object{"A": 2, "A2": -2, "A1": nil, "B": nil} {
+		if items[title]["Count"] != count {
+			t.Errorf("Expected %s to have a count of %v. Was %v", title, count, items[title]["Count"])
+		}
+	}
+
+	if items["A2b"]["F"] != 3 {
+		t.Errorf("Expected A2b to be bold and italic. Was %v", items["A2b"]["F"])
+	}
+	if dest, _ := items["A1"]["Dest"].(Array); len(dest) != 5 || dest[0] != (Ref{p.(*pdfPage).id, 0}) || dest[1] != Name("XYZ") {
+		t.Errorf("Expected A1 to lead to the page. Was %v", items["A1"]["Dest"])
+	}
+}
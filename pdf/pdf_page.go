@@ -20,8 +20,20 @@ type pdfPage struct {
 	po     dox2go.PageOrientation
 	pu     dox2go.PageUnit
 	parent pdfObj
+	doc    *pdfDoc
 	sfc    *pdfSurface
+	annots []pdfObj
 	c      *pdfContent
+	boxes  [4]*rect
+	rotate int
+
+	// The index of the page in the parent tree and the
+	// elements owning each marked content sequence.
+	structParents int
+	mcids         []*pdfStructElem
+
+	// The contents of a page appended from another document.
+	src *pdfPageSource
 }
 
 func (p *pdfPage) Id() int {
@@ -44,16 +56,7 @@ func (p *pdfPage) WriteTo(w io.Writer) (n int64, err error) {
 		return 0, err
 	}
 
-	var width float64
-	var height float64
-
-	if p.po == dox2go.PO_Portrait {
-		width = p.w
-		height = p.h
-	} else {
-		width = p.h
-		height = p.w
-	}
+	width, height := p.mediaSize()
 
 	dw := dictionaryWriter{w, 0, nil}
 	aw := arrayWriter{w, 0, nil}
@@ -63,37 +66,44 @@ func (p *pdfPage) WriteTo(w io.Writer) (n int64, err error) {
 	dw.Name(p.Type())
 	dw.Name("Parent")
 	dw.Ref(p.parent)
+	box := rect{0, 0, width, height}
+	if p.src != nil {
+		box = p.src.box
+	}
 	dw.Name("MediaBox")
-	aw.Start()
-	aw.Value(0)
-	aw.Value(" ")
-	aw.Value(0)
-	aw.Value(" ")
-	aw.Value(dox2go.ConvertUnit(width, p.pu, dox2go.U_PT))
-	aw.Value(" ")
-	aw.Value(dox2go.ConvertUnit(height, p.pu, dox2go.U_PT))
-	aw.End()
-	dw.Name("Contents")
-	dw.Ref(p.c)
-	dw.Name("Resources")
-	dw.Start()
-	dw.Name("Font")
-	dw.Start()
-	for _, f := range p.sfc.fonts {
-		dw.Value("/F")
-		dw.Value(f.Id())
-		dw.Value(" ")
-		dw.Ref(f)
+	box.write(&dw)
+	for ix, r := range p.boxes {
+		if r != nil {
+			dw.Name(boxNames[ix])
+			r.write(&dw)
+		}
 	}
-	dw.End()
-	dw.Name("XObject")
-	dw.Start()
-	for key, xo := range p.sfc.xobjs {
-		dw.Name(key)
-		dw.Ref(xo)
+	if rot := (p.rotation() + p.rotate) % 360; rot != 0 {
+		dw.Name("Rotate")
+		dw.Value(rot)
+	}
+	if p.src != nil {
+		p.src.write(&dw)
+	} else {
+		dw.Name("Contents")
+		dw.Ref(p.c)
+		dw.Name("Resources")
+		p.Surface().(*pdfSurface).writeResources(&dw)
+	}
+	if len(p.annots) > 0 {
+		dw.Name("Annots")
+		aw.Start()
+		for _, a := range p.annots {
+			aw.Ref(a)
+		}
+		aw.End()
+	}
+	if len(p.mcids) > 0 {
+		dw.Name("StructParents")
+		dw.Value(p.structParents)
+		dw.Name("Tabs")
+		dw.Name("S")
 	}
-	dw.End()
-	dw.End()
 	dw.End()
 
 	if dw.err != nil {
@@ -111,14 +121,77 @@ func (p *pdfPage) WriteTo(w io.Writer) (n int64, err error) {
 
 func (p *pdfPage) Surface() dox2go.Surface {
 	if p.sfc == nil {
-		p.sfc = &pdfSurface{
-			p.c.b,
-			p.pu,
-			false,
-			make([]*pdfTypeFace, 0, 4),
-			nil,
-			make(map[string]pdfObj),
+		if p.src != nil {
+			p.sfc = p.overlay()
+		} else {
+			p.sfc = newSurface(p.doc, p.c.b, p.pu)
+		}
+		p.sfc.page = p
+
+		// Drawing on a rotated page uses the coordinates of the
+		// page as it is displayed.
+		if m := p.base(); m != identity {
+			p.sfc.alterMatrix(m[0], m[1], m[2], m[3], m[4], m[5])
 		}
 	}
 	return p.sfc
 }
+
+var boxNames = [...]string{"CropBox", "BleedBox", "TrimBox", "ArtBox"}
+
+func (p *pdfPage) SetBox(b dox2go.PageBox, x, y, w, h float64) {
+	if b < 0 || int(b) >= len(boxNames) {
+		panic("Invalid Page Box")
+	}
+
+	m := p.base()
+	x1, y1 := m.transform(dox2go.ConvertUnit(x, p.pu, dox2go.U_PT),
+		dox2go.ConvertUnit(y, p.pu, dox2go.U_PT))
+	x2, y2 := m.transform(dox2go.ConvertUnit(x+w, p.pu, dox2go.U_PT),
+		dox2go.ConvertUnit(y+h, p.pu, dox2go.U_PT))
+	r := quad{x1, y1, x2, y2, x1, y1, x2, y2}.bounds()
+	p.boxes[b] = &r
+}
+
+// mediaSize returns the size of the page's media in points.
+func (p *pdfPage) mediaSize() (float64, float64) {
+	w := dox2go.ConvertUnit(p.w, p.pu, dox2go.U_PT)
+	h := dox2go.ConvertUnit(p.h, p.pu, dox2go.U_PT)
+	if p.po == dox2go.PO_Landscape {
+		return h, w
+	}
+	return w, h
+}
+
+// rotation returns the clockwise rotation of the page in degrees.
+func (p *pdfPage) rotation() int {
+	switch p.po {
+	case dox2go.PO_Rotate90:
+		return 90
+	case dox2go.PO_Rotate180:
+		return 180
+	case dox2go.PO_Rotate270:
+		return 270
+	}
+	return 0
+}
+
+// base returns the matrix that maps the coordinates of the page
+// as it is displayed to those of its media. The media of
+// appended pages may not start at 0, 0.
+func (p *pdfPage) base() matrix {
+	w, h := p.mediaSize()
+	m := identity
+	switch p.po {
+	case dox2go.PO_Rotate90:
+		m = matrix{0, 1, -1, 0, w, 0}
+	case dox2go.PO_Rotate180:
+		m = matrix{-1, 0, 0, -1, w, h}
+	case dox2go.PO_Rotate270:
+		m = matrix{0, -1, 1, 0, 0, h}
+	}
+	if p.src != nil {
+		m = m.multiply(matrix{1, 0, 0, 1, p.src.box[0], p.src.box[1]})
+	}
+	return m
+}
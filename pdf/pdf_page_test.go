@@ -0,0 +1,61 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"testing"
+
+	d2g "github.com/adkennan/dox2go"
+)
+
+func TestPageRotation(t *testing.T) {
+	var b bytes.Buffer
+
+	d := NewPdfDoc(&b)
+
+	for _, c := range []struct {
+		po       d2g.PageOrientation
+		rotation int
+		expected quad
+	}{
+		{d2g.PO_Portrait, 0, quad{10, 20, 40, 20, 40, 60, 10, 60}},
+		{d2g.PO_Rotate90, 90, quad{580, 10, 580, 40, 540, 40, 540, 10}},
+		{d2g.PO_Rotate180, 180, quad{590, 780, 560, 780, 560, 740, 590, 740}},
+		{d2g.PO_Rotate270, 270, quad{20, 790, 20, 760, 60, 760, 60, 790}},
+	} {
+		p := d.CreatePage(d2g.U_PT, 600, 800, c.po).(*pdfPage)
+		if p.rotation() != c.rotation {
+			t.Errorf("Expected rotation %d. Was %d", c.rotation, p.rotation())
+		}
+		checkQuad(t, p.pageQuad(10, 20, 30, 40), c.expected)
+	}
+}
+
+func TestPageBoxes(t *testing.T) {
+	var b bytes.Buffer
+
+	d := NewPdfDoc(&b)
+	p := d.CreatePage(d2g.U_PT, 600, 800, d2g.PO_Rotate90).(*pdfPage)
+	p.SetBox(d2g.PB_Trim, 10, 20, 30, 40)
+
+	r := p.boxes[d2g.PB_Trim]
+	if r == nil || *r != (rect{540, 10, 580, 40}) {
+		t.Errorf("Expected %v. Was %v", rect{540, 10, 580, 40}, r)
+	}
+	if p.boxes[d2g.PB_Crop] != nil {
+		t.Errorf("Expected no crop box. Was %v", p.boxes[d2g.PB_Crop])
+	}
+
+	d.Close()
+
+	for _, s := range []string{"/TrimBox", "/Rotate 90"} {
+		if !bytes.Contains(b.Bytes(), []byte(s)) {
+			t.Errorf("Expected the document to contain %s", s)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// PdfALevel is a level of conformance to the PDF/A standard
+// for archival documents.
+type PdfALevel int32
+
+// These are the supported conformance levels. PA_None writes
+// documents that do not claim conformance.
+const (
+	PA_None PdfALevel = iota
+	PA_2B
+	PA_3B
+)
+
+var (
+	ErrPdfAEncrypted   = errors.New("PDF/A documents cannot be encrypted")
+	ErrFontNotEmbedded = errors.New("PDF/A requires embedded fonts but the standard fonts are not embedded")
+	ErrAppearances     = errors.New("PDF/A does not allow viewers to regenerate the appearance of form fields")
+	ErrDeviceCMYK      = errors.New("PDF/A documents with an sRGB output intent cannot contain CMYK images")
+	ErrLayerPrinting   = errors.New("PDF/A cannot print a layer differently from how it is shown")
+)
+
+// PdfA makes a document conform to a level of the PDF/A standard.
+// The document's metadata identifies the level and an sRGB output
+// intent is added. Close returns an error if the document uses
+// features PDF/A does not allow, which include form fields with
+// text that cannot be drawn with the standard fonts, CMYK images
+// and layers that are printed differently from how they are
+// shown.
+func PdfA(level PdfALevel) Option {
+	return func(doc *pdfDoc) {
+		doc.pdfa = level
+	}
+}
+
+// part returns the part of the PDF/A standard a level belongs to.
+func (level PdfALevel) part() int {
+	switch level {
+	case PA_2B:
+		return 2
+	case PA_3B:
+		return 3
+	}
+	return 0
+}
+
+// checkPdfA returns an error describing the first use of a
+// feature the document's PDF/A level does not allow.
+func (doc *pdfDoc) checkPdfA() error {
+	if doc.form != nil && doc.form.needAppearances {
+		return ErrAppearances
+	}
+	for _, o := range doc.objs {
+		if i, ok := o.(*pdfImage); ok && i.deviceCMYK() {
+			return ErrDeviceCMYK
+		}
+	}
+
+	// The printed state of layers is only applied with the usage
+	// application dictionaries PDF/A does not allow.
+	if doc.ocProps != nil {
+		for _, l := range doc.ocProps.layers {
+			if l.printed != l.visible {
+				return fmt.Errorf("%w: %s", ErrLayerPrinting, l.name)
+			}
+		}
+	}
+	if doc.pdfa == PA_2B && len(doc.files) > 0 {
+		return ErrEmbeddedFile
+	}
+	for _, f := range doc.fonts {
+		return fmt.Errorf("%w: %s", ErrFontNotEmbedded, f.baseFont)
+	}
+	return nil
+}
+
+// checkOptions returns an error if the options the document
+// was created with cannot be used together.
+func (doc *pdfDoc) checkOptions() error {
+	if doc.pdfa != PA_None && doc.enc != nil {
+		return ErrPdfAEncrypted
+	}
+	return nil
+}
+
+// addOutputIntent adds an sRGB output intent to the catalog.
+func (doc *pdfDoc) addOutputIntent() {
+	profile := &pdfIccProfile{len(doc.objs) + 1, srgbProfile()}
+	intents := &pdfOutputIntents{len(doc.objs) + 2, profile}
+	doc.objs = append(doc.objs, profile, intents)
+	doc.catalog.objs = append(doc.catalog.objs, intents)
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfOutputIntents is the array of output intents of the
+// document, describing the color space it is intended to be
+// reproduced in.
+type pdfOutputIntents struct {
+	id      int
+	profile *pdfIccProfile
+}
+
+func (o *pdfOutputIntents) Id() int {
+	return o.id
+}
+
+func (o *pdfOutputIntents) Type() string {
+	return "OutputIntents"
+}
+
+func (o *pdfOutputIntents) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(o, w)
+	if err != nil {
+		return 0, err
+	}
+
+	aw := arrayWriter{w, 0, nil}
+	dw := dictionaryWriter{w, 0, nil}
+	aw.Start()
+	dw.Start()
+	dw.Name("Type")
+	dw.Name("OutputIntent")
+	dw.Name("S")
+	dw.Name("GTS_PDFA1")
+	dw.Name("OutputConditionIdentifier")
+	dw.String(srgbDescription)
+	dw.Name("Info")
+	dw.String(srgbDescription)
+	dw.Name("DestOutputProfile")
+	dw.Ref(o.profile)
+	dw.End()
+	aw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	if aw.err != nil {
+		return n, aw.err
+	}
+	n += dw.n + aw.n
+
+	n2, err := endObj(o, w)
+	n += int64(n2)
+	return n, err
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfIccProfile is an embedded ICC color profile.
+type pdfIccProfile struct {
+	id   int
+	data []byte
+}
+
+func (p *pdfIccProfile) Id() int {
+	return p.id
+}
+
+func (p *pdfIccProfile) Type() string {
+	return "ICCBased"
+}
+
+func (p *pdfIccProfile) hasStream() bool {
+	return true
+}
+
+func (p *pdfIccProfile) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(p, w)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := deflate(p.data)
+	if err != nil {
+		return n, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("N")
+	dw.Value(3)
+	dw.Name("Filter")
+	dw.Name("FlateDecode")
+	dw.Name("Length")
+	dw.Value(streamLength(w, len(data)))
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	n += dw.n
+
+	n2, err := startStream(w)
+	if err != nil {
+		return n, err
+	}
+	n += n2
+
+	n3, err := w.Write(data)
+	if err != nil {
+		return n, err
+	}
+	n += int64(n3)
+
+	n2, err = endStream(w)
+	if err != nil {
+		return n, err
+	}
+	n += n2
+	n2, err = endObj(p, w)
+	n += n2
+	return n, err
+}
@@ -0,0 +1,106 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/adkennan/dox2go"
+)
+
+func TestPdfA(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b, PdfA(PA_2B))
+	d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"<pdfaid:part>2</pdfaid:part>", "/OutputIntents", "/GTS_PDFA1", "/ID"} {
+		if !bytes.Contains(b.Bytes(), []byte(s)) {
+			t.Errorf("Expected the document to contain %s", s)
+		}
+	}
+}
+
+func TestPdfAFonts(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b, PdfA(PA_3B))
+	d.CreateFont(FONT_Helvetica, dox2go.FS_Bold, 12)
+	err := d.Close()
+	if !errors.Is(err, ErrFontNotEmbedded) {
+		t.Errorf("Expected %v. Was %v", ErrFontNotEmbedded, err)
+	}
+}
+
+func TestPdfAEncrypted(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b, PdfA(PA_2B), Encrypt(EA_AES128, "", "owner", PM_Print))
+	err := d.Close()
+	if err != ErrPdfAEncrypted {
+		t.Errorf("Expected %v. Was %v", ErrPdfAEncrypted, err)
+	}
+}
+
+func TestSrgbProfile(t *testing.T) {
+
+	p := srgbProfile()
+	size := binary.BigEndian.Uint32(p)
+	if int(size) != len(p) {
+		t.Errorf("Expected size %d. Was %d", len(p), size)
+	}
+	if string(p[36:40]) != "acsp" {
+		t.Errorf("Expected the profile signature acsp. Was %s", p[36:40])
+	}
+}
+
+func TestPdfAFeatures(t *testing.T) {
+
+	cmyk := image.NewCMYK(image.Rect(0, 0, 100, 100))
+	cmyk.Pix[0] = 0x80
+
+	for _, test := range []struct {
+		name     string
+		build    func(d dox2go.Document, p dox2go.Page)
+		expected error
+	}{
+		{"a CMYK image", func(d dox2go.Document, p dox2go.Page) {
+			p.Surface().Image(d.CreateImage(cmyk), 0, 0, 10, 10)
+		}, ErrDeviceCMYK},
+		{"an inline CMYK image", func(d dox2go.Document, p dox2go.Page) {
+			p.Surface().Image(d.CreateImage(image.NewCMYK(image.Rect(0, 0, 4, 4))), 0, 0, 10, 10)
+		}, ErrDeviceCMYK},
+		{"a color keyed CMYK image", func(d dox2go.Document, p dox2go.Page) {
+			i := d.CreateImage(cmyk)
+			i.(dox2go.ColorKeyed).SetColorKey(dox2go.RGB(0, 0, 0), dox2go.RGB(0, 0, 0))
+			p.Surface().Image(i, 0, 0, 10, 10)
+		}, nil},
+		{"a layer that is not printed", func(d dox2go.Document, p dox2go.Page) {
+			d.CreateLayer("Notes", true, false)
+		}, ErrLayerPrinting},
+		{"a hidden layer", func(d dox2go.Document, p dox2go.Page) {
+			d.CreateLayer("Notes", false, false)
+		}, nil},
+		{"a field needing appearances", func(d dox2go.Document, p dox2go.Page) {
+			p.AddField(10, 10, 50, 10, dox2go.FormField{Type: dox2go.FT_Text, Name: "Name", Value: "Zoë"})
+		}, ErrAppearances},
+	} {
+		var b bytes.Buffer
+		d := NewPdfDoc(&b, PdfA(PA_2B))
+		test.build(d, d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait))
+		if err := d.Close(); !errors.Is(err, test.expected) {
+			t.Errorf("Expected %v for %s. Was %v", test.expected, test.name, err)
+		}
+	}
+}
@@ -0,0 +1,806 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+)
+
+var (
+	ErrEncryptedInput = errors.New("Encrypted documents cannot be read")
+	ErrPageRange      = errors.New("Page number out of range")
+	ErrObjectCycle    = errors.New("Object refers to itself")
+)
+
+// Reader reads an existing PDF document. The whole document is
+// held in memory and objects are parsed as they are requested.
+type Reader struct {
+	b       []byte
+	xref    map[int]xrefEntry
+	trailer Dict
+	objs    map[int]Object
+	objStms map[int]*objStmData
+	reading map[int]bool
+	pages   []*ReadPage
+}
+
+// objStmData holds the decoded contents of an object stream and
+// the offsets of the objects within it.
+type objStmData struct {
+	data    []byte
+	offsets []int
+}
+
+// NewReader reads a document and its page tree. If the cross
+// reference table of the document is damaged it is rebuilt by
+// searching the document for objects.
+func NewReader(rd io.Reader) (*Reader, error) {
+
+	b, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	r := newReader(b)
+
+	err = r.readXrefs()
+	if err == nil {
+		err = r.readPages()
+	}
+	if err == ErrEncryptedInput {
+		return nil, err
+	}
+	if err != nil {
+		r.xref = make(map[int]xrefEntry)
+		r.objs = make(map[int]Object)
+		r.objStms = make(map[int]*objStmData)
+		r.trailer = nil
+		r.pages = nil
+		if err = r.rebuildXref(); err != nil {
+			return nil, err
+		}
+		if err = r.readPages(); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func newReader(b []byte) *Reader {
+	return &Reader{
+		b,
+		make(map[int]xrefEntry),
+		nil,
+		make(map[int]Object),
+		make(map[int]*objStmData),
+		make(map[int]bool),
+		nil,
+	}
+}
+
+// readPages finds the pages of the document.
+func (r *Reader) readPages() error {
+
+	if r.trailer["Encrypt"] != nil {
+		return ErrEncryptedInput
+	}
+
+	cat, err := r.Catalog()
+	if err != nil {
+		return err
+	}
+	return r.walkPages(cat["Pages"], Dict{}, make(map[Ref]bool))
+}
+
+// Trailer returns the trailer dictionary of the document.
+func (r *Reader) Trailer() Dict {
+	return r.trailer
+}
+
+// Catalog returns the root of the document's object hierarchy.
+func (r *Reader) Catalog() (Dict, error) {
+	cat, err := r.resolveDict(r.trailer["Root"])
+	if err == nil && cat == nil {
+		err = &ParseError{0, "Missing catalog"}
+	}
+	return cat, err
+}
+
+// NumPages returns the number of pages in the document.
+func (r *Reader) NumPages() int {
+	return len(r.pages)
+}
+
+// Page returns a page of the document. The first page is 0.
+func (r *Reader) Page(n int) (*ReadPage, error) {
+	if n < 0 || n >= len(r.pages) {
+		return nil, ErrPageRange
+	}
+	return r.pages[n], nil
+}
+
+// Object returns the indirect object with the given reference.
+// Objects that do not exist are null.
+func (r *Reader) Object(ref Ref) (Object, error) {
+
+	if o, ok := r.objs[ref.Id]; ok {
+		return o, nil
+	}
+
+	e, ok := r.xref[ref.Id]
+	if !ok || e.typ == 0 {
+		return nil, nil
+	}
+
+	if r.reading[ref.Id] {
+		return nil, ErrObjectCycle
+	}
+	r.reading[ref.Id] = true
+	defer delete(r.reading, ref.Id)
+
+	var o Object
+	var err error
+	if e.typ == 1 {
+		o, err = r.parseObject(e.f2)
+	} else {
+		o, err = r.objStmObject(int(e.f2), e.f3)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.objs[ref.Id] = o
+	return o, nil
+}
+
+// Resolve follows references until it reaches a direct object.
+func (r *Reader) Resolve(o Object) (Object, error) {
+	for i := 0; i < 32; i++ {
+		ref, ok := o.(Ref)
+		if !ok {
+			return o, nil
+		}
+		var err error
+		o, err = r.Object(ref)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, ErrObjectCycle
+}
+
+func (r *Reader) resolveDict(o Object) (Dict, error) {
+	o, err := r.Resolve(o)
+	if err != nil {
+		return nil, err
+	}
+	switch v := o.(type) {
+	case Dict:
+		return v, nil
+	case *Stream:
+		return v.Dict, nil
+	}
+	return nil, nil
+}
+
+func (r *Reader) resolveArray(o Object) (Array, error) {
+	o, err := r.Resolve(o)
+	if err != nil {
+		return nil, err
+	}
+	a, _ := o.(Array)
+	return a, nil
+}
+
+// Decode returns the data of a stream with its filters removed.
+func (r *Reader) Decode(s *Stream) ([]byte, error) {
+
+	filters, err := r.Resolve(s.Dict["Filter"])
+	if err != nil {
+		return nil, err
+	}
+	params, err := r.Resolve(s.Dict["DecodeParms"])
+	if err != nil {
+		return nil, err
+	}
+
+	var names Array
+	var paramList Array
+	if n, ok := filters.(Name); ok {
+		names = Array{n}
+		paramList = Array{params}
+	} else {
+		names, _ = filters.(Array)
+		paramList, _ = params.(Array)
+	}
+
+	data := s.Data
+	for ix, f := range names {
+		f, err := r.Resolve(f)
+		if err != nil {
+			return nil, err
+		}
+		var p Dict
+		if ix < len(paramList) {
+			if p, err = r.resolveDict(paramList[ix]); err != nil {
+				return nil, err
+			}
+		}
+		name, _ := f.(Name)
+		data, err = decodeFilter(name, p, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// parseObject parses the indirect object at offset.
+func (r *Reader) parseObject(offset int64) (Object, error) {
+
+	if offset < 0 || offset >= int64(len(r.b)) {
+		return nil, &ParseError{offset, "Invalid object offset"}
+	}
+
+	l := &lexer{r.b, int(offset)}
+	for i := 0; i < 3; i++ {
+		t, err := l.token()
+		if err != nil {
+			return nil, err
+		}
+		if _, isInt := t.(int); isInt != (i < 2) || (i == 2 && t != keyword("obj")) {
+			return nil, l.errorf("Expected object")
+		}
+	}
+
+	o, err := l.object()
+	if err != nil {
+		return nil, err
+	}
+
+	d, ok := o.(Dict)
+	if !ok {
+		return o, nil
+	}
+	start := l.streamStart()
+	if start < 0 {
+		return o, nil
+	}
+
+	length, err := r.Resolve(d["Length"])
+	if err != nil {
+		return nil, err
+	}
+
+	// Stream lengths are often wrong so the end of the data is
+	// searched for if it does not end at the expected place.
+	n, ok := length.(int)
+	end := start + n
+	if !ok || n < 0 || end > len(r.b) || !r.endsStream(end) {
+		ix := bytes.Index(r.b[start:], []byte("endstream"))
+		if ix < 0 {
+			return nil, &ParseError{int64(start), "Unterminated stream"}
+		}
+		end = start + ix
+		if end > start && r.b[end-1] == '\n' {
+			end--
+		}
+		if end > start && r.b[end-1] == '\r' {
+			end--
+		}
+	}
+
+	return &Stream{d, r.b[start:end]}, nil
+}
+
+// endsStream reports whether the endstream keyword is at offset.
+func (r *Reader) endsStream(offset int) bool {
+	l := &lexer{r.b, offset}
+	t, _ := l.token()
+	return t == keyword("endstream")
+}
+
+// objStmObject parses an object stored in an object stream.
+func (r *Reader) objStmObject(id, index int) (Object, error) {
+
+	stm := r.objStms[id]
+	if stm == nil {
+		o, err := r.Object(Ref{id, 0})
+		if err != nil {
+			return nil, err
+		}
+		s, ok := o.(*Stream)
+		if !ok {
+			return nil, &ParseError{0, "Missing object stream " + strconv.Itoa(id)}
+		}
+		data, err := r.Decode(s)
+		if err != nil {
+			return nil, err
+		}
+
+		n, _ := s.Dict["N"].(int)
+		first, _ := s.Dict["First"].(int)
+		if first < 0 || first > len(data) {
+			return nil, &ParseError{0, "Invalid object stream " + strconv.Itoa(id)}
+		}
+		l := &lexer{data, 0}
+		stm = &objStmData{data, nil}
+		for i := 0; i < n; i++ {
+			l.token()
+			t, err := l.token()
+			if err != nil {
+				return nil, err
+			}
+			offset, _ := t.(int)
+			stm.offsets = append(stm.offsets, first+offset)
+		}
+		r.objStms[id] = stm
+	}
+
+	if index < 0 || index >= len(stm.offsets) {
+		return nil, nil
+	}
+	if offset := stm.offsets[index]; offset < 0 || offset >= len(stm.data) {
+		return nil, &ParseError{int64(offset), "Invalid object offset in object stream " + strconv.Itoa(id)}
+	}
+	l := &lexer{stm.data, stm.offsets[index]}
+	return l.object()
+}
+
+// readXrefs reads the cross reference sections of the document,
+// starting with the last and following the Prev entries of each
+// trailer. Entries in later sections replace earlier ones.
+func (r *Reader) readXrefs() error {
+
+	ix := bytes.LastIndex(r.b, []byte("startxref"))
+	if ix < 0 {
+		return &ParseError{0, "Missing startxref"}
+	}
+	l := &lexer{r.b, ix + len("startxref")}
+	t, err := l.token()
+	if err != nil {
+		return err
+	}
+	offset, ok := t.(int)
+	if !ok {
+		return l.errorf("Expected cross reference offset")
+	}
+
+	seen := make(map[int]bool)
+	for !seen[offset] {
+		seen[offset] = true
+
+		trailer, err := r.readXref(offset)
+		if err != nil {
+			return err
+		}
+		if r.trailer == nil {
+			r.trailer = trailer
+		}
+
+		if offset, ok = trailer["Prev"].(int); !ok {
+			break
+		}
+	}
+	return nil
+}
+
+// readXref reads the cross reference table or stream at offset,
+// adding entries for objects not yet known. It returns the
+// trailer of the section.
+func (r *Reader) readXref(offset int) (Dict, error) {
+
+	if offset < 0 || offset >= len(r.b) {
+		return nil, &ParseError{int64(offset), "Invalid cross reference offset"}
+	}
+
+	l := &lexer{r.b, offset}
+	if t, _ := l.token(); t != keyword("xref") {
+		return r.readXrefStream(offset)
+	}
+
+	type tableEntry struct {
+		id int
+		e  xrefEntry
+	}
+	var entries []tableEntry
+
+	for {
+		t, err := l.token()
+		if err != nil {
+			return nil, err
+		}
+		if t == keyword("trailer") {
+			break
+		}
+		start, ok := t.(int)
+		if !ok {
+			return nil, l.errorf("Expected cross reference subsection")
+		}
+		t, err = l.token()
+		count, ok := t.(int)
+		if err != nil || !ok {
+			return nil, l.errorf("Expected cross reference subsection")
+		}
+		for i := 0; i < count; i++ {
+			off, err1 := l.token()
+			gen, err2 := l.token()
+			kind, err3 := l.token()
+			o, ok1 := off.(int)
+			g, ok2 := gen.(int)
+			if err1 != nil || err2 != nil || err3 != nil || !ok1 || !ok2 || o < 0 || g < 0 {
+				return nil, l.errorf("Invalid cross reference entry")
+			}
+			e := xrefEntry{0, 0, 0}
+			if kind == keyword("n") {
+				e = xrefEntry{1, int64(o), g}
+			}
+			entries = append(entries, tableEntry{start + i, e})
+		}
+	}
+
+	o, err := l.object()
+	if err != nil {
+		return nil, err
+	}
+	trailer, ok := o.(Dict)
+	if !ok {
+		return nil, l.errorf("Expected trailer")
+	}
+
+	// The objects of hybrid files that are only in the stream
+	// must not be hidden by the table.
+	if stm, ok := trailer["XRefStm"].(int); ok {
+		if _, err := r.readXrefStream(stm); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, te := range entries {
+		if _, known := r.xref[te.id]; !known {
+			r.xref[te.id] = te.e
+		}
+	}
+	return trailer, nil
+}
+
+// readXrefStream reads a cross reference stream at offset.
+func (r *Reader) readXrefStream(offset int) (Dict, error) {
+
+	o, err := r.parseObject(int64(offset))
+	if err != nil {
+		return nil, err
+	}
+	s, ok := o.(*Stream)
+	if !ok || s.Dict["Type"] != Name("XRef") {
+		return nil, &ParseError{int64(offset), "Expected cross reference stream"}
+	}
+
+	data, err := r.Decode(s)
+	if err != nil {
+		return nil, err
+	}
+
+	w, _ := s.Dict["W"].(Array)
+	if len(w) != 3 {
+		return nil, &ParseError{int64(offset), "Invalid cross reference stream widths"}
+	}
+	// Fields wider than 8 bytes do not fit in an int64.
+	var widths [3]int
+	rowLen := 0
+	for i := range widths {
+		width, ok := w[i].(int)
+		if !ok || width < 0 || width > 8 {
+			return nil, &ParseError{int64(offset), "Invalid cross reference stream widths"}
+		}
+		widths[i] = width
+		rowLen += width
+	}
+	if rowLen == 0 {
+		return nil, &ParseError{int64(offset), "Invalid cross reference stream widths"}
+	}
+
+	index, _ := s.Dict["Index"].(Array)
+	if index == nil {
+		size, _ := s.Dict["Size"].(int)
+		index = Array{0, size}
+	}
+
+	field := func(b []byte, def int64) int64 {
+		if len(b) == 0 {
+			return def
+		}
+		var v int64
+		for _, c := range b {
+			v = v<<8 | int64(c)
+		}
+		return v
+	}
+
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := index[i].(int)
+		count, _ := index[i+1].(int)
+		for j := 0; j < count && len(data) >= rowLen; j++ {
+			row := data[:rowLen]
+			data = data[rowLen:]
+
+			typ := field(row[:widths[0]], 1)
+			f2 := field(row[widths[0]:widths[0]+widths[1]], 0)
+			f3 := field(row[widths[0]+widths[1]:], 0)
+
+			id := start + j
+			if f2 < 0 || f3 < 0 || id < 0 {
+				return nil, &ParseError{int64(offset), "Invalid cross reference stream entry"}
+			}
+			if _, known := r.xref[id]; known {
+				continue
+			}
+			switch typ {
+			case 1, 2:
+				r.xref[id] = xrefEntry{byte(typ), f2, int(f3)}
+			default:
+				r.xref[id] = xrefEntry{0, 0, 0}
+			}
+		}
+	}
+
+	return s.Dict, nil
+}
+
+var objHeader = regexp.MustCompile(`(\d+)[\x00\t\n\f\r ]+(\d+)[\x00\t\n\f\r ]+obj`)
+
+// rebuildXref finds the objects of a document with a damaged
+// cross reference table by searching for them.
+func (r *Reader) rebuildXref() error {
+
+	var ids []int
+	for _, m := range objHeader.FindAllSubmatchIndex(r.b, -1) {
+		if m[0] > 0 && r.b[m[0]-1] >= '0' && r.b[m[0]-1] <= '9' {
+			continue
+		}
+		id, _ := strconv.Atoi(string(r.b[m[2]:m[3]]))
+		gen, _ := strconv.Atoi(string(r.b[m[4]:m[5]]))
+		r.xref[id] = xrefEntry{1, int64(m[0]), gen}
+		ids = append(ids, id)
+	}
+
+	// Objects in object streams and the trailer or catalog are
+	// found by looking at each object.
+	for _, id := range ids {
+		o, err := r.Object(Ref{id, 0})
+		if err != nil {
+			continue
+		}
+		s, ok := o.(*Stream)
+		if !ok {
+			if d, ok := o.(Dict); ok && d["Type"] == Name("Catalog") && r.trailer == nil {
+				r.trailer = Dict{"Root": Ref{id, 0}}
+			}
+			continue
+		}
+		switch s.Dict["Type"] {
+		case Name("XRef"):
+			if s.Dict["Root"] != nil {
+				r.trailer = s.Dict
+			}
+		case Name("ObjStm"):
+			n, _ := s.Dict["N"].(int)
+			data, err := r.Decode(s)
+			if err != nil {
+				continue
+			}
+			l := &lexer{data, 0}
+			for i := 0; i < n; i++ {
+				t, _ := l.token()
+				l.token()
+				if objId, ok := t.(int); ok {
+					if _, known := r.xref[objId]; !known {
+						r.xref[objId] = xrefEntry{2, int64(id), i}
+					}
+				}
+			}
+		}
+	}
+
+	if ix := bytes.LastIndex(r.b, []byte("trailer")); ix >= 0 {
+		l := &lexer{r.b, ix + len("trailer")}
+		if o, err := l.object(); err == nil {
+			if d, ok := o.(Dict); ok && d["Root"] != nil {
+				r.trailer = d
+			}
+		}
+	}
+
+	if r.trailer == nil {
+		return &ParseError{0, "Missing catalog"}
+	}
+	return nil
+}
+
+// These attributes of pages are inherited from the page tree.
+var inheritedAttrs = []Name{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// walkPages adds the pages below a node of the page tree.
+func (r *Reader) walkPages(o Object, inherited Dict, seen map[Ref]bool) error {
+
+	ref, isRef := o.(Ref)
+	if isRef {
+		if seen[ref] {
+			return ErrObjectCycle
+		}
+		seen[ref] = true
+	}
+
+	d, err := r.resolveDict(o)
+	if err != nil || d == nil {
+		return err
+	}
+
+	attrs := Dict{}
+	for _, k := range inheritedAttrs {
+		if v, ok := d[k]; ok {
+			attrs[k] = v
+		} else if v, ok := inherited[k]; ok {
+			attrs[k] = v
+		}
+	}
+
+	if d["Type"] == Name("Page") || d["Kids"] == nil {
+		r.pages = append(r.pages, &ReadPage{r, ref, d, attrs})
+		return nil
+	}
+
+	kids, err := r.resolveArray(d["Kids"])
+	if err != nil {
+		return err
+	}
+	for _, k := range kids {
+		if err = r.walkPages(k, attrs, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadPage is a page of a document that is read.
+type ReadPage struct {
+	r     *Reader
+	ref   Ref
+	dict  Dict
+	attrs Dict
+}
+
+// Ref returns the reference to the page object.
+func (p *ReadPage) Ref() Ref {
+	return p.ref
+}
+
+// Dict returns the page object.
+func (p *ReadPage) Dict() Dict {
+	return p.dict
+}
+
+// Attr returns an entry of the page object with references
+// resolved. Attributes the page inherits from the page tree
+// are included.
+func (p *ReadPage) Attr(key Name) (Object, error) {
+	if v, ok := p.attrs[key]; ok {
+		return p.r.Resolve(v)
+	}
+	return p.r.Resolve(p.dict[key])
+}
+
+// Resources returns the resource dictionary of the page.
+func (p *ReadPage) Resources() (Dict, error) {
+	o, err := p.Attr("Resources")
+	if err != nil {
+		return nil, err
+	}
+	d, _ := o.(Dict)
+	return d, nil
+}
+
+func (p *ReadPage) box(key Name) ([4]float64, bool) {
+	var box [4]float64
+	a, err := p.Attr(key)
+	if err != nil {
+		return box, false
+	}
+	arr, ok := a.(Array)
+	if !ok || len(arr) != 4 {
+		return box, false
+	}
+	for i, v := range arr {
+		v, _ = p.r.Resolve(v)
+		switch n := v.(type) {
+		case int:
+			box[i] = float64(n)
+		case float64:
+			box[i] = n
+		default:
+			return box, false
+		}
+	}
+	return box, true
+}
+
+// MediaBox returns the bounds of the page in points as
+// lower left x, y and upper right x, y. Pages without a
+// media box are US Letter.
+func (p *ReadPage) MediaBox() [4]float64 {
+	if box, ok := p.box("MediaBox"); ok {
+		return box
+	}
+	return [4]float64{0, 0, 612, 792}
+}
+
+// CropBox returns the visible bounds of the page, which are
+// its media box unless it has a crop box.
+func (p *ReadPage) CropBox() [4]float64 {
+	if box, ok := p.box("CropBox"); ok {
+		return box
+	}
+	return p.MediaBox()
+}
+
+// Rotate returns the number of degrees the page is rotated
+// clockwise when it is displayed.
+func (p *ReadPage) Rotate() int {
+	o, _ := p.Attr("Rotate")
+	r, _ := o.(int)
+	return ((r % 360) + 360) % 360
+}
+
+// Content returns the decoded content of the page. Pages with
+// several content streams have them joined together.
+func (p *ReadPage) Content() ([]byte, error) {
+
+	o, err := p.Attr("Contents")
+	if err != nil {
+		return nil, err
+	}
+
+	streams, ok := o.(Array)
+	if !ok {
+		streams = Array{o}
+	}
+
+	var content []byte
+	for _, s := range streams {
+		s, err := p.r.Resolve(s)
+		if err != nil {
+			return nil, err
+		}
+		stm, ok := s.(*Stream)
+		if !ok {
+			continue
+		}
+		data, err := p.r.Decode(stm)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, data...)
+		content = append(content, '\n')
+	}
+	return content, nil
+}
+
+// Operations returns the parsed content of the page.
+func (p *ReadPage) Operations() ([]Operation, error) {
+	content, err := p.Content()
+	if err != nil {
+		return nil, err
+	}
+	return ParseContent(content)
+}
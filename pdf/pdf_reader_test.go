@@ -0,0 +1,366 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/adkennan/dox2go"
+)
+
+// handmadePdf joins objects numbered from 1 into a document with a
+// cross reference table. The first object is the catalog.
+func handmadePdf(objs ...string) []byte {
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	var offsets []int
+	for ix, o := range objs {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", ix+1, o)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+	return b.Bytes()
+}
+
+func readPdf(t *testing.T, b []byte) *Reader {
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestReadOwnOutput(t *testing.T) {
+
+	for _, opts := range [][]Option{
+		nil,
+		{ObjectStreams()},
+		{Streaming()},
+	} {
+		var b bytes.Buffer
+		d := NewPdfDoc(&b, opts...)
+		f := d.CreateFont(FONT_Helvetica, dox2go.FS_Regular, 12)
+		d.CreatePage(dox2go.U_MM, 100, 50, dox2go.PO_Portrait).Surface().Text(f, 10, 10, "Hello")
+		d.CreatePage(dox2go.U_PT, 200, 100, dox2go.PO_Rotate90).Surface().Text(f, 10, 10, "World")
+		if err := d.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r := readPdf(t, b.Bytes())
+
+		cat, err := r.Catalog()
+		if err != nil || cat["Type"] != Name("Catalog") {
+			t.Errorf("Expected the catalog. Was %v %v", cat, err)
+		}
+
+		if r.NumPages() != 2 {
+			t.Fatalf("Expected 2 pages. Was %d", r.NumPages())
+		}
+
+		p, _ := r.Page(0)
+		if box := p.MediaBox(); math.Abs(box[2]-283.46) > 0.01 || math.Abs(box[3]-141.73) > 0.01 {
+			t.Errorf("Expected a 100mm by 50mm media box. Was %v", box)
+		}
+
+		ops, err := p.Operations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, op := range ops {
+			if op.Operator == "Tj" && string(op.Operands[0].(String)) == "Hello" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected the page to show Hello")
+		}
+
+		res, err := p.Resources()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fonts, _ := r.resolveDict(res["Font"]); len(fonts) != 1 {
+			t.Errorf("Expected 1 font. Was %v", fonts)
+		}
+
+		p, _ = r.Page(1)
+		if p.Rotate() != 90 {
+			t.Errorf("Expected the second page to be rotated 90 degrees. Was %d", p.Rotate())
+		}
+
+		if _, err = r.Page(2); err != ErrPageRange {
+			t.Errorf("Expected %v. Was %v", ErrPageRange, err)
+		}
+	}
+}
+
+func TestReadInheritedAttributes(t *testing.T) {
+
+	r := readPdf(t, handmadePdf(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /MediaBox [0 0 300 400] /Rotate 270 /Resources << /Font << >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 10 20] /Rotate -90 /Contents [5 0 R 6 0 R] >>",
+		"<< /Length 8 >>\nstream\n0 0 m S \nendstream",
+		"<< /Length 99 /Filter /ASCIIHexDecode >>\nstream\n512053>\nendstream",
+	))
+
+	p, _ := r.Page(0)
+	if p.MediaBox() != [4]float64{0, 0, 300, 400} || p.CropBox() != p.MediaBox() {
+		t.Errorf("Expected the inherited media box. Was %v", p.MediaBox())
+	}
+	if p.Rotate() != 270 {
+		t.Errorf("Expected 270. Was %d", p.Rotate())
+	}
+	if res, _ := p.Resources(); res == nil {
+		t.Errorf("Expected the inherited resources")
+	}
+
+	p, _ = r.Page(1)
+	if p.MediaBox() != [4]float64{0, 0, 10, 20} || p.Rotate() != 270 {
+		t.Errorf("Expected the page's own attributes. Was %v %d", p.MediaBox(), p.Rotate())
+	}
+
+	content, err := p.Content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "0 0 m S \nQ S\n" {
+		t.Errorf("Expected the joined content streams. Was %q", content)
+	}
+}
+
+func TestReadXrefStream(t *testing.T) {
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	var offsets []int
+	for ix, o := range []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R >>",
+	} {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj %s endobj\n", ix+1, o)
+	}
+	xref := b.Len()
+
+	// Rows of [type offset(2) gen] with the Up predictor.
+	rows := [][]byte{{0, 0, 0, 255}}
+	for _, offset := range append(offsets, xref) {
+		rows = append(rows, []byte{1, byte(offset >> 8), byte(offset), 0})
+	}
+	var data bytes.Buffer
+	zw := zlib.NewWriter(&data)
+	prev := make([]byte, 4)
+	for _, row := range rows {
+		zw.Write([]byte{2})
+		for i := range row {
+			zw.Write([]byte{row[i] - prev[i]})
+		}
+		prev = row
+	}
+	zw.Close()
+
+	fmt.Fprintf(&b, "4 0 obj << /Type /XRef /Size 5 /W [1 2 1] /Root 1 0 R /Filter /FlateDecode "+
+		"/DecodeParms << /Predictor 12 /Columns 4 >> /Length %d >>\nstream\n", data.Len())
+	b.Write(data.Bytes())
+	fmt.Fprintf(&b, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xref)
+
+	r := readPdf(t, b.Bytes())
+	if r.NumPages() != 1 {
+		t.Errorf("Expected 1 page. Was %d", r.NumPages())
+	}
+	if r.xref[3] != (xrefEntry{1, int64(offsets[2]), 0}) {
+		t.Errorf("Expected object 3 at %d. Was %v", offsets[2], r.xref[3])
+	}
+}
+
+func TestReadIncrementalUpdate(t *testing.T) {
+
+	b := handmadePdf(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Rotate 0 >>",
+	)
+	prev := bytes.LastIndex(b, []byte("xref"))
+
+	update := len(b)
+	b = append(b, "3 0 obj << /Type /Page /Parent 2 0 R /Rotate 180 >> endobj\n"...)
+	xref := len(b)
+	b = append(b, fmt.Sprintf("xref\n3 1\n%010d 00000 n \ntrailer\n<< /Size 4 /Root 1 0 R /Prev %d >>\nstartxref\n%d\n%%%%EOF\n",
+		update, prev, xref)...)
+
+	p, _ := readPdf(t, b).Page(0)
+	if p.Rotate() != 180 {
+		t.Errorf("Expected the updated page. Was rotated %d", p.Rotate())
+	}
+}
+
+func TestReadDamagedXref(t *testing.T) {
+
+	b := handmadePdf(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Rotate 90 >>",
+	)
+	// Move every object so that the table is wrong but can
+	// still be found.
+	b = bytes.Replace(b, []byte("%PDF-1.7\n"), []byte("%PDF-1.7\n%Padding\n"), 1)
+	ix := bytes.LastIndex(b, []byte("startxref"))
+	b = append(b[:ix], fmt.Sprintf("startxref\n%d\n%%%%EOF\n", bytes.LastIndex(b[:ix], []byte("xref\n")))...)
+
+	r := readPdf(t, b)
+	p, err := r.Page(0)
+	if err != nil || p.Rotate() != 90 {
+		t.Errorf("Expected the rebuilt document to have a rotated page. Was %v", err)
+	}
+}
+
+func TestReadEncrypted(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b, Encrypt(EA_AES128, "user", "owner", PM_All))
+	d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewReader(&b); err != ErrEncryptedInput {
+		t.Errorf("Expected %v. Was %v", ErrEncryptedInput, err)
+	}
+}
+
+// noPanic calls f, reporting a panic as a test failure.
+func noPanic(t *testing.T, name string, f func() error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			t.Errorf("Expected %s not to panic. Was %v", name, p)
+		}
+	}()
+	return f()
+}
+
+func TestReadMalformed(t *testing.T) {
+
+	valid := handmadePdf(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+	)
+	xref := bytes.Index(valid, []byte("\nxref\n")) + 1
+
+	xrefStream := func(w, row string) []byte {
+		return []byte(fmt.Sprintf("%%PDF-1.7\n1 0 obj << /Type /XRef /Size 2 /W %s /Length %d >>\nstream\n"+
+			"%s\nendstream\nendobj\nstartxref\n9\n%%%%EOF\n", w, len(row), row))
+	}
+	objStm := handmadePdf(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		"<< /Type /ObjStm /N 1 /First -50 /Length 7 >>\nstream\n4 0 << >>\nendstream",
+	)
+	outOfRange := bytes.Replace(objStm, []byte("/First -50"), []byte("/First 4  "), 1)
+	outOfRange = bytes.Replace(outOfRange, []byte("4 0 << >>"), []byte("4 99 << >"), 1)
+
+	for _, test := range []struct {
+		name  string
+		data  []byte
+		check func(r *Reader) error
+	}{
+		{"negative xref entry",
+			bytes.Replace(valid, valid[xref+29:xref+39], []byte("-000000005"), 1),
+			func(r *Reader) error { _, err := r.readXref(xref); return err }},
+		{"negative object offset", valid,
+			func(r *Reader) error { _, err := r.parseObject(-5); return err }},
+		{"object offset past the end", valid,
+			func(r *Reader) error { _, err := r.parseObject(int64(len(valid) + 10)); return err }},
+		{"negative xref stream width", xrefStream("[2 -1 1]", "\x01\x00\x09\x00"),
+			func(r *Reader) error { _, err := r.readXrefStream(9); return err }},
+		{"wide xref stream width", xrefStream("[1 9 0]", "\x01\x00\x09\x00"),
+			func(r *Reader) error { _, err := r.readXrefStream(9); return err }},
+		{"negative xref stream offset", xrefStream("[1 8 0]", "\x01\xff\xff\xff\xff\xff\xff\xff\xfb"),
+			func(r *Reader) error { _, err := r.readXrefStream(9); return err }},
+		{"negative object stream first", objStm,
+			func(r *Reader) error {
+				if err := r.readXrefs(); err != nil {
+					return nil
+				}
+				_, err := r.objStmObject(3, 0)
+				return err
+			}},
+		{"object stream offset past the end", outOfRange,
+			func(r *Reader) error {
+				if err := r.readXrefs(); err != nil {
+					return nil
+				}
+				_, err := r.objStmObject(3, 0)
+				return err
+			}},
+		{"negative predictor columns", []byte("\x02\x01\x02"),
+			func(r *Reader) error {
+				_, err := unpredict(Dict{"Predictor": 12, "Columns": -5}, r.b)
+				return err
+			}},
+		{"huge predictor columns", []byte("\x02\x01\x02"),
+			func(r *Reader) error {
+				_, err := unpredict(Dict{"Predictor": 12, "Colors": 1 << 30, "Columns": 1 << 30}, r.b)
+				return err
+			}},
+		{"deeply nested arrays", bytes.Repeat([]byte("["), 100000),
+			func(r *Reader) error { _, err := (&lexer{r.b, 0}).object(); return err }},
+		{"deeply nested dictionaries", bytes.Repeat([]byte("<< /A "), 100000),
+			func(r *Reader) error { _, err := (&lexer{r.b, 0}).object(); return err }},
+	} {
+		err := noPanic(t, test.name, func() error { return test.check(newReader(test.data)) })
+		if err == nil {
+			t.Errorf("Expected an error for %s", test.name)
+		}
+
+		// Whatever is wrong, reading the whole document must not
+		// panic either.
+		noPanic(t, test.name, func() error {
+			_, err := NewReader(bytes.NewReader(test.data))
+			return err
+		})
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b, ObjectStreams())
+	f := d.CreateFont(FONT_Helvetica, dox2go.FS_Regular, 12)
+	d.CreatePage(dox2go.U_PT, 200, 100, dox2go.PO_Portrait).Surface().Text(f, 10, 10, "Hello")
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 0; n < b.Len(); n += 7 {
+		noPanic(t, fmt.Sprintf("a document cut at %d", n), func() error {
+			r, err := NewReader(bytes.NewReader(b.Bytes()[:n]))
+			if err != nil {
+				return err
+			}
+			for ix := 0; ix < r.NumPages(); ix++ {
+				if p, err := r.Page(ix); err == nil {
+					p.Operations()
+				}
+			}
+			return nil
+		})
+	}
+}
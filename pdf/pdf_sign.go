@@ -0,0 +1,365 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/adkennan/dox2go"
+)
+
+// Signature flags of the interactive form dictionary.
+const (
+	sigFlagsSignaturesExist = 1 << 0
+	sigFlagsAppendOnly      = 1 << 1
+)
+
+// signatureReserve is the space reserved for the signature in
+// addition to the certificates it contains.
+const signatureReserve = 4096
+
+var (
+	ErrSignedTwice       = errors.New("A document can only be signed once")
+	ErrSignaturePage     = errors.New("A signature can only be added to a page of the document")
+	ErrNoCertificate     = errors.New("A signature requires a signer and certificate")
+	ErrUnsupportedKey    = errors.New("Signing keys must be RSA or ECDSA keys")
+	ErrSignatureTooLarge = errors.New("The signature is larger than the space reserved for it")
+)
+
+func (doc *pdfDoc) Sign(p dox2go.Page, x, y, w, h float64, s dox2go.Signature) dox2go.Surface {
+
+	// The signature covers the whole document, which cannot be
+	// known once pages have been written.
+	if doc.streaming {
+		return doc.discard(ErrStreamingSigned)
+	}
+	if len(doc.sigs) > 0 {
+		return doc.discard(ErrSignedTwice)
+	}
+	page, ok := p.(*pdfPage)
+	if !ok || page.doc != doc {
+		return doc.discard(ErrSignaturePage)
+	}
+
+	af := doc.acroForm()
+	af.sigFlags = sigFlagsSignaturesExist | sigFlagsAppendOnly
+
+	reserve := signatureReserve
+	for _, c := range s.Chain {
+		reserve += len(c.Raw)
+	}
+
+	v := &pdfSigValue{len(doc.objs) + 1, s, reserve, 0, 0}
+	doc.objs = append(doc.objs, v)
+
+	fld := &pdfSigField{
+		len(doc.objs) + 1,
+		page,
+		fmt.Sprintf("Signature%d", len(doc.sigs)+1),
+		page.pageQuad(x, y, w, h).bounds(),
+		nil,
+		v,
+	}
+	af.fields = append(af.fields, fld)
+	page.addAnnot(fld)
+	doc.sigs = append(doc.sigs, fld)
+
+	fld.ap = doc.newFormXObj(page.pu,
+		dox2go.ConvertUnit(fld.r[2]-fld.r[0], dox2go.U_PT, page.pu),
+		dox2go.ConvertUnit(fld.r[3]-fld.r[1], dox2go.U_PT, page.pu))
+
+	return fld.ap.sfc
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfSigField is a signature field combined with the widget
+// annotation that shows its appearance.
+type pdfSigField struct {
+	id   int
+	page *pdfPage
+	name string
+	r    rect
+	ap   *pdfFormXObj
+	v    *pdfSigValue
+}
+
+func (f *pdfSigField) Id() int {
+	return f.id
+}
+
+func (f *pdfSigField) Type() string {
+	return "Annot"
+}
+
+func (f *pdfSigField) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(f, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(f.Type())
+	dw.Name("Subtype")
+	dw.Name("Widget")
+	dw.Name("Rect")
+	f.r.write(&dw)
+	dw.Name("P")
+	dw.Ref(f.page)
+	dw.Name("F")
+	dw.Value(4)
+	dw.Name("AP")
+	dw.Start()
+	dw.Name("N")
+	dw.Ref(f.ap)
+	dw.End()
+	dw.Name("FT")
+	dw.Name("Sig")
+	dw.Name("T")
+	dw.String(f.name)
+	dw.Name("V")
+	dw.Ref(f.v)
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	n += dw.n
+
+	n2, err := endObj(f, w)
+	n += int64(n2)
+	return n, err
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfSigValue is the signature dictionary. It is written with
+// placeholders for the byte range and signature which are filled
+// in once the whole document has been written.
+type pdfSigValue struct {
+	id             int
+	sig            dox2go.Signature
+	reserve        int
+	rangeOffset    int64
+	contentsOffset int64
+}
+
+func (v *pdfSigValue) Id() int {
+	return v.id
+}
+
+func (v *pdfSigValue) Type() string {
+	return "Sig"
+}
+
+func byteRange(start, end, length int64) string {
+	return fmt.Sprintf("[0 %010d %010d %010d]", start, end, length-end)
+}
+
+func (v *pdfSigValue) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(v, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(v.Type())
+	dw.Name("Filter")
+	dw.Name("Adobe.PPKLite")
+	dw.Name("SubFilter")
+	dw.Name("adbe.pkcs7.detached")
+
+	// The offsets of the placeholders are relative to the
+	// start of the object. The signature is never encrypted.
+	dw.Name("ByteRange")
+	v.rangeOffset = n + dw.n
+	dw.Value(byteRange(0, 0, 0))
+	dw.Name("Contents")
+	v.contentsOffset = n + dw.n
+	dw.Value("<" + string(bytes.Repeat([]byte{'0'}, v.reserve*2)) + ">")
+
+	dw.Name("M")
+	dw.String(pdfDate(v.sig.Time))
+	if v.sig.Name != "" {
+		dw.Name("Name")
+		dw.String(v.sig.Name)
+	}
+	if v.sig.Reason != "" {
+		dw.Name("Reason")
+		dw.String(v.sig.Reason)
+	}
+	if v.sig.Location != "" {
+		dw.Name("Location")
+		dw.String(v.sig.Location)
+	}
+	if v.sig.ContactInfo != "" {
+		dw.Name("ContactInfo")
+		dw.String(v.sig.ContactInfo)
+	}
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	n += dw.n
+
+	n2, err := endObj(v, w)
+	n += int64(n2)
+	return n, err
+}
+
+// sign fills in the byte range and signature of the written
+// document. offset is the position of the signature dictionary
+// in the document.
+func (v *pdfSigValue) sign(data []byte, offset int64) error {
+
+	start := offset + v.contentsOffset
+	end := start + int64(v.reserve*2+2)
+	copy(data[offset+v.rangeOffset:], byteRange(start, end, int64(len(data))))
+
+	h := sha256.New()
+	h.Write(data[:start])
+	h.Write(data[end:])
+
+	cms, err := signCMS(v.sig, h.Sum(nil))
+	if err != nil {
+		return err
+	}
+	if len(cms) > v.reserve {
+		return ErrSignatureTooLarge
+	}
+
+	hex.Encode(data[start+1:], cms)
+	return nil
+}
+
+///////////////////////////////////////////////////////////
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSA           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSASHA256   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// derElement encodes the concatenated contents as a DER element
+// with the given tag.
+func derElement(tag byte, contents ...[]byte) []byte {
+	l := 0
+	for _, c := range contents {
+		l += len(c)
+	}
+
+	b := []byte{tag}
+	if l < 0x80 {
+		b = append(b, byte(l))
+	} else {
+		lb := make([]byte, 0, 4)
+		for v := l; v > 0; v >>= 8 {
+			lb = append([]byte{byte(v)}, lb...)
+		}
+		b = append(b, 0x80|byte(len(lb)))
+		b = append(b, lb...)
+	}
+
+	for _, c := range contents {
+		b = append(b, c...)
+	}
+	return b
+}
+
+// derSet encodes a SET OF, sorting the elements as DER requires.
+func derSet(elems ...[]byte) []byte {
+	sort.Slice(elems, func(i, j int) bool {
+		return bytes.Compare(elems[i], elems[j]) < 0
+	})
+	return derElement(0x31, elems...)
+}
+
+// derValue encodes a simple value. The values encoded are always
+// valid so errors are ignored.
+func derValue(val interface{}) []byte {
+	b, _ := asn1.Marshal(val)
+	return b
+}
+
+// signCMS creates a detached CMS signature of the SHA-256
+// digest of the signed content.
+func signCMS(s dox2go.Signature, digest []byte) ([]byte, error) {
+
+	if s.Signer == nil || len(s.Chain) == 0 {
+		return nil, ErrNoCertificate
+	}
+	cert := s.Chain[0]
+
+	var sigAlg []byte
+	switch s.Signer.Public().(type) {
+	case *rsa.PublicKey:
+		sigAlg = derElement(0x30, derValue(oidRSA), derValue(asn1.NullRawValue))
+	case *ecdsa.PublicKey:
+		sigAlg = derElement(0x30, derValue(oidECDSASHA256))
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	digestAlg := derElement(0x30, derValue(oidSHA256))
+
+	// The signed attributes are signed as a SET OF but stored
+	// with an implicit context specific tag.
+	attrs := derSet(
+		derElement(0x30, derValue(oidContentType), derSet(derValue(oidData))),
+		derElement(0x30, derValue(oidSigningTime), derSet(derValue(s.Time.UTC()))),
+		derElement(0x30, derValue(oidMessageDigest), derSet(derValue(digest))))
+
+	h := sha256.Sum256(attrs)
+	sig, err := s.Signer.Sign(rand.Reader, h[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	attrs[0] = 0xA0
+
+	signerInfo := derElement(0x30,
+		derValue(1),
+		derElement(0x30, cert.RawIssuer, derValue(cert.SerialNumber)),
+		digestAlg,
+		attrs,
+		sigAlg,
+		derValue(sig))
+
+	certs := make([][]byte, len(s.Chain))
+	for ix, c := range s.Chain {
+		certs[ix] = c.Raw
+	}
+
+	signedData := derElement(0x30,
+		derValue(1),
+		derSet(digestAlg),
+		derElement(0x30, derValue(oidData)),
+		derElement(0xA0, certs...),
+		derSet(signerInfo))
+
+	return derElement(0x30, derValue(oidSignedData), derElement(0xA0, signedData)), nil
+}
@@ -0,0 +1,208 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/adkennan/dox2go"
+)
+
+func selfSignedCert(t *testing.T, key crypto.Signer) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "dox2go test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     cmsSignedData `asn1:"explicit,tag:0"`
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue   `asn1:"tag:0"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	Sid                asn1.RawValue
+	DigestAlgorithm    asn1.RawValue
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm asn1.RawValue
+	Signature          []byte
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+var byteRangeRe = regexp.MustCompile(`/ByteRange \[0 (\d+) (\d+) (\d+)\]`)
+
+func checkSignedDoc(t *testing.T, key crypto.Signer, alg x509.SignatureAlgorithm, opts ...Option) {
+
+	cert := selfSignedCert(t, key)
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b, opts...)
+	p := d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+	s := d.Sign(p, 10, 10, 40, 20, dox2go.Signature{
+		Signer: key,
+		Chain:  []*x509.Certificate{cert},
+		Name:   "Tester",
+		Reason: "Testing",
+	})
+	s.Text(d.CreateFont(FONT_Helvetica, dox2go.FS_Regular, 4), 2, 2, "Tester")
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := b.Bytes()
+	m := byteRangeRe.FindSubmatch(data)
+	if m == nil {
+		t.Fatal("Expected a byte range.")
+	}
+	start, _ := strconv.Atoi(string(m[1]))
+	end, _ := strconv.Atoi(string(m[2]))
+	length, _ := strconv.Atoi(string(m[3]))
+	if end+length != len(data) {
+		t.Errorf("Expected the byte range to cover the document. Was %d of %d", end+length, len(data))
+	}
+	if data[start] != '<' || data[end-1] != '>' {
+		t.Fatal("Expected the byte range to exclude the signature.")
+	}
+
+	der, err := hex.DecodeString(string(data[start+1 : end-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ci cmsContentInfo
+	if _, err = asn1.Unmarshal(der, &ci); err != nil {
+		t.Fatal(err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) || len(ci.Content.SignerInfos) != 1 {
+		t.Fatal("Expected signed data with one signer.")
+	}
+
+	si := ci.Content.SignerInfos[0]
+	var attrs []cmsAttribute
+	if _, err = asn1.UnmarshalWithParams(si.SignedAttrs.FullBytes, &attrs, "tag:0,set"); err != nil {
+		t.Fatal(err)
+	}
+
+	h := sha256.New()
+	h.Write(data[:start])
+	h.Write(data[end:])
+	for _, a := range attrs {
+		if a.Type.Equal(oidMessageDigest) {
+			var digest []byte
+			asn1.Unmarshal(a.Values.Bytes, &digest)
+			if !bytes.Equal(digest, h.Sum(nil)) {
+				t.Errorf("Expected the message digest to match the document.")
+			}
+		}
+	}
+
+	signed := append([]byte{}, si.SignedAttrs.FullBytes...)
+	signed[0] = 0x31
+	if err = cert.CheckSignature(alg, signed, si.Signature); err != nil {
+		t.Errorf("Expected a valid signature. Was %v", err)
+	}
+}
+
+func TestSignECDSA(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	checkSignedDoc(t, key, x509.ECDSAWithSHA256)
+}
+
+func TestSignRSA(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	checkSignedDoc(t, key, x509.SHA256WithRSA)
+}
+
+func TestSignObjectStreams(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	checkSignedDoc(t, key, x509.ECDSAWithSHA256, ObjectStreams())
+}
+
+func TestSignTwice(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	sig := dox2go.Signature{Signer: key, Chain: []*x509.Certificate{selfSignedCert(t, key)}}
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	p := d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+	d.Sign(p, 0, 0, 0, 0, sig)
+	d.Sign(p, 0, 0, 0, 0, sig)
+	if n := len(d.(*pdfDoc).sigs); n != 1 {
+		t.Errorf("Expected the second signature to be refused. Was %d signatures", n)
+	}
+	if err := d.Close(); err != ErrSignedTwice {
+		t.Errorf("Expected %v. Was %v", ErrSignedTwice, err)
+	}
+}
+
+func TestSignOtherPage(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	sig := dox2go.Signature{Signer: key, Chain: []*x509.Certificate{selfSignedCert(t, key)}}
+
+	other := NewPdfDoc(ioutil.Discard).CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+	for _, p := range []dox2go.Page{other, nil} {
+		d.Sign(p, 0, 0, 10, 10, sig).Translate(1, 1)
+	}
+	if n := len(d.(*pdfDoc).sigs); n != 0 {
+		t.Errorf("Expected the signatures to be refused. Was %d signatures", n)
+	}
+	if err := d.Close(); err != ErrSignaturePage {
+		t.Errorf("Expected %v. Was %v", ErrSignaturePage, err)
+	}
+}
+
+func TestDerElement(t *testing.T) {
+	v := fmt.Sprintf("%X", derElement(0x04, make([]byte, 200))[:3])
+	if v != "0481C8" {
+		t.Errorf("Expected 0481C8. Was %s", v)
+	}
+}
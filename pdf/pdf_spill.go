@@ -0,0 +1,83 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"bytes"
+
+	"github.com/adkennan/dox2go"
+)
+
+// SpillToDisk keeps the content of pages and the images drawn
+// on them in temporary files in dir once they grow beyond
+// threshold bytes. If dir is empty the default directory for
+// temporary files is used. The files are removed when the
+// document is closed.
+//
+// Images are encoded when they are first drawn, so their pixels
+// and color key cannot be changed after that.
+func SpillToDisk(dir string, threshold int) Option {
+	return func(doc *pdfDoc) {
+		doc.pool = newBufferPool(dox2go.NewSpillingBufferPool(dir, threshold))
+		doc.spill = true
+	}
+}
+
+// sizedBuffer is a buffer from the document's pool. The buffers
+// of the pool also report how many bytes they hold, which
+// dox2go.Buffer leaves out so that other implementations of it
+// are not broken.
+type sizedBuffer interface {
+	dox2go.Buffer
+	Len() int
+}
+
+// getBuffer returns a buffer of a category from the document's
+// pool.
+func (doc *pdfDoc) getBuffer(category int) sizedBuffer {
+	return doc.pool.GetBuffer(category).(sizedBuffer)
+}
+
+// newBufferPool adds the categories of buffer used by documents
+// to a pool.
+func newBufferPool(bp *dox2go.BufferPool) *dox2go.BufferPool {
+	bp.CreateCategory(smallBuf, smallBufSize)
+	bp.CreateCategory(largeBuf, largeBufSize)
+	bp.CreateCategory(contentBuf, contentBufSize)
+	return bp
+}
+
+// spillImage encodes an image and its soft mask into buffers
+// from the document's pool and releases its pixels.
+func (doc *pdfDoc) spillImage(i *pdfImage) {
+
+	if i.encoded != nil || doc.err != nil {
+		return
+	}
+	doc.addMask(i)
+
+	b := doc.getBuffer(largeBuf)
+	sf, bilevel, err := i.encode(b)
+	if err != nil {
+		doc.err = err
+		return
+	}
+	i.encoded = &encodedImage{sf, bilevel, b}
+
+	if i.mask != nil {
+		m := doc.getBuffer(largeBuf)
+		if err = deflateTo(m, i.mask.content.Bytes()); err != nil {
+			doc.err = err
+			return
+		}
+		i.mask.data = m
+		i.mask.content = bytes.Buffer{}
+	}
+
+	i.src = emptyImage{i.src.Bounds()}
+}
@@ -0,0 +1,94 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/adkennan/dox2go"
+)
+
+func spilledDoc(t *testing.T, dir string, opts ...Option) (dox2go.Document, *bytes.Buffer) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b, append(opts, SpillToDisk(dir, 64))...)
+	f := d.CreateFont(FONT_Helvetica, dox2go.FS_Regular, 12)
+
+	src := image.NewNRGBA(image.Rect(0, 0, 50, 50))
+	for i := range src.Pix {
+		src.Pix[i] = byte(i)
+	}
+	img := d.CreateImage(src)
+
+	for i := 0; i < 3; i++ {
+		s := d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait).Surface()
+		s.Text(f, 10, 90, strings.Repeat("Spilled ", 20))
+		s.Image(img, 10, 10, 20, 20)
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) == 0 {
+		t.Errorf("Expected page content and images to be spilled to disk")
+	}
+
+	return d, &b
+}
+
+func TestSpillToDisk(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "dox2go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, opts := range [][]Option{
+		nil,
+		{Streaming()},
+		{ObjectStreams()},
+	} {
+		d, b := spilledDoc(t, dir, opts...)
+		if err := d.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+			t.Errorf("Expected the spilled files to be removed. Was %d files", len(files))
+		}
+
+		if n := bytes.Count(b.Bytes(), []byte("Spilled")); n != 60 {
+			t.Errorf("Expected the content of 3 pages. Was %d words", n)
+		}
+		if n := bytes.Count(b.Bytes(), []byte("/Subtype  /Image")); n != 2 {
+			t.Errorf("Expected the image and its mask. Was %d", n)
+		}
+
+		checkOffsets(t, b.Bytes())
+	}
+}
+
+func TestSpillToDiskError(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "dox2go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, _ := spilledDoc(t, dir, PdfA(PA_2B), Encrypt(EA_AES128, "user", "owner", PM_All))
+	if err := d.Close(); err != ErrPdfAEncrypted {
+		t.Errorf("Expected %v. Was %v", ErrPdfAEncrypted, err)
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected the spilled files to be removed. Was %d files", len(files))
+	}
+}
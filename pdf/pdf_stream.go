@@ -0,0 +1,192 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"time"
+)
+
+var (
+	ErrStreamingSigned = errors.New("Streamed documents cannot be signed")
+	ErrPageFinished    = errors.New("Nothing can be drawn on a page once it is finished")
+)
+
+// Streaming writes each page's content and the images it uses
+// as soon as the page is finished, which is when the next page is
+// created, rather than keeping them in memory until the document
+// is closed. Nothing can be drawn on a page once it is finished
+// and streamed documents cannot be signed; Close returns
+// ErrPageFinished or ErrStreamingSigned if they are. Options that
+// conflict are reported before anything is written.
+func Streaming() Option {
+	return func(doc *pdfDoc) {
+		doc.streaming = true
+	}
+}
+
+// begin writes the header of the document the first time it is
+// called, returning the writer that counts the bytes written.
+func (doc *pdfDoc) begin(w io.Writer) (*countingWriter, error) {
+	if doc.cw != nil {
+		return doc.cw, nil
+	}
+
+	// Options that conflict are found before anything is written.
+	if err := doc.checkOptions(); err != nil {
+		return nil, err
+	}
+
+	cw := &countingWriter{w, 0}
+
+	_, err := fmt.Fprint(cw, "%PDF-1.7\r\n")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = cw.Write([]byte{200, 200, 200, 200, 13, 10})
+	if err != nil {
+		return nil, err
+	}
+
+	doc.cw = cw
+	return cw, nil
+}
+
+// identify sets the identifier of the document, which is also
+// needed to encrypt it, the first time it is called.
+func (doc *pdfDoc) identify(meta func() []byte) error {
+	if doc.id != nil {
+		return nil
+	}
+	doc.id = meta()
+	if doc.enc != nil {
+		return doc.enc.init(doc.id)
+	}
+	return nil
+}
+
+// flush writes an object to the document before it is closed
+// and records its offset.
+func (doc *pdfDoc) flush(o pdfObj) error {
+	if _, written := doc.offsets[o.Id()]; written {
+		return nil
+	}
+
+	err := doc.identify(func() []byte {
+		return fileId(completeMetadata(doc.meta, time.Now()), len(doc.objs))
+	})
+	if err != nil {
+		return err
+	}
+
+	cw, err := doc.begin(doc.w)
+	if err != nil {
+		return err
+	}
+
+	doc.offsets[o.Id()] = cw.n
+	_, err = o.WriteTo(doc.writerFor(cw, o))
+	return err
+}
+
+// finishLastPage finishes the last page of a streamed document
+// before another is added.
+func (doc *pdfDoc) finishLastPage() {
+	if doc.streaming && doc.err == nil && len(doc.pages.pages) > 0 {
+		doc.err = doc.finishPage(doc.pages.pages[len(doc.pages.pages)-1])
+	}
+}
+
+// finishPage writes the content of a page and the images drawn
+// on it and releases them. The images can still be drawn on
+// later pages.
+func (doc *pdfDoc) finishPage(p *pdfPage) error {
+
+	p.Close()
+
+	// Nothing is drawn on appended pages until their surface is
+	// used and pages moved by reordering may already be finished.
+	if p.src != nil && p.sfc == nil || p.src == nil && p.c.b == nil {
+		return nil
+	}
+
+	sfc := p.Surface().(*pdfSurface)
+	for _, xo := range sfc.xobjs {
+		i, ok := xo.(*pdfImage)
+		if !ok {
+			continue
+		}
+		if _, written := doc.offsets[i.id]; written {
+			continue
+		}
+		doc.addMask(i)
+		if err := doc.flush(i); err != nil {
+			return err
+		}
+		if i.mask != nil {
+			if err := doc.flush(i.mask); err != nil {
+				return err
+			}
+			i.mask.content = bytes.Buffer{}
+		}
+		i.src = emptyImage{i.src.Bounds()}
+	}
+
+	if p.src != nil {
+		sfc.w = finishedWriter{doc}
+		return doc.finishOverlay(p.src)
+	}
+
+	if err := doc.flush(p.c); err != nil {
+		return err
+	}
+	sfc.w = finishedWriter{doc}
+	doc.pool.FreeBuffer(p.c.b)
+	p.c.b = nil
+	return nil
+}
+
+// finishedWriter replaces the content of a finished page,
+// recording an error if anything more is drawn on it.
+type finishedWriter struct {
+	doc *pdfDoc
+}
+
+func (w finishedWriter) Write(b []byte) (int, error) {
+	w.doc.fail(ErrPageFinished)
+	return len(b), nil
+}
+
+// emptyImage replaces the pixels of an image once they have
+// been written or encoded, keeping its size. It is not opaque so that the
+// image is never drawn inline.
+type emptyImage struct {
+	r image.Rectangle
+}
+
+func (i emptyImage) ColorModel() color.Model {
+	return color.AlphaModel
+}
+
+func (i emptyImage) Bounds() image.Rectangle {
+	return i.r
+}
+
+func (i emptyImage) At(x, y int) color.Color {
+	return color.Transparent
+}
+
+func (i emptyImage) Opaque() bool {
+	return false
+}
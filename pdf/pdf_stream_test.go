@@ -0,0 +1,147 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"image"
+	"strconv"
+	"testing"
+
+	"github.com/adkennan/dox2go"
+)
+
+func TestStreaming(t *testing.T) {
+
+	for _, opts := range [][]Option{
+		{Streaming()},
+		{Streaming(), ObjectStreams()},
+	} {
+		var b bytes.Buffer
+		d := NewPdfDoc(&b, opts...)
+		f := d.CreateFont(FONT_Helvetica, dox2go.FS_Regular, 12)
+
+		src := image.NewRGBA(image.Rect(0, 0, 16, 16))
+		img := d.CreateImage(src)
+
+		p1 := d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait).(*pdfPage)
+		s := p1.Surface()
+		s.Text(f, 10, 90, "Page one")
+		s.Image(img, 10, 10, 20, 20)
+
+		if b.Len() != 0 {
+			t.Errorf("Expected nothing to be written before the page is finished. Was %d bytes", b.Len())
+		}
+
+		p2 := d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+
+		if !bytes.Contains(b.Bytes(), []byte("Page one")) {
+			t.Errorf("Expected the first page to be written when the second was created")
+		}
+		if p1.c.b != nil {
+			t.Errorf("Expected the content of the first page to be released")
+		}
+		if img.Width() != 16 || img.Height() != 16 {
+			t.Errorf("Expected the image to keep its size. Was %dx%d", img.Width(), img.Height())
+		}
+
+		s = p2.Surface()
+		s.Text(f, 10, 90, "Page two")
+		s.Image(img, 10, 10, 20, 20)
+
+		if err := d.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := bytes.Count(b.Bytes(), []byte("/Subtype  /Image")); n != 2 {
+			t.Errorf("Expected the image and its mask to be written once. Was %d", n)
+		}
+
+		checkOffsets(t, b.Bytes())
+	}
+}
+
+func TestStreamingSigned(t *testing.T) {
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	sig := dox2go.Signature{Signer: key, Chain: []*x509.Certificate{selfSignedCert(t, key)}}
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b, Streaming())
+	p := d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+	d.Sign(p, 0, 0, 10, 10, sig).Translate(1, 1)
+
+	// The signature is refused before the page is written.
+	doc := d.(*pdfDoc)
+	if doc.err != ErrStreamingSigned || len(doc.sigs) != 0 || doc.form != nil {
+		t.Errorf("Expected the signature to be refused. Was %v", doc.err)
+	}
+	if err := d.Close(); err != ErrStreamingSigned {
+		t.Errorf("Expected %v. Was %v", ErrStreamingSigned, err)
+	}
+}
+
+func TestStreamingFinishedPage(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b, Streaming())
+	p := d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+	d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+	p.Surface().Translate(10, 10)
+	if err := d.Close(); err != ErrPageFinished {
+		t.Errorf("Expected %v. Was %v", ErrPageFinished, err)
+	}
+}
+
+func TestStreamingConflictingOptions(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b, Streaming(), PdfA(PA_2B), Encrypt(EA_AES128, "user", "owner", PM_All))
+	d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+	d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait)
+
+	if b.Len() != 0 {
+		t.Errorf("Expected nothing to be written. Was %d bytes", b.Len())
+	}
+	if err := d.(*pdfDoc).err; err != ErrPdfAEncrypted {
+		t.Errorf("Expected %v when the first page was finished. Was %v", ErrPdfAEncrypted, err)
+	}
+	if err := d.Close(); err != ErrPdfAEncrypted {
+		t.Errorf("Expected %v. Was %v", ErrPdfAEncrypted, err)
+	}
+}
+
+// checkOffsets checks that each object starts where the cross
+// reference table or stream says it does.
+func checkOffsets(t *testing.T, pdf []byte) {
+
+	r := newReader(pdf)
+	if err := r.readXrefs(); err != nil {
+		t.Errorf("Expected a valid cross reference table. Was %v", err)
+		return
+	}
+	if len(r.xref) == 0 {
+		t.Errorf("Expected a cross reference table")
+	}
+	for id, e := range r.xref {
+		switch e.typ {
+		case 1:
+			obj := []byte(strconv.Itoa(id) + " " + strconv.Itoa(e.f3) + " obj")
+			if e.f2 >= int64(len(pdf)) || !bytes.HasPrefix(pdf[e.f2:], obj) {
+				t.Errorf("Expected object %d at offset %d", id, e.f2)
+			}
+		case 2:
+			if stm := r.xref[int(e.f2)]; stm.typ != 1 {
+				t.Errorf("Expected object %d to be in object stream %d", id, e.f2)
+			}
+		}
+	}
+}
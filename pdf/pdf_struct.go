@@ -0,0 +1,318 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/adkennan/dox2go"
+)
+
+// pdfStructTree is the root of the logical structure of a
+// tagged document. It is only added to the document once a
+// structure element has been opened.
+type pdfStructTree struct {
+	id    int
+	kids  []*pdfStructElem
+	stack []*pdfStructElem
+	pages []*pdfPage
+}
+
+// structTree returns the structure tree of the document, adding
+// it to the catalog if necessary.
+func (doc *pdfDoc) structTree() *pdfStructTree {
+	if doc.tags == nil {
+		doc.tags = &pdfStructTree{
+			len(doc.objs) + 1,
+			make([]*pdfStructElem, 0, 1),
+			make([]*pdfStructElem, 0, 4),
+			make([]*pdfPage, 0, 4),
+		}
+		doc.objs = append(doc.objs, doc.tags)
+		doc.catalog.objs = append(doc.catalog.objs, doc.tags)
+	}
+	return doc.tags
+}
+
+// current returns the innermost open element or nil if no
+// element is open.
+func (t *pdfStructTree) current() *pdfStructElem {
+	if len(t.stack) == 0 {
+		return nil
+	}
+	return t.stack[len(t.stack)-1]
+}
+
+func (t *pdfStructTree) Id() int {
+	return t.id
+}
+
+func (t *pdfStructTree) Type() string {
+	return "StructTreeRoot"
+}
+
+func (t *pdfStructTree) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(t, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	aw := arrayWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(t.Type())
+	dw.Name("K")
+	aw.Start()
+	for _, e := range t.kids {
+		aw.Ref(e)
+	}
+	aw.End()
+
+	// The parent tree maps the marked content of each page
+	// to the elements that own it.
+	dw.Name("ParentTree")
+	dw.Start()
+	dw.Name("Nums")
+	aw.Start()
+	for ix, p := range t.pages {
+		aw.Value(ix)
+		aw.Start()
+		for _, e := range p.mcids {
+			aw.Ref(e)
+		}
+		aw.End()
+	}
+	aw.End()
+	dw.End()
+	dw.Name("ParentTreeNextKey")
+	dw.Value(len(t.pages))
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	if aw.err != nil {
+		return n, aw.err
+	}
+	n += dw.n + aw.n
+
+	n2, err := endObj(t, w)
+	n += int64(n2)
+	return n, err
+}
+
+///////////////////////////////////////////////////////////
+
+// pdfMcr refers to a marked content sequence of a page.
+type pdfMcr struct {
+	page *pdfPage
+	mcid int
+}
+
+// pdfStructElem is an element of the structure tree. Its kids
+// are either other elements or marked content sequences.
+type pdfStructElem struct {
+	id     int
+	st     dox2go.StructType
+	parent pdfObj
+	alt    string
+	page   *pdfPage
+	kids   []interface{}
+}
+
+func (e *pdfStructElem) Id() int {
+	return e.id
+}
+
+func (e *pdfStructElem) Type() string {
+	return "StructElem"
+}
+
+func (e *pdfStructElem) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(e, w)
+	if err != nil {
+		return 0, err
+	}
+
+	dw := dictionaryWriter{w, 0, nil}
+	aw := arrayWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(e.Type())
+	dw.Name("S")
+	dw.Name(e.st.String())
+	dw.Name("P")
+	dw.Ref(e.parent)
+	if e.page != nil {
+		dw.Name("Pg")
+		dw.Ref(e.page)
+	}
+	if e.alt != "" {
+		dw.Name("Alt")
+		dw.String(e.alt)
+	}
+	dw.Name("K")
+	aw.Start()
+	for _, k := range e.kids {
+		switch k := k.(type) {
+		case *pdfStructElem:
+			aw.Ref(k)
+		case pdfMcr:
+			// Content on a page other than the element's
+			// own page needs a reference to its page.
+			if k.page == e.page {
+				aw.Value(" ")
+				aw.Value(k.mcid)
+			} else {
+				dw.Start()
+				dw.Name("Type")
+				dw.Name("MCR")
+				dw.Name("Pg")
+				dw.Ref(k.page)
+				dw.Name("MCID")
+				dw.Value(k.mcid)
+				dw.End()
+			}
+		}
+	}
+	aw.End()
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	if aw.err != nil {
+		return n, aw.err
+	}
+	n += dw.n + aw.n
+
+	n2, err := endObj(e, w)
+	n += int64(n2)
+	return n, err
+}
+
+///////////////////////////////////////////////////////////
+
+func (sfc *pdfSurface) BeginElement(st dox2go.StructType, alt string) {
+
+	// Only the content of pages is tagged.
+	if sfc.page == nil {
+		return
+	}
+
+	sfc.endMarked()
+
+	doc := sfc.doc
+	t := doc.structTree()
+	e := &pdfStructElem{len(doc.objs) + 1, st, t, alt, nil, make([]interface{}, 0, 1)}
+
+	if parent := t.current(); parent != nil {
+		e.parent = parent
+		parent.kids = append(parent.kids, e)
+	} else {
+		t.kids = append(t.kids, e)
+	}
+	t.stack = append(t.stack, e)
+
+	doc.objs = append(doc.objs, e)
+}
+
+func (sfc *pdfSurface) EndElement() {
+
+	if sfc.page == nil || sfc.doc.tags == nil {
+		return
+	}
+
+	sfc.endMarked()
+
+	t := sfc.doc.tags
+	e := t.current()
+	if e == nil {
+		return
+	}
+	t.stack = t.stack[:len(t.stack)-1]
+
+	// The element's content may still be open on the surfaces
+	// of other pages.
+	for _, p := range sfc.doc.pages.pages {
+		if p.sfc != nil && p.sfc.marked == e {
+			p.sfc.endMarked()
+		}
+	}
+}
+
+func (sfc *pdfSurface) BeginArtifact() {
+
+	sfc.endMarked()
+	sfc.endText()
+
+	fmt.Fprint(sfc.w, "/Artifact BMC\r\n")
+	sfc.artifact = true
+}
+
+func (sfc *pdfSurface) EndArtifact() {
+
+	if sfc.artifact {
+		sfc.endText()
+
+		fmt.Fprint(sfc.w, "EMC\r\n")
+		sfc.artifact = false
+	}
+}
+
+// mark starts a marked content sequence for the innermost open
+// element before content is drawn. The content of an element
+// is split into several sequences when its children are drawn
+// in between.
+func (sfc *pdfSurface) mark() {
+
+	if sfc.page == nil || sfc.artifact || sfc.doc.tags == nil {
+		return
+	}
+
+	e := sfc.doc.tags.current()
+	if sfc.marked == e {
+		return
+	}
+
+	// Content drawn once the element of the open sequence has
+	// ended does not belong to it.
+	sfc.endMarked()
+	if e == nil {
+		return
+	}
+	sfc.endText()
+
+	p := sfc.page
+	if len(p.mcids) == 0 {
+		p.structParents = len(sfc.doc.tags.pages)
+		sfc.doc.tags.pages = append(sfc.doc.tags.pages, p)
+	}
+	mcid := len(p.mcids)
+	p.mcids = append(p.mcids, e)
+
+	if e.page == nil {
+		e.page = p
+	}
+	e.kids = append(e.kids, pdfMcr{p, mcid})
+
+	fmt.Fprintf(sfc.w, "/%s <</MCID %d>> BDC\r\n", e.st, mcid)
+	sfc.marked = e
+}
+
+// endMarked ends the current marked content sequence.
+func (sfc *pdfSurface) endMarked() {
+	if sfc.marked != nil {
+		sfc.endText()
+
+		fmt.Fprint(sfc.w, "EMC\r\n")
+		sfc.marked = nil
+	}
+}
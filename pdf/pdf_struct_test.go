@@ -0,0 +1,136 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/adkennan/dox2go"
+)
+
+func TestStructure(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	d.SetMetadata(dox2go.Metadata{Language: "en-AU"})
+	f := d.CreateFont(FONT_Helvetica, dox2go.FS_Bold, 12)
+
+	p := d.CreatePage(dox2go.U_MM, 100, 100, dox2go.PO_Portrait).(*pdfPage)
+	s := p.Surface()
+
+	s.BeginArtifact()
+	s.Text(f, 10, 90, "Header")
+	s.EndArtifact()
+
+	s.BeginElement(dox2go.ST_Document, "")
+	s.BeginElement(dox2go.ST_H1, "")
+	s.Text(f, 10, 80, "Heading")
+	s.EndElement()
+	s.BeginElement(dox2go.ST_Figure, "A square")
+	path := dox2go.NewPath()
+	path.Rect(10, 10, 20, 20)
+	s.Fill(path)
+	s.EndElement()
+	s.EndElement()
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.mcids) != 2 {
+		t.Errorf("Expected 2 marked content sequences. Was %d", len(p.mcids))
+	}
+
+	for _, s := range []string{
+		"/Artifact BMC",
+		"/H1 <</MCID 0>> BDC",
+		"/Figure <</MCID 1>> BDC",
+		"/StructTreeRoot",
+		"/ParentTree",
+		"/StructParents 0",
+		"/Alt",
+		"(A square)",
+		"/MarkInfo",
+		"/Lang",
+		"(en-AU)",
+		"<dc:language>",
+	} {
+		if !bytes.Contains(b.Bytes(), []byte(s)) {
+			t.Errorf("Expected the document to contain %s", s)
+		}
+	}
+}
+
+func TestStructureAcrossPages(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	f := d.CreateFont(FONT_Helvetica, dox2go.FS_Regular, 12)
+	s1 := d.CreatePage(dox2go.U_PT, 200, 200, dox2go.PO_Portrait).Surface()
+	s2 := d.CreatePage(dox2go.U_PT, 200, 200, dox2go.PO_Portrait).Surface()
+
+	s1.BeginElement(dox2go.ST_P, "")
+	s1.Text(f, 10, 10, "One")
+	s2.Text(f, 10, 10, "Two")
+	s1.EndElement()
+	s2.Text(f, 10, 50, "Untagged")
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := readPdf(t, b.Bytes())
+
+	// The element's content on the second page is ended before
+	// the untagged text is drawn.
+	page, _ := r.Page(1)
+	ops, err := page.Operations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	depth := 0
+	var texts []int
+	for _, op := range ops {
+		switch op.Operator {
+		case "BDC":
+			depth++
+		case "EMC":
+			depth--
+		case "Tj":
+			texts = append(texts, depth)
+		}
+	}
+	if len(texts) != 2 || texts[0] != 1 || texts[1] != 0 {
+		t.Errorf("Expected only the first text to be marked. Was %v", texts)
+	}
+	if depth != 0 {
+		t.Errorf("Expected every sequence to be ended. Was %d open", depth)
+	}
+
+	// The content on the second page is referred to with a
+	// marked content reference.
+	cat, _ := r.Catalog()
+	root, _ := r.resolveDict(cat["StructTreeRoot"])
+	kids, _ := r.resolveArray(root["K"])
+	if len(kids) != 1 {
+		t.Fatalf("Expected 1 element. Was %v", kids)
+	}
+	p, _ := r.resolveDict(kids[0])
+	first, _ := r.Page(0)
+	if p["Pg"] != first.Ref() {
+		t.Errorf("Expected the element to be on the first page. Was %v", p["Pg"])
+	}
+	k, _ := r.resolveArray(p["K"])
+	if len(k) != 2 || k[0] != 0 {
+		t.Fatalf("Expected a sequence on each page. Was %v", k)
+	}
+	mcr, _ := k[1].(Dict)
+	if mcr["Type"] != Name("MCR") || mcr["Pg"] != page.Ref() || mcr["MCID"] != 0 {
+		t.Errorf("Expected a reference to the second page. Was %v", k[1])
+	}
+}
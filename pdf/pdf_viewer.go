@@ -0,0 +1,89 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"github.com/adkennan/dox2go"
+)
+
+var pageLayouts = map[dox2go.PageLayout]string{
+	dox2go.PL_SinglePage:     "SinglePage",
+	dox2go.PL_OneColumn:      "OneColumn",
+	dox2go.PL_TwoColumnLeft:  "TwoColumnLeft",
+	dox2go.PL_TwoColumnRight: "TwoColumnRight",
+	dox2go.PL_TwoPageLeft:    "TwoPageLeft",
+	dox2go.PL_TwoPageRight:   "TwoPageRight",
+}
+
+var pageModes = map[dox2go.PageMode]string{
+	dox2go.PM_UseNone:        "UseNone",
+	dox2go.PM_UseOutlines:    "UseOutlines",
+	dox2go.PM_UseThumbs:      "UseThumbs",
+	dox2go.PM_FullScreen:     "FullScreen",
+	dox2go.PM_UseOC:          "UseOC",
+	dox2go.PM_UseAttachments: "UseAttachments",
+}
+
+var duplexModes = map[dox2go.Duplex]string{
+	dox2go.DX_Simplex:       "Simplex",
+	dox2go.DX_FlipShortEdge: "DuplexFlipShortEdge",
+	dox2go.DX_FlipLongEdge:  "DuplexFlipLongEdge",
+}
+
+func (doc *pdfDoc) SetPageLayout(pl dox2go.PageLayout) {
+	doc.catalog.layout = pageLayouts[pl]
+}
+
+func (doc *pdfDoc) SetPageMode(pm dox2go.PageMode) {
+	doc.catalog.mode = pageModes[pm]
+}
+
+func (doc *pdfDoc) SetOpenAction(p dox2go.Page, x, y, zoom float64) {
+	if page, ok := p.(*pdfPage); ok {
+		doc.catalog.openAction = zoomDest(page, x, y, zoom)
+	}
+}
+
+func (doc *pdfDoc) SetViewerPreferences(vp dox2go.ViewerPreferences) {
+	doc.catalog.prefs = &vp
+}
+
+// writePreferences writes the viewer preferences dictionary.
+// Only the preferences that differ from the defaults are written.
+func writePreferences(dw *dictionaryWriter, vp *dox2go.ViewerPreferences) {
+	dw.Start()
+	if vp.HideToolbar {
+		dw.Name("HideToolbar")
+		dw.Value("true")
+	}
+	if vp.HideMenubar {
+		dw.Name("HideMenubar")
+		dw.Value("true")
+	}
+	if vp.FitWindow {
+		dw.Name("FitWindow")
+		dw.Value("true")
+	}
+	if vp.CenterWindow {
+		dw.Name("CenterWindow")
+		dw.Value("true")
+	}
+	if vp.DisplayDocTitle {
+		dw.Name("DisplayDocTitle")
+		dw.Value("true")
+	}
+	if vp.NoPrintScaling {
+		dw.Name("PrintScaling")
+		dw.Name("None")
+	}
+	if d, ok := duplexModes[vp.Duplex]; ok {
+		dw.Name("Duplex")
+		dw.Name(d)
+	}
+	dw.End()
+}
@@ -0,0 +1,50 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+package pdf
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/adkennan/dox2go"
+)
+
+func TestViewerPreferences(t *testing.T) {
+
+	var b bytes.Buffer
+	d := NewPdfDoc(&b)
+	d.CreatePage(dox2go.U_PT, 600, 800, dox2go.PO_Portrait)
+	p := d.CreatePage(dox2go.U_PT, 600, 800, dox2go.PO_Portrait)
+	d.SetPageLayout(dox2go.PL_TwoPageRight)
+	d.SetPageMode(dox2go.PM_UseOutlines)
+	d.SetOpenAction(p, 0, 800, 1.5)
+	d.SetViewerPreferences(dox2go.ViewerPreferences{
+		DisplayDocTitle: true,
+		NoPrintScaling:  true,
+		Duplex:          dox2go.DX_FlipLongEdge,
+	})
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{
+		"/PageLayout  /TwoPageRight",
+		"/PageMode  /UseOutlines",
+		"/OpenAction  [  " + strconv.Itoa(p.(*pdfPage).id) + " 0 R /XYZ 0 800 1.5 ]",
+		"/DisplayDocTitle true",
+		"/PrintScaling  /None",
+		"/Duplex  /DuplexFlipLongEdge",
+	} {
+		if !bytes.Contains(b.Bytes(), []byte(s)) {
+			t.Errorf("Expected the document to contain %s", s)
+		}
+	}
+	if bytes.Contains(b.Bytes(), []byte("/HideToolbar")) {
+		t.Errorf("Expected default preferences to be omitted.")
+	}
+}
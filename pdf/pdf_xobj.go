@@ -0,0 +1,103 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package pdf
+
+import (
+	"io"
+
+	"github.com/adkennan/dox2go"
+)
+
+// pdfFormXObj is a form XObject; a self contained content
+// stream with its own resources. Forms are used as the
+// appearances of annotations and form fields.
+type pdfFormXObj struct {
+	id   int
+	bbox rect
+	sfc  *pdfSurface
+	c    sizedBuffer
+}
+
+// newFormXObj creates a form XObject of size w, h in the unit pu
+// and adds it to the document. The form is drawn on using its
+// surface.
+func (doc *pdfDoc) newFormXObj(pu dox2go.PageUnit, w, h float64) *pdfFormXObj {
+
+	c := doc.getBuffer(contentBuf)
+	f := &pdfFormXObj{
+		len(doc.objs) + 1,
+		rect{0, 0,
+			dox2go.ConvertUnit(w, pu, dox2go.U_PT),
+			dox2go.ConvertUnit(h, pu, dox2go.U_PT)},
+		newSurface(doc, c, pu),
+		c,
+	}
+
+	doc.objs = append(doc.objs, f)
+
+	return f
+}
+
+func (f *pdfFormXObj) Id() int {
+	return f.id
+}
+
+func (f *pdfFormXObj) Type() string {
+	return "XObject"
+}
+
+func (f *pdfFormXObj) hasStream() bool {
+	return true
+}
+
+func (f *pdfFormXObj) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = startObj(f, w)
+	if err != nil {
+		return 0, err
+	}
+
+	f.sfc.Close()
+
+	dw := dictionaryWriter{w, 0, nil}
+	dw.Start()
+	dw.Name("Type")
+	dw.Name(f.Type())
+	dw.Name("Subtype")
+	dw.Name("Form")
+	dw.Name("BBox")
+	f.bbox.write(&dw)
+	dw.Name("Resources")
+	f.sfc.writeResources(&dw)
+	dw.Name("Length")
+	dw.Value(streamLength(w, f.c.Len()))
+	dw.End()
+
+	if dw.err != nil {
+		return n, dw.err
+	}
+	n += dw.n
+
+	n2, err := startStream(w)
+	if err != nil {
+		return n, err
+	}
+	n += n2
+	n2, err = f.c.WriteTo(w)
+	if err != nil {
+		return n, err
+	}
+	n += n2
+	n2, err = endStream(w)
+	if err != nil {
+		return n, err
+	}
+	n += n2
+	n2, err = endObj(f, w)
+	n += n2
+	return n, err
+}
@@ -0,0 +1,68 @@
+/*
+* dox2go - A document generating library for go.
+*
+* Copyright 2013 Andrew Kennan. All rights reserved.
+*
+ */
+
+package dox2go
+
+// StructType is the role of a structure element in the
+// logical structure of a document. Screen readers and other
+// assistive technology use the structure to present the
+// content of the document in its reading order.
+type StructType int32
+
+// These are the available structure types.
+//
+// ST_Document is the whole document.
+//
+// ST_H1 to ST_H6 are headings and ST_P is a paragraph.
+//
+// ST_Table is a table made of ST_TR rows which contain
+// ST_TH header cells and ST_TD data cells.
+//
+// ST_Figure is an illustration and requires alternate text.
+//
+// ST_L is a list made of ST_LI items. An item may contain an
+// ST_Lbl label, such as a bullet, and an ST_LBody body.
+//
+// ST_Span is a run of text within another element.
+const (
+	ST_Document StructType = iota
+	ST_H1
+	ST_H2
+	ST_H3
+	ST_H4
+	ST_H5
+	ST_H6
+	ST_P
+	ST_Table
+	ST_TR
+	ST_TH
+	ST_TD
+	ST_Figure
+	ST_L
+	ST_LI
+	ST_Lbl
+	ST_LBody
+	ST_Span
+)
+
+var structNames = [...]string{
+	"Document",
+	"H1", "H2", "H3", "H4", "H5", "H6",
+	"P",
+	"Table", "TR", "TH", "TD",
+	"Figure",
+	"L", "LI", "Lbl", "LBody",
+	"Span",
+}
+
+// String returns the standard name of the structure type.
+func (st StructType) String() string {
+	if st < 0 || int(st) >= len(structNames) {
+		return "Span"
+	}
+	return structNames[st]
+}